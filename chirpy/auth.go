@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/auth"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/database"
+)
+
+// userIDFromRequest validates the bearer JWT on the request and returns
+// the ID of the user it was issued to.
+func (cfg *apiConfig) userIDFromRequest(r *http.Request) (int, error) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return 0, err
+	}
+	subject, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		return 0, err
+	}
+	userID, err := strconv.Atoi(subject)
+	if err != nil {
+		return 0, errors.New("invalid userID in JWT subject")
+	}
+	return userID, nil
+}
+
+// visibilityForRequest returns the block and mute filters for the user
+// making the request. Anonymous requests, or ones with a bad token, see
+// everything.
+func (cfg *apiConfig) visibilityForRequest(r *http.Request) (database.Visibility, error) {
+	userID, err := cfg.userIDFromRequest(r)
+	if err != nil {
+		userID = 0
+	}
+	return cfg.DB.GetVisibility(r.Context(), userID)
+}
+
+// moderatorFromRequest returns the requesting user if they hold the
+// moderator role, either in the database or via MODERATOR_EMAILS.
+func (cfg *apiConfig) moderatorFromRequest(r *http.Request) (database.User, error) {
+	userID, err := cfg.userIDFromRequest(r)
+	if err != nil {
+		return database.User{}, err
+	}
+	user, err := cfg.DB.GetUser(r.Context(), userID)
+	if err != nil {
+		return database.User{}, err
+	}
+	if user.Role == database.RoleModerator {
+		return user, nil
+	}
+	if _, ok := cfg.settings.Load().moderatorEmails[user.Email]; ok {
+		return user, nil
+	}
+	return database.User{}, errors.New("moderator role required")
+}
@@ -0,0 +1,362 @@
+// Package client is a typed Go client for the Chirpy API described in
+// openapi.json. It covers accounts, authentication and chirps.
+//
+//	c := client.New("https://chirpy.example.com")
+//	session, err := c.Login(ctx, "me@example.com", "password")
+//	...
+//	chirp, err := c.WithToken(session.Token).CreateChirp(ctx, client.CreateChirpRequest{Body: "hello"})
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiPrefix is the version of the API this client speaks.
+const apiPrefix = "/api/v1"
+
+// Client calls a Chirpy server. It is safe for concurrent use.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	token      string
+	// idempotencyKey, if set, is sent with every write.
+	idempotencyKey string
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client used for requests. The default is
+// http.DefaultClient.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// New returns a client for the server at baseURL.
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// WithToken returns a copy of c that authenticates with the given access
+// token, as returned by Login or Refresh.
+func (c *Client) WithToken(token string) *Client {
+	copied := *c
+	copied.token = token
+	return &copied
+}
+
+// WithIdempotencyKey returns a copy of c that sends key as the
+// Idempotency-Key of its writes, so they can be retried without being
+// applied twice. Use a fresh key, and so a fresh copy, for each write.
+func (c *Client) WithIdempotencyKey(key string) *Client {
+	copied := *c
+	copied.idempotencyKey = key
+	return &copied
+}
+
+// Error is returned for any response with a 4xx or 5xx status. It holds
+// the RFC 7807 problem details the server sent.
+type Error struct {
+	StatusCode int          `json:"status"`
+	Type       string       `json:"type"`
+	Code       string       `json:"code"`
+	Title      string       `json:"title"`
+	Detail     string       `json:"detail,omitempty"`
+	RequestID  string       `json:"request_id,omitempty"`
+	Errors     []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError describes one invalid field of a request.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	msg := e.Detail
+	if msg == "" {
+		msg = e.Title
+	}
+	for _, fe := range e.Errors {
+		msg += fmt.Sprintf("; %s %s", fe.Field, fe.Message)
+	}
+	if e.RequestID != "" {
+		return fmt.Sprintf("chirpy: %d %s: %s (request %s)", e.StatusCode, e.Code, msg, e.RequestID)
+	}
+	return fmt.Sprintf("chirpy: %d %s: %s", e.StatusCode, e.Code, msg)
+}
+
+type User struct {
+	ID          int    `json:"id"`
+	Email       string `json:"email"`
+	IsChirpyRed bool   `json:"is_chirpy_red"`
+	Handle      string `json:"handle"`
+	DisplayName string `json:"display_name"`
+}
+
+// LoginResponse is the logged in user with their tokens.
+type LoginResponse struct {
+	User
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+type Profile struct {
+	ID          int    `json:"id"`
+	Handle      string `json:"handle"`
+	DisplayName string `json:"display_name"`
+	Bio         string `json:"bio"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+	IsChirpyRed bool   `json:"is_chirpy_red"`
+}
+
+// ProfileUpdate changes only the fields that are non-nil.
+type ProfileUpdate struct {
+	Handle        *string `json:"handle,omitempty"`
+	DisplayName   *string `json:"display_name,omitempty"`
+	Bio           *string `json:"bio,omitempty"`
+	AvatarMediaID *int    `json:"avatar_media_id,omitempty"`
+}
+
+type Chirp struct {
+	ID        int        `json:"id"`
+	Body      string     `json:"body"`
+	AuthorID  int        `json:"author_id"`
+	Media     []Media    `json:"media"`
+	CreatedAt time.Time  `json:"created_at"`
+	EditedAt  *time.Time `json:"edited_at"`
+	Revision  int        `json:"revision"`
+	InReplyTo int        `json:"in_reply_to,omitempty"`
+	Mentions  []Mention  `json:"mentions"`
+	Hashtags  []Hashtag  `json:"hashtags"`
+	Hidden    bool       `json:"hidden,omitempty"`
+}
+
+type Media struct {
+	ID           int    `json:"id"`
+	ContentType  string `json:"content_type"`
+	Size         int64  `json:"size"`
+	URL          string `json:"url"`
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+}
+
+type Mention struct {
+	UserID int    `json:"user_id"`
+	Text   string `json:"text"`
+	Start  int    `json:"start"`
+	End    int    `json:"end"`
+}
+
+type Hashtag struct {
+	Tag   string `json:"tag"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+type ChirpRevision struct {
+	Revision  int       `json:"revision"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type CreateChirpRequest struct {
+	Body      string `json:"body"`
+	MediaIDs  []int  `json:"media_ids,omitempty"`
+	InReplyTo int    `json:"in_reply_to,omitempty"`
+}
+
+// ListChirpsOptions filters ListChirps. The zero value lists every
+// chirp oldest first.
+type ListChirpsOptions struct {
+	AuthorID int
+	// Sort is "asc" or "desc" by ID.
+	Sort string
+}
+
+type credentials struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// CreateUser signs up a new user.
+func (c *Client) CreateUser(ctx context.Context, email, password string) (*User, error) {
+	var user User
+	err := c.do(ctx, http.MethodPost, "/users", credentials{email, password}, &user)
+	return &user, err
+}
+
+// UpdateUser changes the authenticated user's email and password.
+func (c *Client) UpdateUser(ctx context.Context, email, password string) (*User, error) {
+	var user User
+	err := c.do(ctx, http.MethodPut, "/users", credentials{email, password}, &user)
+	return &user, err
+}
+
+// DeleteUser deletes the authenticated user's account.
+func (c *Client) DeleteUser(ctx context.Context) error {
+	return c.do(ctx, http.MethodDelete, "/users", nil, nil)
+}
+
+// GetProfile looks up a user by handle.
+func (c *Client) GetProfile(ctx context.Context, handle string) (*Profile, error) {
+	var profile Profile
+	err := c.do(ctx, http.MethodGet, "/users/"+url.PathEscape(handle), nil, &profile)
+	return &profile, err
+}
+
+// UpdateProfile changes the authenticated user's profile.
+func (c *Client) UpdateProfile(ctx context.Context, update ProfileUpdate) (*Profile, error) {
+	var profile Profile
+	err := c.do(ctx, http.MethodPut, "/users/me/profile", update, &profile)
+	return &profile, err
+}
+
+// UserChirps lists a user's chirps, newest first.
+func (c *Client) UserChirps(ctx context.Context, handle string) ([]Chirp, error) {
+	var chirps []Chirp
+	err := c.do(ctx, http.MethodGet, "/users/"+url.PathEscape(handle)+"/chirps", nil, &chirps)
+	return chirps, err
+}
+
+// Login exchanges an email and password for an access and refresh token.
+func (c *Client) Login(ctx context.Context, email, password string) (*LoginResponse, error) {
+	var resp LoginResponse
+	err := c.do(ctx, http.MethodPost, "/login", credentials{email, password}, &resp)
+	return &resp, err
+}
+
+// Refresh returns a new access token for a refresh token.
+func (c *Client) Refresh(ctx context.Context, refreshToken string) (string, error) {
+	var resp struct {
+		Token string `json:"token"`
+	}
+	err := c.WithToken(refreshToken).do(ctx, http.MethodPost, "/refresh", nil, &resp)
+	return resp.Token, err
+}
+
+// Revoke invalidates a refresh token.
+func (c *Client) Revoke(ctx context.Context, refreshToken string) error {
+	return c.WithToken(refreshToken).do(ctx, http.MethodPost, "/revoke", nil, nil)
+}
+
+// CreateChirp posts a chirp as the authenticated user.
+func (c *Client) CreateChirp(ctx context.Context, req CreateChirpRequest) (*Chirp, error) {
+	var chirp Chirp
+	err := c.do(ctx, http.MethodPost, "/chirps", req, &chirp)
+	return &chirp, err
+}
+
+// ListChirps lists chirps visible to the caller.
+func (c *Client) ListChirps(ctx context.Context, opts ListChirpsOptions) ([]Chirp, error) {
+	query := url.Values{}
+	if opts.AuthorID != 0 {
+		query.Set("author_id", strconv.Itoa(opts.AuthorID))
+	}
+	if opts.Sort != "" {
+		query.Set("sort", opts.Sort)
+	}
+	path := "/chirps"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	var chirps []Chirp
+	err := c.do(ctx, http.MethodGet, path, nil, &chirps)
+	return chirps, err
+}
+
+// GetChirp fetches one chirp.
+func (c *Client) GetChirp(ctx context.Context, id int) (*Chirp, error) {
+	var chirp Chirp
+	err := c.do(ctx, http.MethodGet, "/chirps/"+strconv.Itoa(id), nil, &chirp)
+	return &chirp, err
+}
+
+// UpdateChirp edits the body of one of the authenticated user's chirps.
+func (c *Client) UpdateChirp(ctx context.Context, id int, body string) (*Chirp, error) {
+	req := struct {
+		Body string `json:"body"`
+	}{body}
+	var chirp Chirp
+	err := c.do(ctx, http.MethodPut, "/chirps/"+strconv.Itoa(id), req, &chirp)
+	return &chirp, err
+}
+
+// DeleteChirp deletes one of the authenticated user's chirps.
+func (c *Client) DeleteChirp(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, "/chirps/"+strconv.Itoa(id), nil, nil)
+}
+
+// ChirpRevisions lists the earlier versions of an edited chirp.
+func (c *Client) ChirpRevisions(ctx context.Context, id int) ([]ChirpRevision, error) {
+	var revisions []ChirpRevision
+	err := c.do(ctx, http.MethodGet, "/chirps/"+strconv.Itoa(id)+"/revisions", nil, &revisions)
+	return revisions, err
+}
+
+// do sends body, if set, as JSON to path under the API root and decodes
+// a successful response into out, if set.
+func (c *Client) do(ctx context.Context, method, path string, body, out any) error {
+	var reqBody io.Reader
+	if body != nil {
+		dat, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(dat)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+apiPrefix+path, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json, application/problem+json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if c.idempotencyKey != "" && method != http.MethodGet {
+		req.Header.Set("Idempotency-Key", c.idempotencyKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		apiErr := &Error{}
+		if err := json.NewDecoder(resp.Body).Decode(apiErr); err != nil || apiErr.Code == "" {
+			apiErr = &Error{Title: http.StatusText(resp.StatusCode)}
+		}
+		// trust the response status over the body's
+		apiErr.StatusCode = resp.StatusCode
+		return apiErr
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/database"
+)
+
+// routeCacheControl holds the Cache-Control policy of the cacheable
+// routes, keyed by /api/v1 pattern. Everything else under /api is
+// no-store. Feeds are revalidated on every use, which the ETag makes
+// cheap, while single chirps can be reused briefly.
+var routeCacheControl = map[string]string{
+	"GET /api/v1/chirps":                     "public, no-cache",
+	"GET /api/v1/chirps/{chirpID}":           "public, max-age=30, must-revalidate",
+	"GET /api/v1/chirps/{chirpID}/revisions": "public, max-age=30, must-revalidate",
+	"GET /api/v1/users/{handle}/chirps":      "public, no-cache",
+	"GET /api/v1/hashtags/{tag}":             "public, no-cache",
+	"GET /api/v1/hashtags/trending":          "public, max-age=60",
+	"GET /api/v1/openapi.json":               "public, max-age=3600",
+}
+
+// middlewareCacheControl stops anything under /api from being cached
+// unless its handler sets a policy, since most responses are personal
+// or carry tokens.
+func middlewareCacheControl(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			w.Header().Set("Cache-Control", "no-store")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// setCacheControl applies the policy in routeCacheControl for the route
+// r was matched to. Responses to authenticated requests are private,
+// blocks, mutes and hidden chirps make them depend on who is asking.
+func setCacheControl(w http.ResponseWriter, r *http.Request) {
+	policy, ok := routeCacheControl[apiV1Pattern(r.Pattern)]
+	if !ok {
+		return
+	}
+	if r.Header.Get("Authorization") != "" {
+		policy = strings.Replace(policy, "public", "private", 1)
+	}
+	w.Header().Set("Cache-Control", policy)
+	w.Header().Add("Vary", "Authorization")
+}
+
+// chirpsVersion hashes the versions of a list of chirps in order.
+func chirpsVersion(chirps []database.Chirp) uint64 {
+	h := fnv.New64a()
+	for _, c := range chirps {
+		fmt.Fprintf(h, "%x;", c.Version())
+	}
+	return h.Sum64()
+}
+
+// chirpLastModified is when a chirp was last edited, or created.
+func chirpLastModified(c database.Chirp) time.Time {
+	if c.EditedAt != nil {
+		return *c.EditedAt
+	}
+	return c.CreatedAt
+}
+
+// entityTag is the strong ETag for one representation of a resource at
+// version. Representations differ in their bytes, so each gets its own
+// tag.
+func entityTag(version uint64, mediaType string) string {
+	tag := strconv.FormatUint(version, 16)
+	switch mediaType {
+	case mediaTypeNDJSON:
+		tag += ".ndjson"
+	case mediaTypeMsgpack, mediaTypeXMsgpack:
+		tag += ".msgpack"
+	}
+	return `"` + tag + `"`
+}
+
+// entityTags lists the ETags of every representation of a resource at
+// version, for checking If-Match on writes made after any kind of read.
+func entityTags(version uint64) []string {
+	return []string{
+		entityTag(version, mediaTypeJSON),
+		entityTag(version, mediaTypeNDJSON),
+		entityTag(version, mediaTypeMsgpack),
+	}
+}
+
+// checkNotModified sets the route's cache policy and the validators for
+// the representation of version r will get, then evaluates If-None-Match
+// and, failing that, If-Modified-Since. It responds 304 and returns false
+// if the client's copy is current. lastModified may be zero for
+// resources without a reliable modification time.
+func checkNotModified(w http.ResponseWriter, r *http.Request, version uint64, lastModified time.Time) bool {
+	mediaType, _ := negotiate(r, mediaTypeJSON, mediaTypeNDJSON, mediaTypeMsgpack, mediaTypeXMsgpack)
+	etag := entityTag(version, mediaType)
+
+	setCacheControl(w, r)
+	w.Header().Set("ETag", etag)
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	notModified := false
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		notModified = etagListMatches(inm, false, etag)
+	} else if ims, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !lastModified.IsZero() {
+		notModified = !lastModified.Truncate(time.Second).After(ims)
+	}
+	if !notModified {
+		return true
+	}
+
+	// RFC 9110 §15.4.5, a 304 has no body and no content headers
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(http.StatusNotModified)
+	return false
+}
+
+// checkPreconditions evaluates If-Match and If-Unmodified-Since before a
+// write to a resource whose current representations have etags. It
+// responds 412 and returns false if the client's copy is out of date, so
+// concurrent edits fail instead of overwriting each other.
+func checkPreconditions(w http.ResponseWriter, r *http.Request, lastModified time.Time, etags ...string) bool {
+	current := true
+	if im := r.Header.Get("If-Match"); im != "" {
+		current = etagListMatches(im, true, etags...)
+	} else if ius, err := http.ParseTime(r.Header.Get("If-Unmodified-Since")); err == nil && !lastModified.IsZero() {
+		current = !lastModified.Truncate(time.Second).After(ius)
+	}
+	if current {
+		return true
+	}
+
+	respondPreconditionFailed(w)
+	return false
+}
+
+// preconditionVersion is the version a conditional write has to find
+// when it takes the database lock, since the resource can change between
+// checkPreconditions and the write. It is zero, for any version, if r
+// has no preconditions.
+func preconditionVersion(r *http.Request, version uint64) uint64 {
+	if r.Header.Get("If-Match") == "" && r.Header.Get("If-Unmodified-Since") == "" {
+		return 0
+	}
+	return version
+}
+
+func respondPreconditionFailed(w http.ResponseWriter) {
+	respondWithErrorCode(w, http.StatusPreconditionFailed, "precondition_failed", "The resource has changed since it was read")
+}
+
+// etagListMatches reports whether an If-Match or If-None-Match header
+// value matches any of etags. "*" matches any current representation.
+// Strong comparison, needed for If-Match, never matches a weak tag.
+func etagListMatches(header string, strong bool, etags ...string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if weak, ok := strings.CutPrefix(candidate, "W/"); ok {
+			if strong {
+				continue
+			}
+			candidate = weak
+		}
+		for _, etag := range etags {
+			if candidate == etag {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/auth"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/database"
+)
+
+func TestConditionalChirpReads(t *testing.T) {
+	cfg, mux := newTestAPI(t)
+	ctx := context.Background()
+	if _, err := cfg.DB.CreateChirp(ctx, database.CreateChirpParams{Body: "hello", AuthorID: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(path string, header ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		for i := 0; i < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+
+	w := get("/api/v1/chirps/1")
+	etag, lastModified := w.Header().Get("ETag"), w.Header().Get("Last-Modified")
+	if w.Code != http.StatusOK || etag == "" || lastModified == "" {
+		t.Fatalf("expected validators, got %d %v", w.Code, w.Header())
+	}
+	if got := w.Header().Get("Cache-Control"); got != routeCacheControl["GET /api/v1/chirps/{chirpID}"] {
+		t.Errorf("unexpected Cache-Control %q", got)
+	}
+
+	if w := get("/api/v1/chirps/1", "If-None-Match", `"other", `+etag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("expected 304 for a matching ETag, got %d", w.Code)
+	}
+	if w := get("/api/v1/chirps/1", "If-None-Match", "W/"+etag); w.Code != http.StatusNotModified {
+		t.Errorf("expected If-None-Match to use weak comparison, got %d", w.Code)
+	}
+	if w := get("/api/v1/chirps/1", "If-Modified-Since", lastModified); w.Code != http.StatusNotModified {
+		t.Errorf("expected 304 for an unchanged Last-Modified, got %d", w.Code)
+	}
+	if w := get("/api/v1/chirps/1", "If-None-Match", etag, "Accept", mediaTypeMsgpack); w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Errorf("expected MessagePack to have its own ETag, got %d %q", w.Code, w.Header().Get("ETag"))
+	}
+	if w := get("/api/v1/chirps/1", "If-None-Match", etag, "Authorization", "Bearer x"); !strings.HasPrefix(w.Header().Get("Cache-Control"), "private") {
+		t.Errorf("expected authenticated responses to be private, got %q", w.Header().Get("Cache-Control"))
+	}
+
+	list := get("/api/v1/chirps").Header().Get("ETag")
+	if w := get("/api/v1/chirps", "If-None-Match", list); w.Code != http.StatusNotModified {
+		t.Errorf("expected 304 for an unchanged list, got %d", w.Code)
+	}
+	again, err := cfg.DB.CreateChirp(ctx, database.CreateChirpParams{Body: "again", AuthorID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := get("/api/v1/chirps", "If-None-Match", list); w.Code != http.StatusOK {
+		t.Errorf("expected a new chirp to change the list ETag, got %d", w.Code)
+	}
+
+	// the same chirp posted again after deleting the newest one mustn't
+	// take over its ID or its ETag
+	deleted := get("/api/v1/chirps/2").Header().Get("ETag")
+	if err := cfg.DB.DeleteChirp(ctx, again.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	reposted, err := cfg.DB.CreateChirp(ctx, database.CreateChirpParams{Body: "again", AuthorID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reposted.ID == again.ID {
+		t.Errorf("expected a new ID, got %d again", reposted.ID)
+	}
+	if w := get("/api/v1/chirps/"+strconv.Itoa(reposted.ID), "If-None-Match", deleted); w.Code != http.StatusOK {
+		t.Errorf("expected the deleted chirp's ETag not to match, got %d", w.Code)
+	}
+}
+
+func TestChirpPreconditions(t *testing.T) {
+	cfg, mux := newTestAPI(t)
+	ctx := context.Background()
+	user, err := cfg.DB.CreateUser(ctx, "alice@example.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cfg.DB.CreateChirp(ctx, database.CreateChirpParams{Body: "hello", AuthorID: user.ID}); err != nil {
+		t.Fatal(err)
+	}
+	token, err := auth.MakeJWT(user.ID, cfg.jwtSecret, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	send := func(method, ifMatch string) *httptest.ResponseRecorder {
+		var r *http.Request
+		if method == http.MethodPut {
+			r = httptest.NewRequest(method, "/api/v1/chirps/1", strings.NewReader(`{"body": "edited"}`))
+			r.Header.Set("Content-Type", "application/json")
+		} else {
+			r = httptest.NewRequest(method, "/api/v1/chirps/1", nil)
+		}
+		r.Header.Set("Authorization", "Bearer "+token)
+		r.Header.Set("If-Match", ifMatch)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/chirps/1", nil))
+	original := w.Header().Get("ETag")
+
+	if w := send(http.MethodPut, `"stale"`); w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412 for a stale ETag, got %d", w.Code)
+	}
+	w = send(http.MethodPut, original)
+	edited := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || edited == "" || edited == original {
+		t.Fatalf("expected the edit to succeed with a new ETag, got %d %q", w.Code, edited)
+	}
+	if w := send(http.MethodDelete, original); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("expected deleting from a stale read to fail, got %d", w.Code)
+	}
+	if w := send(http.MethodDelete, "W/"+edited); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("expected If-Match to use strong comparison, got %d", w.Code)
+	}
+	if w := send(http.MethodDelete, edited); w.Code != http.StatusNoContent {
+		t.Errorf("expected delete to succeed, got %d", w.Code)
+	}
+}
+
+func TestChirpPreconditionsConcurrent(t *testing.T) {
+	cfg, mux := newTestAPI(t)
+	ctx := context.Background()
+	user, err := cfg.DB.CreateUser(ctx, "alice@example.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chirp, err := cfg.DB.CreateChirp(ctx, database.CreateChirpParams{Body: "hello", AuthorID: user.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := auth.MakeJWT(user.ID, cfg.jwtSecret, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	etag := entityTag(chirp.Version(), mediaTypeJSON)
+
+	// every writer read the same version, so only one of them may write;
+	// slow reads keep them all past the If-Match check before any write
+	cfg.DB.SetObserver(func(op string, d time.Duration, err error) {
+		if op == "load" {
+			time.Sleep(5 * time.Millisecond)
+		}
+	})
+	const writers = 20
+	codes := make(chan int, writers)
+	var wg sync.WaitGroup
+	for i := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := httptest.NewRequest(http.MethodPut, "/api/v1/chirps/1", strings.NewReader(`{"body":"edit `+strconv.Itoa(i)+`"}`))
+			r.Header.Set("Content-Type", "application/json")
+			r.Header.Set("Authorization", "Bearer "+token)
+			r.Header.Set("If-Match", etag)
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+			codes <- w.Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	counts := map[int]int{}
+	for code := range codes {
+		counts[code]++
+	}
+	if counts[http.StatusOK] != 1 || counts[http.StatusPreconditionFailed] != writers-1 {
+		t.Errorf("expected one edit and %d 412s, got %v", writers-1, counts)
+	}
+	if revisions, err := cfg.DB.GetChirpRevisions(ctx, chirp.ID); err != nil || len(revisions) != 1 {
+		t.Errorf("expected exactly one revision, got %+v %v", revisions, err)
+	}
+
+	if err := cfg.DB.DeleteChirp(ctx, chirp.ID, chirp.Version()); !errors.Is(err, database.ErrVersionMismatch) {
+		t.Errorf("expected deleting a stale version to fail, got %v", err)
+	}
+}
@@ -0,0 +1,466 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/auth"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/database"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/dataloader"
+	"github.com/graph-gophers/graphql-go"
+	gqlotel "github.com/graph-gophers/graphql-go/trace/otel"
+)
+
+const (
+	graphQLMaxDepth       = 8
+	graphQLMaxQueryLength = 8 << 10
+	graphQLMaxParallelism = 10
+	// graphQLMaxComplexity caps how many users and chirps one query can
+	// resolve. Depth alone doesn't bound the work, since lists multiply.
+	graphQLMaxComplexity = 500
+	graphQLMaxListLimit  = 50
+	// graphQLBatchWait is how long loaders collect keys before reading
+	// the database. Sibling fields resolve in parallel well within it.
+	graphQLBatchWait = time.Millisecond
+)
+
+var errQueryTooComplex = fmt.Errorf("query resolves more than %d users and chirps", graphQLMaxComplexity)
+
+//go:embed schema.graphql
+var graphQLSchemaSDL string
+
+// graphQLSchema is the schema served at /api/v1/graphql. Resolvers get
+// the request's viewer and loaders from the context; see graphQLRequest.
+var graphQLSchema = graphql.MustParseSchema(graphQLSchemaSDL, &queryResolver{},
+	graphql.MaxDepth(graphQLMaxDepth),
+	graphql.MaxQueryLength(graphQLMaxQueryLength),
+	graphql.MaxParallelism(graphQLMaxParallelism),
+	graphql.Tracer(gqlotel.DefaultTracer()),
+)
+
+// graphQLRequest is the per-request state resolvers share. Its loaders
+// batch the lookups made while resolving a list, so a chirp's author or
+// reply parent costs one database read per level rather than one per
+// chirp.
+type graphQLRequest struct {
+	cfg        *apiConfig
+	viewerID   int
+	visibility database.Visibility
+	cost       atomic.Int64
+
+	users        *dataloader.Loader[int, database.User]
+	chirps       *dataloader.Loader[int, database.Chirp]
+	authorChirps *dataloader.Loader[int, []database.Chirp]
+	media        *dataloader.Loader[int, database.Media]
+}
+
+type graphQLRequestKey struct{}
+
+func graphQLRequestFrom(ctx context.Context) *graphQLRequest {
+	return ctx.Value(graphQLRequestKey{}).(*graphQLRequest)
+}
+
+// charge counts n more users or chirps towards graphQLMaxComplexity.
+func (req *graphQLRequest) charge(n int) error {
+	if req.cost.Add(int64(n)) > graphQLMaxComplexity {
+		return errQueryTooComplex
+	}
+	return nil
+}
+
+// handlerGraphQL runs a GraphQL query. It is authenticated like the REST
+// routes: a valid bearer token makes the query as that user, with their
+// blocks and mutes applied, and no token makes it anonymously.
+func (cfg *apiConfig) handlerGraphQL(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Query         string         `json:"query"`
+		OperationName string         `json:"operationName"`
+		Variables     map[string]any `json:"variables"`
+		Extensions    map[string]any `json:"extensions"`
+	}
+
+	viewerID := 0
+	if _, err := auth.GetBearerToken(r.Header); err == nil {
+		viewerID, err = cfg.userIDFromRequest(r)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT")
+			return
+		}
+	}
+
+	params := parameters{}
+	if !decodeJSON(w, r, &params) {
+		return
+	}
+	v := validator{}
+	v.check(params.Query != "", "query", "required", "is required")
+	if !v.valid() {
+		respondWithValidationErrors(w, v.errs)
+		return
+	}
+
+	visibility, err := cfg.DB.GetVisibility(r.Context(), viewerID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't run query")
+		return
+	}
+	req := &graphQLRequest{
+		cfg:          cfg,
+		viewerID:     viewerID,
+		visibility:   visibility,
+		users:        dataloader.New(cfg.DB.GetUsers, graphQLBatchWait),
+		chirps:       dataloader.New(cfg.DB.GetChirpsByID, graphQLBatchWait),
+		authorChirps: dataloader.New(cfg.DB.GetChirpsByAuthor, graphQLBatchWait),
+		media:        dataloader.New(cfg.DB.GetMediaByID, graphQLBatchWait),
+	}
+	ctx := context.WithValue(r.Context(), graphQLRequestKey{}, req)
+
+	// like most GraphQL servers, query errors are reported in the body of
+	// a 200 alongside whatever data could be resolved
+	resp := graphQLSchema.Exec(ctx, params.Query, params.OperationName, params.Variables)
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+type queryResolver struct{}
+
+func (queryResolver) Me(ctx context.Context) (*userResolver, error) {
+	req := graphQLRequestFrom(ctx)
+	if req.viewerID == 0 {
+		return nil, nil
+	}
+	return req.loadUser(ctx, req.viewerID)
+}
+
+func (queryResolver) User(ctx context.Context, args struct {
+	ID     *graphql.ID
+	Handle *string
+}) (*userResolver, error) {
+	req := graphQLRequestFrom(ctx)
+	switch {
+	case args.ID != nil && args.Handle == nil:
+		id, err := parseGraphQLID(*args.ID)
+		if err != nil {
+			return nil, err
+		}
+		return req.loadUser(ctx, id)
+	case args.Handle != nil && args.ID == nil:
+		user, err := req.cfg.DB.GetUserByHandle(ctx, *args.Handle)
+		if errors.Is(err, database.ErrNotExist) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return req.newUser(user)
+	default:
+		return nil, errors.New("exactly one of id and handle is required")
+	}
+}
+
+func (queryResolver) Chirp(ctx context.Context, args struct{ ID graphql.ID }) (*chirpResolver, error) {
+	id, err := parseGraphQLID(args.ID)
+	if err != nil {
+		return nil, err
+	}
+	return graphQLRequestFrom(ctx).loadChirp(ctx, id)
+}
+
+func (queryResolver) Chirps(ctx context.Context, args struct {
+	AuthorID *graphql.ID
+	Before   *graphql.ID
+	Limit    int32
+}) ([]*chirpResolver, error) {
+	req := graphQLRequestFrom(ctx)
+	var dbChirps []database.Chirp
+	if args.AuthorID != nil {
+		authorID, err := parseGraphQLID(*args.AuthorID)
+		if err != nil {
+			return nil, err
+		}
+		if dbChirps, err = req.authorChirps.Load(ctx, authorID); err != nil {
+			return nil, err
+		}
+	} else {
+		all, err := req.cfg.DB.GetChirps(ctx)
+		if err != nil {
+			return nil, err
+		}
+		sort.Slice(all, func(i, j int) bool {
+			return all[i].ID > all[j].ID
+		})
+		dbChirps = all
+	}
+	return req.page(dbChirps, args.Before, args.Limit, req.visibility.ShowChirpInFeed)
+}
+
+// page returns up to limit of the chirps, which are newest first, that
+// come after the chirp with ID before and pass show.
+func (req *graphQLRequest) page(dbChirps []database.Chirp, before *graphql.ID, limit int32, show func(database.Chirp) bool) ([]*chirpResolver, error) {
+	if limit < 0 || limit > graphQLMaxListLimit {
+		return nil, fmt.Errorf("limit must be between 0 and %d", graphQLMaxListLimit)
+	}
+	beforeID := 0
+	if before != nil {
+		var err error
+		if beforeID, err = parseGraphQLID(*before); err != nil {
+			return nil, err
+		}
+	}
+
+	chirps := []*chirpResolver{}
+	for _, dbChirp := range dbChirps {
+		if len(chirps) == int(limit) {
+			break
+		}
+		if beforeID != 0 && dbChirp.ID >= beforeID || !show(dbChirp) {
+			continue
+		}
+		chirp, err := req.newChirp(dbChirp)
+		if err != nil {
+			return nil, err
+		}
+		chirps = append(chirps, chirp)
+	}
+	return chirps, nil
+}
+
+func parseGraphQLID(id graphql.ID) (int, error) {
+	n, err := strconv.Atoi(string(id))
+	if err != nil {
+		return 0, fmt.Errorf("invalid ID %q", id)
+	}
+	return n, nil
+}
+
+// loadUser returns the user with id, or nil if they don't exist or are
+// hidden from the viewer by a block.
+func (req *graphQLRequest) loadUser(ctx context.Context, id int) (*userResolver, error) {
+	user, err := req.users.Load(ctx, id)
+	if errors.Is(err, dataloader.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return req.newUser(user)
+}
+
+func (req *graphQLRequest) newUser(user database.User) (*userResolver, error) {
+	if !req.visibility.CanSee(user.ID) {
+		return nil, nil
+	}
+	if err := req.charge(1); err != nil {
+		return nil, err
+	}
+	return &userResolver{req: req, user: user, profile: req.cfg.newProfile(user)}, nil
+}
+
+// loadChirp returns the chirp with id, or nil if it doesn't exist or the
+// viewer can't see it.
+func (req *graphQLRequest) loadChirp(ctx context.Context, id int) (*chirpResolver, error) {
+	chirp, err := req.chirps.Load(ctx, id)
+	if errors.Is(err, dataloader.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !req.visibility.CanSeeChirp(chirp) {
+		return nil, nil
+	}
+	return req.newChirp(chirp)
+}
+
+func (req *graphQLRequest) newChirp(chirp database.Chirp) (*chirpResolver, error) {
+	if err := req.charge(1); err != nil {
+		return nil, err
+	}
+	return &chirpResolver{req: req, chirp: chirp}, nil
+}
+
+type userResolver struct {
+	req     *graphQLRequest
+	user    database.User
+	profile Profile
+}
+
+func (u *userResolver) ID() graphql.ID {
+	return graphql.ID(strconv.Itoa(u.profile.ID))
+}
+
+func (u *userResolver) Handle() string      { return u.profile.Handle }
+func (u *userResolver) DisplayName() string { return u.profile.DisplayName }
+func (u *userResolver) Bio() string         { return u.profile.Bio }
+func (u *userResolver) IsChirpyRed() bool   { return u.profile.IsChirpyRed }
+
+func (u *userResolver) AvatarURL() *string {
+	if u.profile.AvatarURL == "" {
+		return nil
+	}
+	return &u.profile.AvatarURL
+}
+
+func (u *userResolver) Chirps(ctx context.Context, args struct {
+	Before *graphql.ID
+	Limit  int32
+}) ([]*chirpResolver, error) {
+	dbChirps, err := u.req.authorChirps.Load(ctx, u.user.ID)
+	if err != nil {
+		return nil, err
+	}
+	// like a profile page, chirps by someone the viewer muted still show
+	return u.req.page(dbChirps, args.Before, args.Limit, u.req.visibility.CanSeeChirp)
+}
+
+func (u *userResolver) Blocks(ctx context.Context) (*[]*userResolver, error) {
+	return u.relations(ctx, u.req.cfg.DB.GetBlockedUsers)
+}
+
+func (u *userResolver) Mutes(ctx context.Context) (*[]*userResolver, error) {
+	return u.relations(ctx, u.req.cfg.DB.GetMutedUsers)
+}
+
+// relations resolves the viewer's block or mute list, newest first. They
+// are private, so they are null for anyone else.
+func (u *userResolver) relations(ctx context.Context, list func(context.Context, int) ([]database.Relation, error)) (*[]*userResolver, error) {
+	if u.user.ID != u.req.viewerID {
+		return nil, nil
+	}
+	relations, err := list(ctx, u.user.ID)
+	if err != nil {
+		return nil, err
+	}
+	users := []*userResolver{}
+	for _, rel := range relations {
+		user, err := u.req.users.Load(ctx, rel.UserID)
+		if errors.Is(err, dataloader.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		// a block hides the blocked user from the viewer, but they still
+		// need to see who they blocked
+		if err := u.req.charge(1); err != nil {
+			return nil, err
+		}
+		users = append(users, &userResolver{req: u.req, user: user, profile: u.req.cfg.newProfile(user)})
+	}
+	return &users, nil
+}
+
+type chirpResolver struct {
+	req   *graphQLRequest
+	chirp database.Chirp
+}
+
+func (c *chirpResolver) ID() graphql.ID {
+	return graphql.ID(strconv.Itoa(c.chirp.ID))
+}
+
+func (c *chirpResolver) Body() string    { return c.chirp.Body }
+func (c *chirpResolver) Revision() int32 { return int32(c.chirp.Revision) }
+func (c *chirpResolver) Hidden() bool    { return c.chirp.Hidden }
+
+func (c *chirpResolver) CreatedAt() graphql.Time {
+	return graphql.Time{Time: c.chirp.CreatedAt}
+}
+
+func (c *chirpResolver) EditedAt() *graphql.Time {
+	if c.chirp.EditedAt == nil {
+		return nil
+	}
+	return &graphql.Time{Time: *c.chirp.EditedAt}
+}
+
+func (c *chirpResolver) Author(ctx context.Context) (*userResolver, error) {
+	if c.chirp.AuthorID == 0 {
+		return nil, nil
+	}
+	return c.req.loadUser(ctx, c.chirp.AuthorID)
+}
+
+func (c *chirpResolver) InReplyTo(ctx context.Context) (*chirpResolver, error) {
+	if c.chirp.InReplyTo == 0 {
+		return nil, nil
+	}
+	return c.req.loadChirp(ctx, c.chirp.InReplyTo)
+}
+
+func (c *chirpResolver) Media(ctx context.Context) ([]*mediaResolver, error) {
+	media := []*mediaResolver{}
+	for _, id := range c.chirp.MediaIDs {
+		m, err := c.req.media.Load(ctx, id)
+		if errors.Is(err, dataloader.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		media = append(media, &mediaResolver{newMedia(m)})
+	}
+	return media, nil
+}
+
+func (c *chirpResolver) Mentions() []*mentionResolver {
+	mentions := []*mentionResolver{}
+	for _, m := range c.chirp.Mentions {
+		mentions = append(mentions, &mentionResolver{req: c.req, mention: m})
+	}
+	return mentions
+}
+
+func (c *chirpResolver) Hashtags() []*hashtagResolver {
+	hashtags := []*hashtagResolver{}
+	for _, h := range c.chirp.Hashtags {
+		hashtags = append(hashtags, &hashtagResolver{h})
+	}
+	return hashtags
+}
+
+type mediaResolver struct {
+	media Media
+}
+
+func (m *mediaResolver) ID() graphql.ID {
+	return graphql.ID(strconv.Itoa(m.media.ID))
+}
+
+func (m *mediaResolver) ContentType() string { return m.media.ContentType }
+func (m *mediaResolver) Size() int32         { return int32(m.media.Size) }
+func (m *mediaResolver) URL() string         { return m.media.URL }
+
+func (m *mediaResolver) ThumbnailURL() *string {
+	if m.media.ThumbnailURL == "" {
+		return nil
+	}
+	return &m.media.ThumbnailURL
+}
+
+type mentionResolver struct {
+	req     *graphQLRequest
+	mention database.Mention
+}
+
+func (m *mentionResolver) Text() string { return m.mention.Text }
+func (m *mentionResolver) Start() int32 { return int32(m.mention.Start) }
+func (m *mentionResolver) End() int32   { return int32(m.mention.End) }
+
+func (m *mentionResolver) User(ctx context.Context) (*userResolver, error) {
+	return m.req.loadUser(ctx, m.mention.UserID)
+}
+
+type hashtagResolver struct {
+	hashtag database.Hashtag
+}
+
+func (h *hashtagResolver) Tag() string  { return h.hashtag.Tag }
+func (h *hashtagResolver) Start() int32 { return int32(h.hashtag.Start) }
+func (h *hashtagResolver) End() int32   { return int32(h.hashtag.End) }
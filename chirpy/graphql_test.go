@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/auth"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/database"
+)
+
+type graphQLResult struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func TestGraphQL(t *testing.T) {
+	cfg, mux := newTestAPI(t)
+	ctx := context.Background()
+
+	var tokens []string
+	for i := 1; i <= 3; i++ {
+		user, err := cfg.DB.CreateUser(ctx, fmt.Sprintf("user%d@example.com", i), "hash")
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := auth.MakeJWT(user.ID, cfg.jwtSecret, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens = append(tokens, token)
+		for j := 0; j < 2; j++ {
+			if _, err := cfg.DB.CreateChirp(ctx, database.CreateChirpParams{Body: fmt.Sprintf("chirp %d by %d", j, i), AuthorID: user.ID}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := cfg.DB.BlockUser(ctx, 1, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	var loads atomic.Int32
+	cfg.DB.SetObserver(func(op string, d time.Duration, err error) {
+		if op == "load" {
+			loads.Add(1)
+		}
+	})
+
+	query := func(token, query string) (*httptest.ResponseRecorder, graphQLResult) {
+		t.Helper()
+		dat, _ := json.Marshal(map[string]string{"query": query})
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/graphql", strings.NewReader(string(dat)))
+		r.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		var res graphQLResult
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return w, res
+	}
+
+	loads.Store(0)
+	_, res := query("", `{ chirps { id author { id chirps(limit: 1) { body } } inReplyTo { id } } }`)
+	if len(res.Errors) != 0 {
+		t.Fatalf("unexpected errors %+v", res.Errors)
+	}
+	var feed struct {
+		Chirps []struct {
+			Author struct {
+				ID     string
+				Chirps []struct{ Body string }
+			}
+		}
+	}
+	if err := json.Unmarshal(res.Data, &feed); err != nil {
+		t.Fatal(err)
+	}
+	if len(feed.Chirps) != 6 || feed.Chirps[0].Author.ID != "3" || feed.Chirps[0].Author.Chirps[0].Body != "chirp 1 by 3" {
+		t.Fatalf("unexpected feed %s", res.Data)
+	}
+	// the feed, then one batch each for authors, their chirps and replies
+	if n := loads.Load(); n > 4 {
+		t.Errorf("expected lookups to be batched, got %d database loads", n)
+	}
+
+	_, res = query(tokens[0], `{ me { id blocks { id } } chirps { author { id } } user(id: 2) { id } }`)
+	var viewer struct {
+		Me struct {
+			Blocks []struct{ ID string }
+		}
+		Chirps []struct{ Author struct{ ID string } }
+		User   *struct{ ID string }
+	}
+	if err := json.Unmarshal(res.Data, &viewer); err != nil {
+		t.Fatal(err)
+	}
+	if len(viewer.Me.Blocks) != 1 || viewer.Me.Blocks[0].ID != "2" || viewer.User != nil {
+		t.Errorf("expected the blocked user to be listed but hidden, got %s", res.Data)
+	}
+	for _, chirp := range viewer.Chirps {
+		if chirp.Author.ID == "2" {
+			t.Errorf("expected the blocked user's chirps to be left out, got %s", res.Data)
+		}
+	}
+
+	_, res = query("", `{ user(id: 1) { blocks { id } } }`)
+	if string(res.Data) != `{"user":{"blocks":null}}` {
+		t.Errorf("expected blocks to be private, got %s", res.Data)
+	}
+
+	for name, q := range map[string]string{
+		"too deep":   `{ chirps { inReplyTo { inReplyTo { inReplyTo { inReplyTo { inReplyTo { inReplyTo { inReplyTo { id } } } } } } } } }`,
+		"over limit": `{ chirps(limit: 51) { id } }`,
+	} {
+		if w, res := query("", q); w.Code != http.StatusOK || len(res.Errors) == 0 {
+			t.Errorf("%s: expected a query error, got %d %s", name, w.Code, w.Body)
+		}
+	}
+
+	// aliases repeat a list without making the query any deeper
+	var aliases strings.Builder
+	for i := 0; i < 50; i++ {
+		fmt.Fprintf(&aliases, "c%d: chirps { author { id } } ", i)
+	}
+	if _, res := query("", "{ "+aliases.String()+"}"); len(res.Errors) == 0 || res.Errors[0].Message != errQueryTooComplex.Error() {
+		t.Errorf("expected the complexity limit to stop the query, got %+v", res.Errors)
+	}
+
+	if w, _ := query("not-a-token", `{ me { id } }`); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a bad token, got %d", w.Code)
+	}
+	if w, _ := query("", ""); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422 for a missing query, got %d", w.Code)
+	}
+}
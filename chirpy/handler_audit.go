@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/database"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// audit records a security-relevant event in the audit log. The event
+// has already happened by the time it is recorded, so a failure to
+// record it is logged rather than failing the request.
+func (cfg *apiConfig) audit(r *http.Request, event database.AuditEvent, actorID, userID int, details map[string]string) {
+	_, err := cfg.DB.AppendAudit(r.Context(), database.AuditEntry{
+		Event:   event,
+		ActorID: actorID,
+		UserID:  userID,
+		IP:      clientIP(r, cfg.settings.Load().trustedProxies),
+		Details: details,
+	})
+	if err != nil {
+		slog.Error("Couldn't write audit log entry", "event", event, "user_id", userID, "error", err)
+	}
+}
+
+// handlerAuditLog lists audit log entries, newest first, optionally
+// filtered by user_id, event (or an event prefix such as "auth."), since
+// and until.
+func (cfg *apiConfig) handlerAuditLog(w http.ResponseWriter, r *http.Request) {
+	_, err := cfg.moderatorFromRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	query := r.URL.Query()
+	filter := database.AuditFilter{
+		Event: database.AuditEvent(query.Get("event")),
+		Limit: defaultAuditLimit,
+	}
+	if s := query.Get("user_id"); s != "" {
+		filter.UserID, err = strconv.Atoi(s)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid user_id")
+			return
+		}
+	}
+	for _, t := range []struct {
+		name string
+		dst  *time.Time
+	}{
+		{"since", &filter.Since},
+		{"until", &filter.Until},
+	} {
+		if s := query.Get(t.name); s != "" {
+			*t.dst, err = time.Parse(time.RFC3339, s)
+			if err != nil {
+				respondWithError(w, http.StatusBadRequest, "Invalid "+t.name+": must be an RFC 3339 time")
+				return
+			}
+		}
+	}
+	if s := query.Get("limit"); s != "" {
+		filter.Limit, err = strconv.Atoi(s)
+		if err != nil || filter.Limit < 1 || filter.Limit > maxAuditLimit {
+			respondWithError(w, http.StatusBadRequest, "Invalid limit: must be between 1 and "+strconv.Itoa(maxAuditLimit))
+			return
+		}
+	}
+
+	entries, err := cfg.DB.GetAuditLog(r.Context(), filter)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve audit log")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, entries)
+}
+
+// AuditVerification is the result of checking the audit log's hash
+// chain.
+type AuditVerification struct {
+	Valid bool `json:"valid"`
+	// Entries is how many entries were checked before the chain broke, or
+	// all of them if it didn't.
+	Entries int    `json:"entries"`
+	Head    string `json:"head"`
+	Error   string `json:"error,omitempty"`
+}
+
+func (cfg *apiConfig) handlerAuditVerify(w http.ResponseWriter, r *http.Request) {
+	_, err := cfg.moderatorFromRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	entries, head, err := cfg.DB.VerifyAuditLog(r.Context())
+	if err != nil && !errors.Is(err, database.ErrAuditTampered) {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't verify audit log")
+		return
+	}
+
+	verification := AuditVerification{Valid: err == nil, Entries: entries, Head: head}
+	if err != nil {
+		verification.Error = err.Error()
+	}
+	respondWithJSON(w, http.StatusOK, verification)
+}
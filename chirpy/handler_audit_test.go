@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/database"
+)
+
+func TestAuditLog(t *testing.T) {
+	cfg, mux := newTestAPI(t)
+	cfg.settings.Load().moderatorEmails["mod@example.com"] = struct{}{}
+
+	send := func(authorization, method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		if body != "" {
+			r.Header.Set("Content-Type", "application/json")
+		}
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+	login := func(email string) (token, refreshToken string) {
+		t.Helper()
+		w := send("", http.MethodPost, "/api/v1/login", `{"email":"`+email+`","password":"hunter22"}`)
+		var res struct {
+			Token        string `json:"token"`
+			RefreshToken string `json:"refresh_token"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("couldn't log in as %s: %d %s", email, w.Code, w.Body)
+		}
+		return res.Token, res.RefreshToken
+	}
+
+	for _, email := range []string{"mod@example.com", "alice@example.com"} {
+		if w := send("", http.MethodPost, "/api/v1/users", `{"email":"`+email+`","password":"hunter22"}`); w.Code != http.StatusCreated {
+			t.Fatalf("couldn't create %s: %d %s", email, w.Code, w.Body)
+		}
+	}
+	modToken, _ := login("mod@example.com")
+	send("", http.MethodPost, "/api/v1/login", `{"email":"alice@example.com","password":"wrong"}`)
+	send("", http.MethodPost, "/api/v1/login", `{"email":"nobody@example.com","password":"wrong"}`)
+	token, refreshToken := login("alice@example.com")
+	send("Bearer "+token, http.MethodPut, "/api/v1/users", `{"email":"alice@example.org","password":"hunter22"}`)
+	send("Bearer "+token, http.MethodPut, "/api/v1/users", `{"email":"alice@example.org","password":"hunter23"}`)
+	send("Bearer "+refreshToken, http.MethodPost, "/api/v1/revoke", "")
+	send("ApiKey "+cfg.polkaSecret, http.MethodPost, "/api/v1/polka/webhooks", `{"event":"user.upgraded","data":{"user_id":2}}`)
+
+	query := func(params string) []database.AuditEntry {
+		t.Helper()
+		w := send("Bearer "+modToken, http.MethodGet, "/admin/audit"+params, "")
+		var entries []database.AuditEntry
+		if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil {
+			t.Fatalf("%v: %d %s", err, w.Code, w.Body)
+		}
+		return entries
+	}
+
+	var events []database.AuditEvent
+	for _, entry := range query("?user_id=2") {
+		events = append(events, entry.Event)
+	}
+	want := []database.AuditEvent{
+		database.AuditAccountUpgraded,
+		database.AuditTokenRevoked,
+		database.AuditPasswordChanged,
+		database.AuditEmailChanged,
+		database.AuditLogin,
+		database.AuditLoginFailed,
+		database.AuditAccountCreated,
+	}
+	if len(events) != len(want) {
+		t.Fatalf("expected %v, got %v", want, events)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, events)
+		}
+	}
+
+	changes := query("?event=account.email_changed")
+	if len(changes) != 1 || changes[0].Details["to"] != "alice@example.org" || changes[0].IP == "" {
+		t.Errorf("expected the email change with its details, got %+v", changes)
+	}
+	failed := query("?event=auth.login_failed")
+	if len(failed) != 2 || failed[0].Details["reason"] != "unknown_email" || failed[0].Details["email"] != "" {
+		t.Errorf("expected the unknown email's failed login without the email, got %+v", failed)
+	}
+	if entries := query("?event=auth.&user_id=1"); len(entries) != 1 || entries[0].Event != database.AuditLogin {
+		t.Errorf("expected the moderator's login, got %+v", entries)
+	}
+	if entries := query("?until=" + time.Now().Add(-time.Hour).Format(time.RFC3339)); len(entries) != 0 {
+		t.Errorf("expected nothing before the test started, got %+v", entries)
+	}
+	if entries := query("?limit=2"); len(entries) != 2 || entries[0].Event != database.AuditAccountUpgraded {
+		t.Errorf("expected the two newest entries, got %+v", entries)
+	}
+
+	if w := send("Bearer "+token, http.MethodGet, "/admin/audit", ""); w.Code != http.StatusForbidden {
+		t.Errorf("expected the audit log to be for moderators only, got %d", w.Code)
+	}
+	if w := send("Bearer "+modToken, http.MethodGet, "/admin/audit?since=yesterday", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a bad time, got %d", w.Code)
+	}
+
+	var verification AuditVerification
+	if err := json.Unmarshal(send("Bearer "+modToken, http.MethodGet, "/admin/audit/verify", "").Body.Bytes(), &verification); err != nil {
+		t.Fatal(err)
+	}
+	if !verification.Valid || verification.Entries != 10 || verification.Head == "" {
+		t.Errorf("expected an intact chain, got %+v", verification)
+	}
+}
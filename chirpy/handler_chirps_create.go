@@ -1,24 +1,93 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/auth"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/database"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/entities"
+)
+
+const maxChirpMedia = 4
+
+var (
+	errUnknownAuthor    = errors.New("author does not exist")
+	errAccountSuspended = errors.New("account is suspended")
+	errChirpTooLong     = errors.New("chirp is too long")
+	errReplyBlocked     = errors.New("can't reply to this user")
 )
 
 type Chirp struct {
-	ID       int    `json:"id"`
-	Body     string `json:"body"`
-	AuthorID int    `json:"author_id"`
+	ID        int        `json:"id"`
+	Body      string     `json:"body"`
+	AuthorID  int        `json:"author_id"`
+	Media     []Media    `json:"media"`
+	CreatedAt time.Time  `json:"created_at"`
+	EditedAt  *time.Time `json:"edited_at"`
+	Revision  int        `json:"revision"`
+	InReplyTo int        `json:"in_reply_to,omitempty"`
+	Mentions  []Mention  `json:"mentions"`
+	Hashtags  []Hashtag  `json:"hashtags"`
+	Hidden    bool       `json:"hidden,omitempty"`
+}
+
+type Mention struct {
+	UserID int    `json:"user_id"`
+	Text   string `json:"text"`
+	Start  int    `json:"start"`
+	End    int    `json:"end"`
+}
+
+type Hashtag struct {
+	Tag   string `json:"tag"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+// newChirp converts a database chirp into its API representation,
+// resolving attached media IDs into URLs.
+func (cfg *apiConfig) newChirp(ctx context.Context, dbChirp database.Chirp) Chirp {
+	chirp := Chirp{
+		ID:        dbChirp.ID,
+		Body:      dbChirp.Body,
+		AuthorID:  dbChirp.AuthorID,
+		Media:     []Media{},
+		CreatedAt: dbChirp.CreatedAt,
+		EditedAt:  dbChirp.EditedAt,
+		Revision:  dbChirp.Revision,
+		InReplyTo: dbChirp.InReplyTo,
+		Hidden:    dbChirp.Hidden,
+		Mentions:  []Mention{},
+		Hashtags:  []Hashtag{},
+	}
+	for _, m := range dbChirp.Mentions {
+		chirp.Mentions = append(chirp.Mentions, Mention(m))
+	}
+	for _, h := range dbChirp.Hashtags {
+		chirp.Hashtags = append(chirp.Hashtags, Hashtag(h))
+	}
+	for _, id := range dbChirp.MediaIDs {
+		dbMedia, err := cfg.DB.GetMedia(ctx, id)
+		if err != nil {
+			continue
+		}
+		chirp.Media = append(chirp.Media, newMedia(dbMedia))
+	}
+	return chirp
 }
 
 func (cfg *apiConfig) handlerChirpsCreate(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
-		Body string `json:"body"`
+		Body      string `json:"body"`
+		MediaIDs  []int  `json:"media_ids"`
+		InReplyTo int    `json:"in_reply_to"`
 	}
 
 	authToken, err := auth.GetBearerToken(r.Header)
@@ -33,42 +102,118 @@ func (cfg *apiConfig) handlerChirpsCreate(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
-	err = decoder.Decode(&params)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters")
+	if !decodeJSON(w, r, &params) {
 		return
 	}
 
-	cleaned, err := validateChirp(params.Body)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, err.Error())
+	maxLength := cfg.settings.Load().chirpMaxLength
+	v := validator{}
+	cleaned, err := validateChirp(params.Body, maxLength)
+	v.check(err == nil, "body", "too_long", fmt.Sprintf("must be at most %d characters", maxLength))
+	v.check(len(params.MediaIDs) <= maxChirpMedia, "media_ids", "too_many", fmt.Sprintf("must have at most %d items", maxChirpMedia))
+	if !v.valid() {
+		respondWithValidationErrors(w, v.errs)
 		return
 	}
 
 	authorID, err := strconv.Atoi(authorIDStr)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "invalid userID in JWT subject")
+		respondWithError(w, http.StatusUnauthorized, "invalid userID in JWT subject")
 		return
 	}
 
-	chirp, err := cfg.DB.CreateChirp(cleaned, authorID)
+	err = cfg.checkAuthor(r.Context(), authorID, params.InReplyTo)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't create chirp")
+		respondWithChirpError(w, err, "Couldn't create chirp")
 		return
 	}
 
-	respondWithJSON(w, http.StatusCreated, Chirp{
-		ID:       chirp.ID,
-		Body:     chirp.Body,
-		AuthorID: chirp.AuthorID,
+	mentions, hashtags := cfg.parseEntities(r.Context(), cleaned)
+	chirp, err := cfg.DB.CreateChirp(r.Context(), database.CreateChirpParams{
+		Body:      cleaned,
+		AuthorID:  authorID,
+		MediaIDs:  params.MediaIDs,
+		InReplyTo: params.InReplyTo,
+		Mentions:  mentions,
+		Hashtags:  hashtags,
 	})
+	if err != nil {
+		if errors.Is(err, database.ErrInvalidMedia) {
+			respondWithValidationErrors(w, []fieldError{{Field: "media_ids", Code: "invalid", Message: "must be media you uploaded"}})
+			return
+		}
+		if errors.Is(err, database.ErrNotExist) {
+			respondWithValidationErrors(w, []fieldError{{Field: "in_reply_to", Code: "not_found", Message: "is not an existing chirp"}})
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create chirp")
+		return
+	}
+
+	cfg.notifyNewChirp(r.Context(), chirp)
+
+	w.Header().Set("ETag", entityTag(chirp.Version(), mediaTypeJSON))
+	respondWithJSON(w, http.StatusCreated, cfg.newChirp(r.Context(), chirp))
+}
+
+// checkAuthor reports whether userID may post a chirp replying to
+// inReplyTo, which may be 0 for a chirp that isn't a reply.
+func (cfg *apiConfig) checkAuthor(ctx context.Context, userID, inReplyTo int) error {
+	author, err := cfg.DB.GetUser(ctx, userID)
+	if errors.Is(err, database.ErrNotExist) {
+		return errUnknownAuthor
+	}
+	if err != nil {
+		return err
+	}
+	if author.IsSuspended() {
+		return errAccountSuspended
+	}
+	if inReplyTo == 0 {
+		return nil
+	}
+
+	parent, err := cfg.DB.GetChirp(ctx, inReplyTo)
+	if errors.Is(err, database.ErrNotExist) {
+		return database.ErrReplyNotExist
+	}
+	if err != nil {
+		return err
+	}
+	blocked, err := cfg.DB.IsBlocked(ctx, userID, parent.AuthorID)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return errReplyBlocked
+	}
+	return nil
 }
 
-func validateChirp(body string) (string, error) {
-	const maxChirpLength = 140
-	if len(body) > maxChirpLength {
+// respondWithChirpError responds to an error from checkAuthor or from
+// storing a chirp, falling back to a 500 with msg.
+func respondWithChirpError(w http.ResponseWriter, err error, msg string) {
+	switch {
+	case errors.Is(err, errUnknownAuthor):
+		respondWithError(w, http.StatusUnauthorized, "Couldn't get user")
+	case errors.Is(err, errAccountSuspended):
+		respondWithErrorCode(w, http.StatusForbidden, "account_suspended", "Account is suspended")
+	case errors.Is(err, errReplyBlocked):
+		respondWithError(w, http.StatusForbidden, "You can't reply to this user")
+	case errors.Is(err, errChirpTooLong):
+		respondWithValidationErrors(w, []fieldError{{Field: "body", Code: "too_long", Message: "is longer than chirps may now be"}})
+	case errors.Is(err, database.ErrInvalidMedia):
+		respondWithValidationErrors(w, []fieldError{{Field: "media_ids", Code: "invalid", Message: "must be media you uploaded"}})
+	case errors.Is(err, database.ErrReplyNotExist):
+		respondWithValidationErrors(w, []fieldError{{Field: "in_reply_to", Code: "not_found", Message: "is not an existing chirp"}})
+	default:
+		respondWithError(w, http.StatusInternalServerError, msg)
+	}
+}
+
+func validateChirp(body string, maxLength int) (string, error) {
+	if len(body) > maxLength {
 		return "", errors.New("Chirp is too long")
 	}
 
@@ -92,3 +237,85 @@ func getCleanedBody(body string, badWords map[string]struct{}) string {
 	cleaned := strings.Join(words, " ")
 	return cleaned
 }
+
+// parseEntities extracts mentions and hashtags from a cleaned chirp body.
+// Mentions are matched against user handles and then emails; ones that
+// don't resolve to a user are left as plain text.
+func (cfg *apiConfig) parseEntities(ctx context.Context, body string) ([]database.Mention, []database.Hashtag) {
+	rawMentions, rawHashtags := entities.Parse(body)
+
+	mentions := []database.Mention{}
+	for _, m := range rawMentions {
+		user, err := cfg.DB.GetUserByHandle(ctx, m.Text)
+		if err != nil {
+			user, err = cfg.DB.GetUserByEmail(ctx, m.Text)
+		}
+		if err != nil {
+			continue
+		}
+		mentions = append(mentions, database.Mention{
+			UserID: user.ID,
+			Text:   m.Text,
+			Start:  m.Start,
+			End:    m.End,
+		})
+	}
+
+	hashtags := []database.Hashtag{}
+	for _, h := range rawHashtags {
+		hashtags = append(hashtags, database.Hashtag{
+			Tag:   entities.NormalizeTag(h.Text),
+			Start: h.Start,
+			End:   h.End,
+		})
+	}
+
+	return mentions, hashtags
+}
+
+// notifyNewChirp tells the users a new chirp mentions, and the author of
+// the chirp it replies to.
+func (cfg *apiConfig) notifyNewChirp(ctx context.Context, chirp database.Chirp) {
+	cfg.notifyMentions(ctx, chirp, nil)
+	if chirp.InReplyTo != 0 {
+		parent, err := cfg.DB.GetChirp(ctx, chirp.InReplyTo)
+		if err == nil && parent.AuthorID != chirp.AuthorID {
+			cfg.notify(ctx, parent.AuthorID, database.NotificationReplied, chirp.AuthorID, chirp.ID)
+		}
+	}
+}
+
+// notifyMentions sends a mention notification to every user mentioned in
+// chirp, skipping the author and anyone already mentioned in previous.
+func (cfg *apiConfig) notifyMentions(ctx context.Context, chirp database.Chirp, previous []database.Mention) {
+	notified := map[int]struct{}{chirp.AuthorID: {}}
+	for _, m := range previous {
+		notified[m.UserID] = struct{}{}
+	}
+	for _, m := range chirp.Mentions {
+		if _, ok := notified[m.UserID]; ok {
+			continue
+		}
+		notified[m.UserID] = struct{}{}
+		cfg.notify(ctx, m.UserID, database.NotificationMentioned, chirp.AuthorID, chirp.ID)
+	}
+}
+
+// notify records a notification unless the recipient has blocked or
+// muted the actor. Failures are logged rather than surfaced, the action
+// that triggered the notification already succeeded.
+func (cfg *apiConfig) notify(ctx context.Context, userID int, notificationType database.NotificationType, actorID, chirpID int) {
+	visibility, err := cfg.DB.GetVisibility(ctx, userID)
+	if err != nil {
+		slog.Error("Couldn't notify user", "user_id", userID, "error", err)
+		return
+	}
+	if !visibility.ShowInFeed(actorID) {
+		return
+	}
+
+	_, err = cfg.DB.CreateNotification(ctx, userID, notificationType, actorID, chirpID)
+	if err != nil {
+		slog.Error("Couldn't notify user", "user_id", userID, "error", err)
+	}
+}
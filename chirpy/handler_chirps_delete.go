@@ -1,29 +1,17 @@
 package main
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
-	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/auth"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/database"
 )
 
 func (cfg *apiConfig) handlerChirpDelete(w http.ResponseWriter, r *http.Request) {
-	// authenticate user permission: AuthorID of chirp == UserID
-	token, err := auth.GetBearerToken(r.Header)
+	userID, err := cfg.userIDFromRequest(r)
 	if err != nil {
-		respondWithError(w, http.StatusForbidden, err.Error())
-		return
-	}
-
-	subject, err := auth.ValidateJWT(token, cfg.jwtSecret)
-	if err != nil {
-		respondWithError(w, http.StatusForbidden, err.Error())
-		return
-	}
-
-	userID, err := strconv.Atoi(subject)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		respondWithError(w, http.StatusUnauthorized, err.Error())
 		return
 	}
 
@@ -34,7 +22,7 @@ func (cfg *apiConfig) handlerChirpDelete(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	dbChirp, err := cfg.DB.GetChirp(chirpID)
+	dbChirp, err := cfg.DB.GetChirp(r.Context(), chirpID)
 	if err != nil {
 		respondWithError(w, http.StatusNotFound, "Couldn't get chirp")
 		return
@@ -44,10 +32,20 @@ func (cfg *apiConfig) handlerChirpDelete(w http.ResponseWriter, r *http.Request)
 		respondWithError(w, http.StatusForbidden, "this chirp does not belong to you")
 		return
 	}
+	if !checkPreconditions(w, r, chirpLastModified(dbChirp), entityTags(dbChirp.Version())...) {
+		return
+	}
 
-	err = cfg.DB.DeleteChirp(dbChirp.ID)
+	err = cfg.DB.DeleteChirp(r.Context(), dbChirp.ID, preconditionVersion(r, dbChirp.Version()))
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, err.Error())
+		switch {
+		case errors.Is(err, database.ErrVersionMismatch):
+			respondPreconditionFailed(w)
+		case errors.Is(err, database.ErrNotExist):
+			respondWithError(w, http.StatusNotFound, "Couldn't get chirp")
+		default:
+			respondWithError(w, http.StatusInternalServerError, "Couldn't delete chirp")
+		}
 		return
 	}
 
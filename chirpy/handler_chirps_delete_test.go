@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/auth"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/database"
+)
+
+func TestChirpsDelete(t *testing.T) {
+	cfg, mux := newTestAPI(t)
+	ctx := context.Background()
+
+	var tokens []string
+	for _, email := range []string{"alice@example.com", "bob@example.com"} {
+		user, err := cfg.DB.CreateUser(ctx, email, "hash")
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := auth.MakeJWT(user.ID, cfg.jwtSecret, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens = append(tokens, "Bearer "+token)
+	}
+	alice, bob := tokens[0], tokens[1]
+	if _, err := cfg.DB.CreateChirp(ctx, database.CreateChirpParams{Body: "first", AuthorID: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name          string
+		authorization string
+		path          string
+		want          int
+	}{
+		{"no token", "", "/api/v1/chirps/1", http.StatusUnauthorized},
+		{"bad token", "Bearer nonsense", "/api/v1/chirps/1", http.StatusUnauthorized},
+		{"not the author", bob, "/api/v1/chirps/1", http.StatusForbidden},
+		{"missing chirp", alice, "/api/v1/chirps/99", http.StatusNotFound},
+		{"author", alice, "/api/v1/chirps/1", http.StatusNoContent},
+		{"already deleted", alice, "/api/v1/chirps/1", http.StatusNotFound},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodDelete, tt.path, nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("expected %d, got %d %s", tt.want, w.Code, w.Body)
+			}
+		})
+	}
+}
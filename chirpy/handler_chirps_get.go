@@ -4,6 +4,9 @@ import (
 	"net/http"
 	"sort"
 	"strconv"
+	"time"
+
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/database"
 )
 
 func (cfg *apiConfig) handlerChirpsGet(w http.ResponseWriter, r *http.Request) {
@@ -14,21 +17,36 @@ func (cfg *apiConfig) handlerChirpsGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	dbChirp, err := cfg.DB.GetChirp(chirpID)
+	dbChirp, err := cfg.DB.GetChirp(r.Context(), chirpID)
 	if err != nil {
 		respondWithError(w, http.StatusNotFound, "Couldn't get chirp")
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, Chirp{
-		ID:       dbChirp.ID,
-		Body:     dbChirp.Body,
-		AuthorID: dbChirp.AuthorID,
-	})
+	visibility, err := cfg.visibilityForRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirp")
+		return
+	}
+	if !visibility.CanSeeChirp(dbChirp) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get chirp")
+		return
+	}
+	if !checkNotModified(w, r, dbChirp.Version(), chirpLastModified(dbChirp)) {
+		return
+	}
+
+	respondNegotiated(w, r, http.StatusOK, cfg.newChirp(r.Context(), dbChirp))
 }
 
 func (cfg *apiConfig) handlerChirpsRetrieve(w http.ResponseWriter, r *http.Request) {
-	dbChirps, err := cfg.DB.GetChirps()
+	dbChirps, err := cfg.DB.GetChirps(r.Context())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirps")
+		return
+	}
+
+	visibility, err := cfg.visibilityForRequest(r)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirps")
 		return
@@ -36,27 +54,37 @@ func (cfg *apiConfig) handlerChirpsRetrieve(w http.ResponseWriter, r *http.Reque
 
 	id, err := strconv.Atoi(r.URL.Query().Get("author_id"))
 
-	chirps := []Chirp{}
+	visible := []database.Chirp{}
 	for _, dbChirp := range dbChirps {
 		if err == nil && dbChirp.AuthorID != id {
 			continue
 		}
+		if !visibility.ShowChirpInFeed(dbChirp) {
+			continue
+		}
 
-		chirps = append(chirps, Chirp{
-			ID:       dbChirp.ID,
-			Body:     dbChirp.Body,
-			AuthorID: dbChirp.AuthorID,
-		})
+		visible = append(visible, dbChirp)
 	}
 
 	sortType := r.URL.Query().Get("sort")
-	sort.Slice(chirps, func(i, j int) bool {
+	sort.Slice(visible, func(i, j int) bool {
 		if sortType == "desc" {
-			return chirps[i].ID >= chirps[j].ID
+			return visible[i].ID > visible[j].ID
 		} else {
-			return chirps[i].ID < chirps[j].ID
+			return visible[i].ID < visible[j].ID
 		}
 	})
 
-	respondWithJSON(w, http.StatusOK, chirps)
+	// deleting a chirp doesn't move any timestamp, so lists only get an
+	// ETag and no Last-Modified
+	if !checkNotModified(w, r, chirpsVersion(visible), time.Time{}) {
+		return
+	}
+
+	chirps := make([]Chirp, 0, len(visible))
+	for _, dbChirp := range visible {
+		chirps = append(chirps, cfg.newChirp(r.Context(), dbChirp))
+	}
+
+	respondWithList(w, r, http.StatusOK, chirps)
 }
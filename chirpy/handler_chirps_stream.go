@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/database"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/pubsub"
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+)
+
+const (
+	// chirpEventReplaySize is how many recent events a reconnecting
+	// stream can resume from.
+	chirpEventReplaySize = 1000
+	// chirpEventQueueSize is how many events a stream can fall behind by
+	// before it is cut off and has to resume.
+	chirpEventQueueSize = 64
+	// streamKeepAlive is how often idle streams send something, so
+	// proxies don't time them out.
+	streamKeepAlive = 30 * time.Second
+	// streamWriteTimeout bounds each write to a stream, so a client that
+	// stops reading is dropped rather than holding on to its queue.
+	streamWriteTimeout = 10 * time.Second
+	sseRetry           = 3 * time.Second
+
+	eventStreamReset = "stream.reset"
+)
+
+// ChirpEvent is a change pushed to chirp streams. Chirp is only set for
+// chirp.created and chirp.updated, which replaces the chirp shown with
+// that ID, or adds it back after a moderator unhid it. chirp.deleted and
+// chirp.hidden both mean the chirp should no longer be shown. A
+// stream.reset event carries nothing but its ID: events were missed, so
+// the client should reload with GET /api/v1/chirps.
+type ChirpEvent struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	ChirpID  int    `json:"chirp_id,omitempty"`
+	AuthorID int    `json:"author_id,omitempty"`
+	Chirp    *Chirp `json:"chirp,omitempty"`
+}
+
+func (cfg *apiConfig) newChirpEvent(ctx context.Context, e pubsub.Event[database.Chirp]) ChirpEvent {
+	event := ChirpEvent{
+		ID:       e.ID,
+		Type:     e.Type,
+		ChirpID:  e.Data.ID,
+		AuthorID: e.Data.AuthorID,
+	}
+	if e.Type == database.EventChirpCreated || e.Type == database.EventChirpUpdated {
+		chirp := cfg.newChirp(ctx, e.Data)
+		event.Chirp = &chirp
+	}
+	return event
+}
+
+// subscribeChirps subscribes to the chirp events the request asks for:
+// optionally only those by the authors in author_id and, with
+// followed=true, the users the requester follows, and never those the
+// requester couldn't see in their feed. Follows, blocks and mutes are
+// applied as they were when the stream started. The stream resumes after
+// the Last-Event-ID header, or last_event_id query parameter for clients
+// that can't set headers.
+func (cfg *apiConfig) subscribeChirps(w http.ResponseWriter, r *http.Request) (*pubsub.Subscription[database.Chirp], bool) {
+	authors := map[int]struct{}{}
+	filtered := false
+	for _, param := range r.URL.Query()["author_id"] {
+		filtered = true
+		for _, s := range strings.Split(param, ",") {
+			id, err := strconv.Atoi(strings.TrimSpace(s))
+			if err != nil {
+				respondWithError(w, http.StatusBadRequest, "Invalid author ID")
+				return nil, false
+			}
+			authors[id] = struct{}{}
+		}
+	}
+	if r.URL.Query().Get("followed") == "true" {
+		filtered = true
+		userID, err := cfg.userIDFromRequest(r)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, err.Error())
+			return nil, false
+		}
+		followed, err := cfg.DB.GetFollowedUsers(r.Context(), userID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't start stream")
+			return nil, false
+		}
+		for _, rel := range followed {
+			authors[rel.UserID] = struct{}{}
+		}
+	}
+
+	visibility, err := cfg.visibilityForRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't start stream")
+		return nil, false
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+
+	return cfg.chirpEvents.Subscribe(lastEventID, func(e pubsub.Event[database.Chirp]) bool {
+		if _, ok := authors[e.Data.AuthorID]; filtered && !ok {
+			return false
+		}
+		return visibility.ShowChirpInFeed(e.Data)
+	}), true
+}
+
+// handlerChirpsStream pushes chirp events as Server-Sent Events. A stream
+// that falls behind, or is open when the server shuts down, is ended and
+// the client's EventSource reconnects with Last-Event-ID.
+func (cfg *apiConfig) handlerChirpsStream(w http.ResponseWriter, r *http.Request) {
+	if _, ok := negotiate(r, "text/event-stream"); !ok {
+		respondNotAcceptable(w, "text/event-stream")
+		return
+	}
+	sub, ok := cfg.subscribeChirps(w, r)
+	if !ok {
+		return
+	}
+	defer sub.Close()
+
+	rc := http.NewResponseController(w)
+	send := func(id, event string, payload any) error {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		// the server's WriteTimeout would end the stream, so each write
+		// gets its own deadline instead
+		rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		if _, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", id, event, data); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	// stop nginx and the like buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+	fmt.Fprintf(w, "retry: %d\n\n", sseRetry.Milliseconds())
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	if sub.Gap {
+		if err := send(sub.LastID, eventStreamReset, ChirpEvent{ID: sub.LastID, Type: eventStreamReset}); err != nil {
+			return
+		}
+	}
+	for _, e := range sub.Replay {
+		if err := send(e.ID, e.Type, cfg.newChirpEvent(r.Context(), e)); err != nil {
+			return
+		}
+	}
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case e, ok := <-sub.C:
+			if !ok {
+				slog.Debug("Ending chirp stream", "reason", sub.Err())
+				return
+			}
+			if err := send(e.ID, e.Type, cfg.newChirpEvent(r.Context(), e)); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// handlerChirpsSocket pushes chirp events as JSON messages over a
+// WebSocket. Messages from the client are ignored. A socket that falls
+// behind is closed with 1013 (try again later), and one open when the
+// server shuts down with 1001 (going away); either way the client can
+// reconnect with last_event_id.
+func (cfg *apiConfig) handlerChirpsSocket(w http.ResponseWriter, r *http.Request) {
+	sub, ok := cfg.subscribeChirps(w, r)
+	if !ok {
+		return
+	}
+	defer sub.Close()
+
+	conn, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		// Accept has already responded
+		slog.Debug("Couldn't accept WebSocket", "error", err)
+		return
+	}
+	defer conn.CloseNow()
+	// handles pings and the closing handshake, and cancels ctx once the
+	// client goes away
+	ctx := conn.CloseRead(r.Context())
+
+	send := func(event ChirpEvent) error {
+		ctx, cancel := context.WithTimeout(ctx, streamWriteTimeout)
+		defer cancel()
+		return wsjson.Write(ctx, conn, event)
+	}
+
+	if sub.Gap {
+		if err := send(ChirpEvent{ID: sub.LastID, Type: eventStreamReset}); err != nil {
+			return
+		}
+	}
+	for _, e := range sub.Replay {
+		if err := send(cfg.newChirpEvent(ctx, e)); err != nil {
+			return
+		}
+	}
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case e, ok := <-sub.C:
+			if !ok {
+				if errors.Is(sub.Err(), pubsub.ErrSlowConsumer) {
+					conn.Close(websocket.StatusTryAgainLater, "fell behind, reconnect with last_event_id")
+					return
+				}
+				conn.Close(websocket.StatusGoingAway, "server is shutting down")
+				return
+			}
+			if err := send(cfg.newChirpEvent(ctx, e)); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			pingCtx, cancel := context.WithTimeout(ctx, streamWriteTimeout)
+			err := conn.Ping(pingCtx)
+			cancel()
+			if err != nil {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/auth"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/database"
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+)
+
+// sseReader reads the events of a Server-Sent Events stream.
+type sseReader struct {
+	t       *testing.T
+	scanner *bufio.Scanner
+}
+
+func (s sseReader) next() (id, event string, data ChirpEvent) {
+	s.t.Helper()
+	for s.scanner.Scan() {
+		line := s.scanner.Text()
+		switch {
+		case line == "" && event != "":
+			return id, event, data
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &data); err != nil {
+				s.t.Fatal(err)
+			}
+		}
+	}
+	s.t.Fatalf("stream ended: %v", s.scanner.Err())
+	return
+}
+
+func openSSE(t *testing.T, ctx context.Context, url string, header ...string) sseReader {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	for i := 0; i < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	return sseReader{t: t, scanner: bufio.NewScanner(resp.Body)}
+}
+
+func TestChirpStream(t *testing.T) {
+	cfg, mux := newTestAPI(t)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream := openSSE(t, ctx, srv.URL+"/api/v1/chirps/stream?author_id=2,3")
+
+	for _, params := range []database.CreateChirpParams{
+		{Body: "not followed", AuthorID: 1},
+		{Body: "followed", AuthorID: 2},
+	} {
+		if _, err := cfg.DB.CreateChirp(ctx, params); err != nil {
+			t.Fatal(err)
+		}
+	}
+	firstID, event, data := stream.next()
+	if event != database.EventChirpCreated || data.ID != firstID || data.Chirp == nil || data.Chirp.Body != "followed" {
+		t.Fatalf("expected only the followed author's chirp, got %s %+v", event, data)
+	}
+
+	if err := cfg.DB.DeleteChirp(ctx, data.ChirpID, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, event, data := stream.next(); event != database.EventChirpDeleted || data.ChirpID != 2 || data.Chirp != nil {
+		t.Errorf("expected a deletion event, got %s %+v", event, data)
+	}
+
+	resumed := openSSE(t, ctx, srv.URL+"/api/v1/chirps/stream", "Last-Event-ID", firstID)
+	if _, event, data := resumed.next(); event != database.EventChirpDeleted || data.ChirpID != 2 {
+		t.Errorf("expected the missed deletion to be replayed, got %s %+v", event, data)
+	}
+
+	reset := openSSE(t, ctx, srv.URL+"/api/v1/chirps/stream", "Last-Event-ID", "unknown-1")
+	if id, event, _ := reset.next(); event != eventStreamReset || id == "" {
+		t.Errorf("expected an unknown event ID to reset the stream, got %s %q", event, id)
+	}
+
+	// edits replace the chirp, and a moderator hiding it takes it down
+	chirp, err := cfg.DB.CreateChirp(ctx, database.CreateChirpParams{Body: "typo", AuthorID: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.next()
+	if _, err := cfg.DB.UpdateChirp(ctx, chirp.ID, 0, "fixed", nil, nil, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, event, data := stream.next(); event != database.EventChirpUpdated || data.Chirp == nil || data.Chirp.Body != "fixed" {
+		t.Errorf("expected an update event with the edited chirp, got %s %+v", event, data)
+	}
+	report, err := cfg.DB.CreateReport(ctx, chirp.ID, 1, database.ReportSpam, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cfg.DB.ResolveReport(ctx, report.ID, 1, database.ActionHide, "spam", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, event, data := stream.next(); event != database.EventChirpHidden || data.ChirpID != chirp.ID || data.Chirp != nil {
+		t.Errorf("expected a hide event, got %s %+v", event, data)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/chirps/stream?author_id=me", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a bad author ID, got %d", w.Code)
+	}
+}
+
+func TestChirpStreamFollowed(t *testing.T) {
+	cfg, mux := newTestAPI(t)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, email := range []string{"alice@example.com", "bob@example.com", "carol@example.com", "dave@example.com"} {
+		if _, err := cfg.DB.CreateUser(ctx, email, "hash"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := cfg.DB.FollowUser(ctx, 1, 2); err != nil {
+		t.Fatal(err)
+	}
+	token, err := auth.MakeJWT(1, cfg.jwtSecret, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"followed", "followed=true", []string{"bob"}},
+		{"followed and authors", "followed=true&author_id=3", []string{"carol", "bob"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			stream := openSSE(t, ctx, srv.URL+"/api/v1/chirps/stream?"+tt.query, "Authorization", "Bearer "+token)
+			// bob's last chirp marks the end, as everything gets his
+			for _, params := range []database.CreateChirpParams{
+				{Body: "dave", AuthorID: 4},
+				{Body: "carol", AuthorID: 3},
+				{Body: "bob", AuthorID: 2},
+				{Body: "end", AuthorID: 2},
+			} {
+				if _, err := cfg.DB.CreateChirp(ctx, params); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var got []string
+			for {
+				_, event, data := stream.next()
+				if event != database.EventChirpCreated || data.Chirp == nil {
+					t.Fatalf("unexpected event %s %+v", event, data)
+				}
+				if data.Chirp.Body == "end" {
+					break
+				}
+				got = append(got, data.Chirp.Body)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("expected chirps by %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/chirps/stream?followed=true", nil)
+	r.Header.Set("Accept", "text/event-stream")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for followed without a token, got %d", w.Code)
+	}
+}
+
+func TestChirpSocket(t *testing.T) {
+	cfg, mux := newTestAPI(t)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, _, err := websocket.Dial(ctx, srv.URL+"/api/v1/chirps/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.CloseNow()
+
+	if _, err := cfg.DB.CreateChirp(ctx, database.CreateChirpParams{Body: "hello", AuthorID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	var event ChirpEvent
+	if err := wsjson.Read(ctx, conn, &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != database.EventChirpCreated || event.Chirp == nil || event.Chirp.Body != "hello" {
+		t.Errorf("unexpected event %+v", event)
+	}
+
+	cfg.chirpEvents.Close()
+	_, _, err = conn.Read(ctx)
+	if status := websocket.CloseStatus(err); status != websocket.StatusGoingAway {
+		t.Errorf("expected the socket to be closed with 1001 on shutdown, got %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/auth"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/database"
+)
+
+type ChirpRevision struct {
+	Revision  int       `json:"revision"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (cfg *apiConfig) handlerChirpsUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Body string `json:"body"`
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	subject, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	userID, err := strconv.Atoi(subject)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "invalid userID in JWT subject")
+		return
+	}
+
+	chirpID, err := strconv.Atoi(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
+	}
+
+	params := parameters{}
+	if !decodeJSON(w, r, &params) {
+		return
+	}
+
+	maxLength := cfg.settings.Load().chirpMaxLength
+	cleaned, err := validateChirp(params.Body, maxLength)
+	if err != nil {
+		respondWithValidationErrors(w, []fieldError{{Field: "body", Code: "too_long", Message: fmt.Sprintf("must be at most %d characters", maxLength)}})
+		return
+	}
+
+	dbChirp, err := cfg.DB.GetChirp(r.Context(), chirpID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get chirp")
+		return
+	}
+	if dbChirp.AuthorID != userID {
+		respondWithError(w, http.StatusForbidden, "this chirp does not belong to you")
+		return
+	}
+	author, err := cfg.DB.GetUser(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't get user")
+		return
+	}
+	if author.IsSuspended() {
+		respondWithErrorCode(w, http.StatusForbidden, "account_suspended", "Account is suspended")
+		return
+	}
+	if !checkPreconditions(w, r, chirpLastModified(dbChirp), entityTags(dbChirp.Version())...) {
+		return
+	}
+
+	previousMentions := dbChirp.Mentions
+	mentions, hashtags := cfg.parseEntities(r.Context(), cleaned)
+	dbChirp, err = cfg.DB.UpdateChirp(r.Context(), chirpID, preconditionVersion(r, dbChirp.Version()), cleaned, mentions, hashtags, cfg.settings.Load().chirpEditWindow)
+	if err != nil {
+		if errors.Is(err, database.ErrVersionMismatch) {
+			respondPreconditionFailed(w)
+			return
+		}
+		if errors.Is(err, database.ErrEditWindowClosed) {
+			respondWithErrorCode(w, http.StatusForbidden, "edit_window_closed", "This chirp can no longer be edited")
+			return
+		}
+		if errors.Is(err, database.ErrNotExist) {
+			respondWithError(w, http.StatusNotFound, "Couldn't get chirp")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update chirp")
+		return
+	}
+
+	cfg.notifyMentions(r.Context(), dbChirp, previousMentions)
+
+	w.Header().Set("ETag", entityTag(dbChirp.Version(), mediaTypeJSON))
+	respondWithJSON(w, http.StatusOK, cfg.newChirp(r.Context(), dbChirp))
+}
+
+func (cfg *apiConfig) handlerChirpRevisions(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := strconv.Atoi(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
+	}
+
+	dbChirp, err := cfg.DB.GetChirp(r.Context(), chirpID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get chirp")
+		return
+	}
+	visibility, err := cfg.visibilityForRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve revisions")
+		return
+	}
+	if !visibility.CanSeeChirp(dbChirp) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get chirp")
+		return
+	}
+	if !checkNotModified(w, r, dbChirp.Version(), chirpLastModified(dbChirp)) {
+		return
+	}
+
+	dbRevisions, err := cfg.DB.GetChirpRevisions(r.Context(), chirpID)
+	if err != nil {
+		if errors.Is(err, database.ErrNotExist) {
+			respondWithError(w, http.StatusNotFound, "Couldn't get chirp")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve revisions")
+		return
+	}
+
+	revisions := make([]ChirpRevision, 0, len(dbRevisions))
+	for _, rev := range dbRevisions {
+		revisions = append(revisions, ChirpRevision{
+			Revision:  rev.Revision,
+			Body:      rev.Body,
+			CreatedAt: rev.CreatedAt,
+		})
+	}
+
+	respondWithList(w, r, http.StatusOK, revisions)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/auth"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/database"
+)
+
+func TestChirpsUpdate(t *testing.T) {
+	cfg, mux := newTestAPI(t)
+	ctx := context.Background()
+
+	var tokens []string
+	for _, email := range []string{"alice@example.com", "bob@example.com"} {
+		user, err := cfg.DB.CreateUser(ctx, email, "hash")
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := auth.MakeJWT(user.ID, cfg.jwtSecret, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens = append(tokens, "Bearer "+token)
+	}
+	alice, bob := tokens[0], tokens[1]
+	chirp, err := cfg.DB.CreateChirp(ctx, database.CreateChirpParams{Body: "first", AuthorID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	setEditWindow := func(window time.Duration) {
+		s := *cfg.settings.Load()
+		s.chirpEditWindow = window
+		cfg.settings.Store(&s)
+	}
+	send := func(authorization, method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		if body != "" {
+			r.Header.Set("Content-Type", "application/json")
+		}
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+
+	for _, tt := range []struct {
+		name          string
+		authorization string
+		path          string
+		body          string
+		window        time.Duration
+		want          int
+		code          string
+		revision      int
+	}{
+		{"edit", alice, "/api/v1/chirps/1", `{"body":"second"}`, time.Hour, http.StatusOK, "", 2},
+		{"edit again", alice, "/api/v1/chirps/1", `{"body":"third"}`, time.Hour, http.StatusOK, "", 3},
+		{"not the author", bob, "/api/v1/chirps/1", `{"body":"mine now"}`, time.Hour, http.StatusForbidden, "", 0},
+		{"too long", alice, "/api/v1/chirps/1", `{"body":"` + strings.Repeat("a", 200) + `"}`, time.Hour, http.StatusUnprocessableEntity, "validation_failed", 0},
+		{"missing chirp", alice, "/api/v1/chirps/99", `{"body":"hello"}`, time.Hour, http.StatusNotFound, "", 0},
+		{"window closed", alice, "/api/v1/chirps/1", `{"body":"too late"}`, 0, http.StatusForbidden, "edit_window_closed", 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			setEditWindow(tt.window)
+			w := send(tt.authorization, http.MethodPut, tt.path, tt.body)
+			if w.Code != tt.want {
+				t.Fatalf("expected %d, got %d %s", tt.want, w.Code, w.Body)
+			}
+			if tt.code != "" {
+				var p problem
+				if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil || p.Code != tt.code {
+					t.Errorf("expected a %s problem, got %s", tt.code, w.Body)
+				}
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			var got Chirp
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Revision != tt.revision || got.EditedAt == nil {
+				t.Errorf("expected revision %d with an edit time, got %+v", tt.revision, got)
+			}
+		})
+	}
+
+	w := send("", http.MethodGet, "/api/v1/chirps/1/revisions", "")
+	var revisions []ChirpRevision
+	if err := json.Unmarshal(w.Body.Bytes(), &revisions); err != nil {
+		t.Fatalf("%v: %d %s", err, w.Code, w.Body)
+	}
+	if len(revisions) != 2 || revisions[0].Revision != 1 || revisions[0].Body != "first" || revisions[1].Revision != 2 || revisions[1].Body != "second" {
+		t.Errorf("expected the first and second bodies as revisions, got %+v", revisions)
+	}
+	if !revisions[0].CreatedAt.Equal(chirp.CreatedAt) {
+		t.Errorf("expected the first revision to date from the chirp's creation, got %v", revisions[0].CreatedAt)
+	}
+	if w := send("", http.MethodGet, "/api/v1/chirps/99/revisions", ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a missing chirp's revisions, got %d", w.Code)
+	}
+
+	// suspended authors can't edit, even within the window
+	setEditWindow(time.Hour)
+	report, err := cfg.DB.CreateReport(ctx, chirp.ID, 2, database.ReportSpam, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cfg.DB.ResolveReport(ctx, report.ID, 2, database.ActionSuspend, "spam", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	var p problem
+	w = send(alice, http.MethodPut, "/api/v1/chirps/1", `{"body":"suspended"}`)
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil || w.Code != http.StatusForbidden || p.Code != "account_suspended" {
+		t.Errorf("expected a suspended author's edit to be refused, got %d %s", w.Code, w.Body)
+	}
+
+	// deleting a chirp discards its revisions
+	if err := cfg.DB.DeleteChirp(ctx, chirp.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cfg.DB.GetChirpRevisions(ctx, chirp.ID); !errors.Is(err, database.ErrNotExist) {
+		t.Errorf("expected the deleted chirp's revisions to be gone, got %v", err)
+	}
+}
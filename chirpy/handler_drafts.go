@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/database"
+)
+
+const (
+	draftStatusDraft     = "draft"
+	draftStatusScheduled = "scheduled"
+)
+
+// Draft is an unpublished chirp. Scheduled drafts have a PublishAt and
+// are published by the draft scheduler once it has passed.
+type Draft struct {
+	ID           int        `json:"id"`
+	Status       string     `json:"status"`
+	Body         string     `json:"body"`
+	Media        []Media    `json:"media"`
+	InReplyTo    int        `json:"in_reply_to,omitempty"`
+	PublishAt    *time.Time `json:"publish_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	PublishError string     `json:"publish_error,omitempty"`
+}
+
+func (cfg *apiConfig) newDraft(ctx context.Context, dbDraft database.Draft) Draft {
+	draft := Draft{
+		ID:           dbDraft.ID,
+		Status:       draftStatusDraft,
+		Body:         dbDraft.Body,
+		Media:        []Media{},
+		InReplyTo:    dbDraft.InReplyTo,
+		PublishAt:    dbDraft.PublishAt,
+		CreatedAt:    dbDraft.CreatedAt,
+		UpdatedAt:    dbDraft.UpdatedAt,
+		PublishError: dbDraft.PublishError,
+	}
+	if dbDraft.Scheduled() {
+		draft.Status = draftStatusScheduled
+	}
+	for _, id := range dbDraft.MediaIDs {
+		dbMedia, err := cfg.DB.GetMedia(ctx, id)
+		if err != nil {
+			continue
+		}
+		draft.Media = append(draft.Media, newMedia(dbMedia))
+	}
+	return draft
+}
+
+func (cfg *apiConfig) handlerDraftsGet(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.userIDFromRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	if status != "" && status != draftStatusDraft && status != draftStatusScheduled {
+		respondWithError(w, http.StatusBadRequest, "Invalid status: must be draft or scheduled")
+		return
+	}
+
+	dbDrafts, err := cfg.DB.GetDrafts(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve drafts")
+		return
+	}
+
+	drafts := []Draft{}
+	for _, dbDraft := range dbDrafts {
+		draft := cfg.newDraft(r.Context(), dbDraft)
+		if status == "" || draft.Status == status {
+			drafts = append(drafts, draft)
+		}
+	}
+	respondWithJSON(w, http.StatusOK, drafts)
+}
+
+func (cfg *apiConfig) handlerDraftGet(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.userIDFromRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	draft, ok := cfg.ownDraft(w, r, userID)
+	if !ok {
+		return
+	}
+	respondWithJSON(w, http.StatusOK, cfg.newDraft(r.Context(), draft))
+}
+
+// handlerDraftsCreate saves a draft, scheduling it if publish_at is set.
+func (cfg *apiConfig) handlerDraftsCreate(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.userIDFromRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	params, ok := cfg.decodeDraft(w, r, userID)
+	if !ok {
+		return
+	}
+
+	draft, err := cfg.DB.CreateDraft(r.Context(), userID, params)
+	if err != nil {
+		respondWithDraftError(w, err, "Couldn't create draft")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, cfg.newDraft(r.Context(), draft))
+}
+
+// handlerDraftUpdate replaces a draft. It is also how drafts are
+// scheduled, rescheduled, or unscheduled with a null publish_at.
+func (cfg *apiConfig) handlerDraftUpdate(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.userIDFromRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	draft, ok := cfg.ownDraft(w, r, userID)
+	if !ok {
+		return
+	}
+	params, ok := cfg.decodeDraft(w, r, userID)
+	if !ok {
+		return
+	}
+
+	draft, err = cfg.DB.UpdateDraft(r.Context(), draft.ID, params)
+	if err != nil {
+		respondWithDraftError(w, err, "Couldn't update draft")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, cfg.newDraft(r.Context(), draft))
+}
+
+// handlerDraftDelete discards a draft, cancelling it if it was scheduled.
+func (cfg *apiConfig) handlerDraftDelete(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.userIDFromRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	draft, ok := cfg.ownDraft(w, r, userID)
+	if !ok {
+		return
+	}
+
+	err = cfg.DB.DeleteDraft(r.Context(), draft.ID)
+	if err != nil && !errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete draft")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerDraftPublish publishes a draft now, whether or not it was
+// scheduled, and returns the new chirp.
+func (cfg *apiConfig) handlerDraftPublish(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.userIDFromRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	draft, ok := cfg.ownDraft(w, r, userID)
+	if !ok {
+		return
+	}
+
+	chirp, err := cfg.publishDraft(r.Context(), draft)
+	if err != nil {
+		respondWithDraftError(w, err, "Couldn't publish draft")
+		return
+	}
+
+	w.Header().Set("ETag", entityTag(chirp.Version(), mediaTypeJSON))
+	respondWithJSON(w, http.StatusCreated, cfg.newChirp(r.Context(), chirp))
+}
+
+// ownDraft returns the draft named in the path if it belongs to userID.
+// Drafts are private, so other users' drafts are reported as not found.
+func (cfg *apiConfig) ownDraft(w http.ResponseWriter, r *http.Request, userID int) (database.Draft, bool) {
+	draftID, err := strconv.Atoi(r.PathValue("draftID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid draft ID")
+		return database.Draft{}, false
+	}
+
+	draft, err := cfg.DB.GetDraft(r.Context(), draftID)
+	if err != nil && !errors.Is(err, database.ErrNotExist) {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get draft")
+		return database.Draft{}, false
+	}
+	if err != nil || draft.AuthorID != userID {
+		respondWithError(w, http.StatusNotFound, "Couldn't get draft")
+		return database.Draft{}, false
+	}
+	return draft, true
+}
+
+// decodeDraft reads and validates the body of a draft create or update.
+// The same checks are made again when the draft is published, since
+// things can change while it waits.
+func (cfg *apiConfig) decodeDraft(w http.ResponseWriter, r *http.Request, userID int) (database.DraftParams, bool) {
+	type parameters struct {
+		Body      string     `json:"body"`
+		MediaIDs  []int      `json:"media_ids"`
+		InReplyTo int        `json:"in_reply_to"`
+		PublishAt *time.Time `json:"publish_at"`
+	}
+
+	params := parameters{}
+	if !decodeJSON(w, r, &params) {
+		return database.DraftParams{}, false
+	}
+
+	maxLength := cfg.settings.Load().chirpMaxLength
+	v := validator{}
+	cleaned, err := validateChirp(params.Body, maxLength)
+	v.check(err == nil, "body", "too_long", fmt.Sprintf("must be at most %d characters", maxLength))
+	v.check(len(params.MediaIDs) <= maxChirpMedia, "media_ids", "too_many", fmt.Sprintf("must have at most %d items", maxChirpMedia))
+	v.check(params.PublishAt == nil || params.PublishAt.After(time.Now()), "publish_at", "past", "must be in the future")
+	if !v.valid() {
+		respondWithValidationErrors(w, v.errs)
+		return database.DraftParams{}, false
+	}
+
+	err = cfg.checkAuthor(r.Context(), userID, params.InReplyTo)
+	if err != nil {
+		respondWithDraftError(w, err, "Couldn't save draft")
+		return database.DraftParams{}, false
+	}
+
+	draft := database.DraftParams{
+		Body:      cleaned,
+		MediaIDs:  params.MediaIDs,
+		InReplyTo: params.InReplyTo,
+	}
+	if params.PublishAt != nil {
+		publishAt := params.PublishAt.UTC()
+		draft.PublishAt = &publishAt
+	}
+	return draft, true
+}
+
+// publishDraft checks that draft can still be published, publishes it and
+// sends the notifications a new chirp would.
+func (cfg *apiConfig) publishDraft(ctx context.Context, draft database.Draft) (database.Chirp, error) {
+	err := cfg.checkAuthor(ctx, draft.AuthorID, draft.InReplyTo)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	if _, err := validateChirp(draft.Body, cfg.settings.Load().chirpMaxLength); err != nil {
+		return database.Chirp{}, errChirpTooLong
+	}
+
+	mentions, hashtags := cfg.parseEntities(ctx, draft.Body)
+	chirp, err := cfg.DB.PublishDraft(ctx, draft, mentions, hashtags)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	cfg.notifyNewChirp(ctx, chirp)
+	return chirp, nil
+}
+
+// respondWithDraftError responds to an error saving or publishing a
+// draft, falling back to a 500 with msg.
+func respondWithDraftError(w http.ResponseWriter, err error, msg string) {
+	switch {
+	case errors.Is(err, database.ErrDraftChanged):
+		respondWithError(w, http.StatusConflict, "The draft changed while it was being published")
+	case errors.Is(err, database.ErrNotExist):
+		respondWithError(w, http.StatusNotFound, "Couldn't get draft")
+	default:
+		respondWithChirpError(w, err, msg)
+	}
+}
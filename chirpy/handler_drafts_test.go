@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/auth"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/database"
+)
+
+func TestDrafts(t *testing.T) {
+	cfg, mux := newTestAPI(t)
+	ctx := context.Background()
+	var tokens []string
+	for _, email := range []string{"alice@example.com", "bob@example.com"} {
+		user, err := cfg.DB.CreateUser(ctx, email, "hash")
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := auth.MakeJWT(user.ID, cfg.jwtSecret, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	send := func(token, method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		if body != "" {
+			r.Header.Set("Content-Type", "application/json")
+		}
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+	decode := func(w *httptest.ResponseRecorder, v any) {
+		t.Helper()
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatalf("%v: %s", err, w.Body)
+		}
+	}
+
+	w := send(tokens[0], http.MethodPost, "/api/v1/drafts", `{"body":"not yet"}`)
+	var draft Draft
+	decode(w, &draft)
+	if w.Code != http.StatusCreated || draft.Status != draftStatusDraft || draft.PublishAt != nil {
+		t.Fatalf("expected a draft, got %d %s", w.Code, w.Body)
+	}
+	if chirps, _ := cfg.DB.GetChirps(ctx); len(chirps) != 0 {
+		t.Errorf("expected a draft not to be a chirp, have %d chirps", len(chirps))
+	}
+	if w := send(tokens[1], http.MethodGet, "/api/v1/drafts/1", ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected other users' drafts to be hidden, got %d", w.Code)
+	}
+
+	past := time.Now().Add(-time.Minute).Format(time.RFC3339)
+	if w := send(tokens[0], http.MethodPut, "/api/v1/drafts/1", `{"body":"late","publish_at":"`+past+`"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422 for a publish time in the past, got %d", w.Code)
+	}
+	later := time.Now().Add(time.Hour).Format(time.RFC3339)
+	w = send(tokens[0], http.MethodPut, "/api/v1/drafts/1", `{"body":"later","publish_at":"`+later+`"}`)
+	decode(w, &draft)
+	if w.Code != http.StatusOK || draft.Status != draftStatusScheduled || draft.Body != "later" {
+		t.Fatalf("expected the draft to be scheduled, got %d %s", w.Code, w.Body)
+	}
+
+	var drafts []Draft
+	decode(send(tokens[0], http.MethodGet, "/api/v1/drafts?status=scheduled", ""), &drafts)
+	if len(drafts) != 1 || drafts[0].ID != draft.ID {
+		t.Errorf("expected the scheduled draft to be listed, got %+v", drafts)
+	}
+	decode(send(tokens[1], http.MethodGet, "/api/v1/drafts", ""), &drafts)
+	if len(drafts) != 0 {
+		t.Errorf("expected only your own drafts to be listed, got %+v", drafts)
+	}
+
+	if n := cfg.publishDueDrafts(ctx, time.Now()); n != 0 {
+		t.Fatalf("expected nothing to be due yet, published %d", n)
+	}
+	events := cfg.chirpEvents.Subscribe("", nil)
+	defer events.Close()
+	if n := cfg.publishDueDrafts(ctx, time.Now().Add(2*time.Hour)); n != 1 {
+		t.Fatalf("expected the due draft to be published, published %d", n)
+	}
+	if event := <-events.C; event.Type != database.EventChirpCreated || event.Data.Body != "later" {
+		t.Errorf("expected a chirp.created event, got %+v", event)
+	}
+	if _, err := cfg.DB.GetDraft(ctx, draft.ID); err == nil {
+		t.Error("expected the published draft to be removed")
+	}
+	if n := cfg.publishDueDrafts(ctx, time.Now().Add(2*time.Hour)); n != 0 {
+		t.Errorf("expected a draft to be published once, published %d more", n)
+	}
+
+	parent, err := cfg.DB.CreateChirp(ctx, database.CreateChirpParams{Body: "parent", AuthorID: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply, err := cfg.DB.CreateDraft(ctx, 1, database.DraftParams{Body: "reply", InReplyTo: parent.ID, PublishAt: &time.Time{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.DB.DeleteChirp(ctx, parent.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	cfg.publishDueDrafts(ctx, time.Now())
+	if reply, err = cfg.DB.GetDraft(ctx, reply.ID); err != nil || reply.Scheduled() || reply.PublishError == "" {
+		t.Errorf("expected a draft that can't be published to be unscheduled with a reason, got %+v %v", reply, err)
+	}
+
+	w = send(tokens[0], http.MethodPost, "/api/v1/drafts", `{"body":"now"}`)
+	decode(w, &draft)
+	w = send(tokens[0], http.MethodPost, "/api/v1/drafts/"+strconv.Itoa(draft.ID)+"/publish", "")
+	var chirp Chirp
+	decode(w, &chirp)
+	if w.Code != http.StatusCreated || chirp.Body != "now" || chirp.AuthorID != 1 {
+		t.Errorf("expected the draft to be published, got %d %s", w.Code, w.Body)
+	}
+
+	if w := send(tokens[0], http.MethodDelete, "/api/v1/drafts/"+strconv.Itoa(reply.ID), ""); w.Code != http.StatusNoContent {
+		t.Errorf("expected the draft to be deleted, got %d", w.Code)
+	}
+	if w := send(tokens[0], http.MethodGet, "/api/v1/drafts/"+strconv.Itoa(reply.ID), ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected a deleted draft to be gone, got %d", w.Code)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/database"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/entities"
+)
+
+func (cfg *apiConfig) handlerHashtagChirps(w http.ResponseWriter, r *http.Request) {
+	tag := entities.NormalizeTag(r.PathValue("tag"))
+	if tag == "" {
+		respondWithError(w, http.StatusBadRequest, "Invalid hashtag")
+		return
+	}
+
+	dbChirps, err := cfg.DB.GetChirpsByHashtag(r.Context(), tag)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirps")
+		return
+	}
+
+	visibility, err := cfg.visibilityForRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirps")
+		return
+	}
+
+	visible := []database.Chirp{}
+	for _, dbChirp := range dbChirps {
+		if visibility.ShowChirpInFeed(dbChirp) {
+			visible = append(visible, dbChirp)
+		}
+	}
+	if !checkNotModified(w, r, chirpsVersion(visible), time.Time{}) {
+		return
+	}
+
+	chirps := make([]Chirp, 0, len(visible))
+	for _, dbChirp := range visible {
+		chirps = append(chirps, cfg.newChirp(r.Context(), dbChirp))
+	}
+
+	respondWithList(w, r, http.StatusOK, chirps)
+}
+
+func (cfg *apiConfig) handlerHashtagsTrending(w http.ResponseWriter, r *http.Request) {
+	type trendingTag struct {
+		Tag   string `json:"tag"`
+		Count int    `json:"count"`
+	}
+
+	window := 24 * time.Hour
+	if v := r.URL.Query().Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			respondWithError(w, http.StatusBadRequest, "Invalid window")
+			return
+		}
+		window = d
+	}
+
+	limit := 10
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 100 {
+			respondWithError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		limit = n
+	}
+
+	counts, err := cfg.DB.TrendingHashtags(r.Context(), time.Now().Add(-window), limit)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve hashtags")
+		return
+	}
+	setCacheControl(w, r)
+
+	trending := make([]trendingTag, 0, len(counts))
+	for _, c := range counts {
+		trending = append(trending, trendingTag{Tag: c.Tag, Count: c.Count})
+	}
+
+	respondWithJSON(w, http.StatusOK, trending)
+}
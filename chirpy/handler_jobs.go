@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/database"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/jobs"
+)
+
+// Job is a maintenance job and its most recent runs, newest first.
+type Job struct {
+	Name     string     `json:"name"`
+	Schedule string     `json:"schedule"`
+	Running  bool       `json:"running"`
+	NextRun  *time.Time `json:"next_run"`
+	Runs     []JobRun   `json:"runs"`
+}
+
+type JobRun struct {
+	StartedAt  time.Time `json:"started_at"`
+	DurationMS int64     `json:"duration_ms"`
+	// Trigger is "schedule" or "manual".
+	Trigger string `json:"trigger"`
+	Result  string `json:"result,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+func newJob(status jobs.Status) Job {
+	job := Job{
+		Name:     status.Name,
+		Schedule: status.Schedule,
+		Running:  status.Running,
+		Runs:     []JobRun{},
+	}
+	if !status.NextRun.IsZero() {
+		next := status.NextRun.UTC()
+		job.NextRun = &next
+	}
+	for _, run := range status.Runs {
+		jobRun := JobRun{
+			StartedAt:  run.StartedAt.UTC(),
+			DurationMS: run.Duration.Milliseconds(),
+			Trigger:    "schedule",
+			Result:     run.Result,
+		}
+		if run.Manual {
+			jobRun.Trigger = "manual"
+		}
+		if run.Err != nil {
+			jobRun.Error = run.Err.Error()
+		}
+		job.Runs = append(job.Runs, jobRun)
+	}
+	return job
+}
+
+func (cfg *apiConfig) handlerJobsGet(w http.ResponseWriter, r *http.Request) {
+	_, err := cfg.moderatorFromRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	list := []Job{}
+	for _, status := range cfg.jobs.Jobs() {
+		list = append(list, newJob(status))
+	}
+	respondWithJSON(w, http.StatusOK, list)
+}
+
+// handlerJobRun starts a job now. It doesn't wait for the run to finish;
+// its outcome shows up in the job's runs.
+func (cfg *apiConfig) handlerJobRun(w http.ResponseWriter, r *http.Request) {
+	moderator, err := cfg.moderatorFromRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	name := r.PathValue("name")
+	err = cfg.jobs.Trigger(name)
+	switch {
+	case errors.Is(err, jobs.ErrUnknownJob):
+		respondWithError(w, http.StatusNotFound, "Couldn't get job")
+		return
+	case errors.Is(err, jobs.ErrRunning):
+		respondWithError(w, http.StatusConflict, "The job is already running")
+		return
+	case err != nil:
+		respondWithError(w, http.StatusServiceUnavailable, "Jobs aren't running")
+		return
+	}
+	cfg.audit(r, database.AuditJobRun, moderator.ID, 0, map[string]string{"job": name})
+
+	for _, status := range cfg.jobs.Jobs() {
+		if status.Name == name {
+			respondWithJSON(w, http.StatusAccepted, newJob(status))
+			return
+		}
+	}
+}
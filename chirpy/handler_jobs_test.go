@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/auth"
+)
+
+func TestJobs(t *testing.T) {
+	cfg, mux := newTestAPI(t)
+	ctx := context.Background()
+	cfg.settings.Load().moderatorEmails["mod@example.com"] = struct{}{}
+
+	var tokens []string
+	for _, email := range []string{"mod@example.com", "user@example.com"} {
+		user, err := cfg.DB.CreateUser(ctx, email, "hash")
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := auth.MakeJWT(user.ID, cfg.jwtSecret, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens = append(tokens, token)
+	}
+	if err := cfg.DB.SaveRefreshToken(ctx, 1, "expired", -time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.DB.SaveRefreshToken(ctx, 1, "current", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		cfg.jobs.Run(runCtx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	send := func(token, method, path string) *httptest.ResponseRecorder {
+		t.Helper()
+		r := httptest.NewRequest(method, path, nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := send(tokens[1], http.MethodGet, "/admin/jobs"); w.Code != http.StatusForbidden {
+		t.Errorf("expected jobs to be for moderators only, got %d", w.Code)
+	}
+	if w := send(tokens[0], http.MethodPost, "/admin/jobs/missing/run"); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown job, got %d", w.Code)
+	}
+
+	// the runner may not have started yet
+	var w *httptest.ResponseRecorder
+	for i := 0; i < 100; i++ {
+		w = send(tokens[0], http.MethodPost, "/admin/jobs/purge_refresh_tokens/run")
+		if w.Code != http.StatusServiceUnavailable {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected the job to start, got %d %s", w.Code, w.Body)
+	}
+
+	var job Job
+	for i := 0; i < 100; i++ {
+		var jobs []Job
+		if err := json.Unmarshal(send(tokens[0], http.MethodGet, "/admin/jobs").Body.Bytes(), &jobs); err != nil {
+			t.Fatal(err)
+		}
+		for _, j := range jobs {
+			if j.Name == "purge_refresh_tokens" {
+				job = j
+			}
+		}
+		if len(job.Runs) > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(job.Runs) != 1 || job.Runs[0].Trigger != "manual" || job.Runs[0].Error != "" || job.NextRun == nil {
+		t.Fatalf("expected one successful manual run, got %+v", job)
+	}
+
+	if n, _ := cfg.DB.CountActiveSessions(ctx); n != 1 {
+		t.Errorf("expected the current token to survive, have %d sessions", n)
+	}
+	if n, err := cfg.DB.PurgeExpiredRefreshTokens(ctx, time.Now().Add(2*time.Hour)); err != nil || n != 1 {
+		t.Errorf("expected the expired token to have been purged already, purged %d more %v", n, err)
+	}
+}
@@ -1,13 +1,22 @@
 package main
 
 import (
-	"encoding/json"
+	"errors"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/auth"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/database"
 )
 
+// dummyPasswordHash is checked against when the email is unknown, so that
+// takes as long as a wrong password does.
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, _ := auth.HashPassword("not anyone's password")
+	return hash
+})
+
 func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
 		Password string `json:"password"`
@@ -19,30 +28,51 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		RefreshToken string `json:"refresh_token"`
 	}
 
-	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
-	err := decoder.Decode(&params)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters")
+	if !decodeJSON(w, r, &params) {
+		return
+	}
+
+	v := validator{}
+	v.check(params.Email != "", "email", "required", "is required")
+	v.check(params.Password != "", "password", "required", "is required")
+	if !v.valid() {
+		respondWithValidationErrors(w, v.errs)
 		return
 	}
 
-	user, err := cfg.DB.GetUserByEmail(params.Email)
+	// an unknown email and a wrong password get the same response, after
+	// the same bcrypt work, so login can't be used to find out who has an
+	// account
+	user, err := cfg.DB.GetUserByEmail(r.Context(), params.Email)
 	if err != nil {
+		if errors.Is(err, database.ErrNotExist) {
+			checkPasswordHash(r.Context(), params.Password, dummyPasswordHash())
+			cfg.audit(r, database.AuditLoginFailed, 0, 0, map[string]string{"reason": "unknown_email"})
+			respondWithErrorCode(w, http.StatusUnauthorized, "invalid_credentials", "Incorrect email or password")
+			return
+		}
 		respondWithError(w, http.StatusInternalServerError, "Couldn't get user")
 		return
 	}
 
-	err = auth.CheckPasswordHash(params.Password, user.HashedPassword)
+	err = checkPasswordHash(r.Context(), params.Password, user.HashedPassword)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Invalid password")
+		cfg.audit(r, database.AuditLoginFailed, 0, user.ID, map[string]string{"reason": "wrong_password"})
+		respondWithErrorCode(w, http.StatusUnauthorized, "invalid_credentials", "Incorrect email or password")
+		return
+	}
+
+	if user.IsSuspended() {
+		cfg.audit(r, database.AuditLoginFailed, 0, user.ID, map[string]string{"reason": "suspended"})
+		respondWithErrorCode(w, http.StatusForbidden, "account_suspended", "Account is suspended until "+user.SuspendedUntil.Format(time.RFC3339))
 		return
 	}
 
 	accessToken, err := auth.MakeJWT(
 		user.ID,
 		cfg.jwtSecret,
-		time.Hour,
+		cfg.settings.Load().accessTokenTTL,
 	)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't create access JWT")
@@ -55,17 +85,20 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = cfg.DB.SaveRefreshToken(user.ID, refreshToken)
+	err = cfg.DB.SaveRefreshToken(r.Context(), user.ID, refreshToken, cfg.settings.Load().refreshTokenTTL)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't save refresh token")
 		return
 	}
+	cfg.audit(r, database.AuditLogin, user.ID, user.ID, nil)
 
 	respondWithJSON(w, http.StatusOK, response{
 		User: User{
 			ID:          user.ID,
 			Email:       user.Email,
 			IsChirpyRed: user.IsChirpyRed,
+			Handle:      user.Handle,
+			DisplayName: user.DisplayName,
 		},
 		Token:        accessToken,
 		RefreshToken: refreshToken,
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/auth"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/blobstore"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/database"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/media"
+)
+
+const (
+	maxMediaSize     = 10 << 20
+	maxThumbnailSize = 256
+)
+
+type Media struct {
+	ID           int    `json:"id"`
+	ContentType  string `json:"content_type"`
+	Size         int64  `json:"size"`
+	URL          string `json:"url"`
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+}
+
+func newMedia(m database.Media) Media {
+	resp := Media{
+		ID:          m.ID,
+		ContentType: m.ContentType,
+		Size:        m.Size,
+		URL:         fmt.Sprintf(apiV1Prefix+"/media/%d", m.ID),
+	}
+	if m.ThumbnailKey != "" {
+		resp.ThumbnailURL = fmt.Sprintf(apiV1Prefix+"/media/%d/thumbnail", m.ID)
+	}
+	return resp
+}
+
+func (cfg *apiConfig) handlerMediaUpload(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	subject, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	userID, err := strconv.Atoi(subject)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "invalid userID in JWT subject")
+		return
+	}
+
+	// leave some room for the multipart framing around the file itself
+	r.Body = http.MaxBytesReader(w, r.Body, maxMediaSize+1<<20)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		respondWithError(w, http.StatusUnsupportedMediaType, "Content-Type must be multipart/form-data")
+		return
+	}
+
+	var part io.Reader
+	for {
+		p, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Couldn't read multipart body")
+			return
+		}
+		if p.FormName() == "file" {
+			part = p
+			break
+		}
+	}
+	if part == nil {
+		respondWithValidationErrors(w, []fieldError{{Field: "file", Code: "required", Message: "is required"}})
+		return
+	}
+
+	buffered := bufio.NewReaderSize(part, 512)
+	head, err := buffered.Peek(512)
+	if err != nil && err != io.EOF {
+		respondWithError(w, http.StatusBadRequest, "Couldn't read upload")
+		return
+	}
+	contentType, err := media.DetectContentType(head)
+	if err != nil {
+		respondWithError(w, http.StatusUnsupportedMediaType, err.Error())
+		return
+	}
+
+	// keep a copy of images we can thumbnail, everything else streams
+	// straight to the blob store
+	var src io.Reader = io.LimitReader(buffered, maxMediaSize+1)
+	imageBuf := &bytes.Buffer{}
+	if media.CanThumbnail(contentType) {
+		src = io.TeeReader(src, imageBuf)
+	}
+
+	key, size, err := cfg.blobs.Put(src)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			respondWithError(w, http.StatusRequestEntityTooLarge, "Upload is too large")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't store upload")
+		return
+	}
+	if size > maxMediaSize {
+		cfg.discardBlobs(r.Context(), key)
+		respondWithError(w, http.StatusRequestEntityTooLarge, "Upload is too large")
+		return
+	}
+
+	dbMedia := database.Media{
+		OwnerID:     userID,
+		BlobKey:     key,
+		ContentType: contentType,
+		Size:        size,
+	}
+
+	if media.CanThumbnail(contentType) {
+		thumb, _, err := media.Thumbnail(imageBuf.Bytes(), maxThumbnailSize)
+		if errors.Is(err, media.ErrTooManyPixels) {
+			cfg.discardBlobs(r.Context(), key)
+			respondWithError(w, http.StatusUnprocessableEntity, fmt.Sprintf("Image must have at most %d pixels", media.MaxPixels))
+			return
+		}
+		if err != nil {
+			cfg.discardBlobs(r.Context(), key)
+			respondWithError(w, http.StatusUnprocessableEntity, "Couldn't decode image")
+			return
+		}
+		thumbKey, _, err := cfg.blobs.Put(bytes.NewReader(thumb))
+		if err != nil {
+			cfg.discardBlobs(r.Context(), key)
+			respondWithError(w, http.StatusInternalServerError, "Couldn't store thumbnail")
+			return
+		}
+		dbMedia.ThumbnailKey = thumbKey
+	}
+
+	created, err := cfg.DB.CreateMedia(r.Context(), dbMedia)
+	if err != nil {
+		cfg.discardBlobs(r.Context(), dbMedia.BlobKey, dbMedia.ThumbnailKey)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save media")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, newMedia(created))
+}
+
+// discardBlobs deletes the blobs stored for an upload that failed, so
+// they aren't left on disk with nothing referring to them. Blobs that
+// other media share are kept.
+func (cfg *apiConfig) discardBlobs(ctx context.Context, keys ...string) {
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		inUse, err := cfg.DB.BlobInUse(ctx, key)
+		if err == nil && !inUse {
+			err = cfg.blobs.Delete(key)
+		}
+		if err != nil {
+			slog.Error("Couldn't delete blob of failed upload", "blob", key, "error", err)
+		}
+	}
+}
+
+func (cfg *apiConfig) handlerMediaGet(w http.ResponseWriter, r *http.Request) {
+	cfg.serveMedia(w, r, false)
+}
+
+func (cfg *apiConfig) handlerMediaThumbnail(w http.ResponseWriter, r *http.Request) {
+	cfg.serveMedia(w, r, true)
+}
+
+func (cfg *apiConfig) serveMedia(w http.ResponseWriter, r *http.Request, thumbnail bool) {
+	mediaID, err := strconv.Atoi(r.PathValue("mediaID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid media ID")
+		return
+	}
+
+	dbMedia, err := cfg.DB.GetMedia(r.Context(), mediaID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get media")
+		return
+	}
+
+	key, contentType := dbMedia.BlobKey, dbMedia.ContentType
+	if thumbnail {
+		if dbMedia.ThumbnailKey == "" {
+			respondWithError(w, http.StatusNotFound, "Media has no thumbnail")
+			return
+		}
+		key, contentType = dbMedia.ThumbnailKey, ""
+	}
+
+	blob, err := cfg.blobs.Open(key)
+	if err != nil {
+		if errors.Is(err, blobstore.ErrNotExist) {
+			respondWithError(w, http.StatusNotFound, "Couldn't get media")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't open media")
+		return
+	}
+	defer blob.Close()
+
+	// blobs are content addressed so they never change under a given key
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	http.ServeContent(w, r, "", dbMedia.CreatedAt, blob)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"testing"
+	"time"
+
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/auth"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/blobstore"
+)
+
+// testPNG encodes a w×h PNG. If claimW and claimH are set, the header is
+// then rewritten to claim those dimensions instead.
+func testPNG(t *testing.T, w, h, claimW, claimH int) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, image.NewGray(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+	dat := buf.Bytes()
+	if claimW != 0 {
+		// the IHDR chunk follows the 8 byte signature: length, type, then
+		// width and height, and its CRC covers the type and data
+		binary.BigEndian.PutUint32(dat[16:], uint32(claimW))
+		binary.BigEndian.PutUint32(dat[20:], uint32(claimH))
+		binary.BigEndian.PutUint32(dat[29:], crc32.ChecksumIEEE(dat[12:29]))
+	}
+	return dat
+}
+
+func TestMediaUpload(t *testing.T) {
+	cfg, mux := newTestAPI(t)
+	user, err := cfg.DB.CreateUser(context.Background(), "alice@example.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := auth.MakeJWT(user.ID, cfg.jwtSecret, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oversized := append(testPNG(t, 1, 1, 0, 0), make([]byte, maxMediaSize)...)
+	for _, tt := range []struct {
+		name string
+		// claimed is the Content-Type the client sends for the part
+		claimed     string
+		file        []byte
+		want        int
+		contentType string
+	}{
+		{"sniffed png", "text/plain", testPNG(t, 400, 200, 0, 0), http.StatusCreated, "image/png"},
+		{"sniffed text", "image/png", []byte("just some text, honest"), http.StatusUnsupportedMediaType, ""},
+		{"too large", "image/png", oversized, http.StatusRequestEntityTooLarge, ""},
+		{"too many pixels", "image/png", testPNG(t, 1, 1, 100_000, 100_000), http.StatusUnprocessableEntity, ""},
+		{"undecodable", "image/png", testPNG(t, 8, 8, 0, 0)[:60], http.StatusUnprocessableEntity, ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			body := &bytes.Buffer{}
+			mw := multipart.NewWriter(body)
+			part, err := mw.CreatePart(textproto.MIMEHeader{
+				"Content-Disposition": {`form-data; name="file"; filename="upload"`},
+				"Content-Type":        {tt.claimed},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			part.Write(tt.file)
+			mw.Close()
+
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/media", body)
+			r.Header.Set("Content-Type", mw.FormDataContentType())
+			r.Header.Set("Authorization", "Bearer "+token)
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("expected %d, got %d %s", tt.want, w.Code, w.Body)
+			}
+
+			sum := sha256.Sum256(tt.file)
+			blob, err := cfg.blobs.Open(hex.EncodeToString(sum[:]))
+			if tt.want != http.StatusCreated {
+				if !errors.Is(err, blobstore.ErrNotExist) {
+					t.Errorf("expected the rejected upload not to be kept, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected the upload to be stored: %v", err)
+			}
+			blob.Close()
+
+			var m Media
+			if err := json.Unmarshal(w.Body.Bytes(), &m); err != nil {
+				t.Fatal(err)
+			}
+			if m.ContentType != tt.contentType || m.ThumbnailURL == "" {
+				t.Errorf("expected a %s with a thumbnail, got %+v", tt.contentType, m)
+			}
+		})
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/database"
+)
+
+const maxSuspension = 365 * 24 * time.Hour
+
+func (cfg *apiConfig) handlerReportsCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Reason  string `json:"reason"`
+		Details string `json:"details"`
+	}
+
+	userID, err := cfg.userIDFromRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	chirpID, err := strconv.Atoi(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
+	}
+
+	params := parameters{}
+	if !decodeJSON(w, r, &params) {
+		return
+	}
+
+	reason := database.ReportReason(params.Reason)
+	if _, ok := database.ValidReportReasons[reason]; !ok {
+		respondWithValidationErrors(w, []fieldError{{Field: "reason", Code: "invalid", Message: "is not a valid report reason"}})
+		return
+	}
+
+	report, err := cfg.DB.CreateReport(r.Context(), chirpID, userID, reason, params.Details)
+	if err != nil {
+		if errors.Is(err, database.ErrNotExist) {
+			respondWithError(w, http.StatusNotFound, "Couldn't get chirp")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create report")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, report)
+}
+
+func (cfg *apiConfig) handlerModerationReports(w http.ResponseWriter, r *http.Request) {
+	_, err := cfg.moderatorFromRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	status := database.ReportStatus(r.URL.Query().Get("status"))
+	if status == "" {
+		status = database.ReportOpen
+	}
+	if status == "all" {
+		status = ""
+	}
+
+	reports, err := cfg.DB.GetReports(r.Context(), status)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve reports")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, reports)
+}
+
+func (cfg *apiConfig) handlerModerationAction(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Action   string `json:"action"`
+		Reason   string `json:"reason"`
+		Duration string `json:"duration"`
+	}
+
+	moderator, err := cfg.moderatorFromRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	reportID, err := strconv.Atoi(r.PathValue("reportID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid report ID")
+		return
+	}
+
+	params := parameters{}
+	if !decodeJSON(w, r, &params) {
+		return
+	}
+
+	v := validator{}
+	v.check(params.Reason != "", "reason", "required", "is required")
+	actionType := database.ModerationActionType(params.Action)
+	var suspendFor time.Duration
+	switch actionType {
+	case database.ActionHide, database.ActionDelete, database.ActionDismiss:
+	case database.ActionSuspend:
+		suspendFor, err = time.ParseDuration(params.Duration)
+		v.check(err == nil && suspendFor > 0 && suspendFor <= maxSuspension, "duration", "invalid", fmt.Sprintf("must be a positive duration of at most %dh", int(maxSuspension.Hours())))
+	default:
+		v.add("action", "invalid", "must be hide, delete, dismiss or suspend")
+	}
+	if !v.valid() {
+		respondWithValidationErrors(w, v.errs)
+		return
+	}
+
+	action, err := cfg.DB.ResolveReport(r.Context(), reportID, moderator.ID, actionType, params.Reason, suspendFor)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrNotExist):
+			respondWithError(w, http.StatusNotFound, "Couldn't get report")
+		case errors.Is(err, database.ErrAlreadyResolved):
+			respondWithError(w, http.StatusConflict, "Report has already been resolved")
+		default:
+			respondWithError(w, http.StatusInternalServerError, "Couldn't apply action")
+		}
+		return
+	}
+
+	details := map[string]string{
+		"action":    string(action.Type),
+		"report_id": strconv.Itoa(reportID),
+		"reason":    action.Reason,
+	}
+	if action.ChirpID != 0 {
+		details["chirp_id"] = strconv.Itoa(action.ChirpID)
+	}
+	cfg.audit(r, database.AuditModerationAction, moderator.ID, action.TargetUserID, details)
+
+	respondWithJSON(w, http.StatusCreated, action)
+}
+
+func (cfg *apiConfig) handlerAppealsCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		ActionID int    `json:"action_id"`
+		Message  string `json:"message"`
+	}
+
+	userID, err := cfg.userIDFromRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	params := parameters{}
+	if !decodeJSON(w, r, &params) {
+		return
+	}
+
+	appeal, err := cfg.DB.CreateAppeal(r.Context(), params.ActionID, userID, params.Message)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrNotExist):
+			respondWithError(w, http.StatusNotFound, "Couldn't get moderation action")
+		case errors.Is(err, database.ErrNotAppealable):
+			respondWithValidationErrors(w, []fieldError{{Field: "action_id", Code: "not_appealable", Message: err.Error()}})
+		case errors.Is(err, database.ErrAlreadyExists):
+			respondWithError(w, http.StatusConflict, "This action has already been appealed")
+		default:
+			respondWithError(w, http.StatusInternalServerError, "Couldn't create appeal")
+		}
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, appeal)
+}
+
+func (cfg *apiConfig) handlerModerationAppeals(w http.ResponseWriter, r *http.Request) {
+	_, err := cfg.moderatorFromRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	status := database.AppealStatus(r.URL.Query().Get("status"))
+	if status == "" {
+		status = database.AppealOpen
+	}
+	if status == "all" {
+		status = ""
+	}
+
+	appeals, err := cfg.DB.GetAppeals(r.Context(), status)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve appeals")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, appeals)
+}
+
+func (cfg *apiConfig) handlerModerationAppealResolve(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Decision   string `json:"decision"`
+		Resolution string `json:"resolution"`
+	}
+
+	moderator, err := cfg.moderatorFromRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	appealID, err := strconv.Atoi(r.PathValue("appealID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid appeal ID")
+		return
+	}
+
+	params := parameters{}
+	if !decodeJSON(w, r, &params) {
+		return
+	}
+
+	var overturn bool
+	switch database.AppealStatus(params.Decision) {
+	case database.AppealUpheld:
+	case database.AppealOverturned:
+		overturn = true
+	default:
+		respondWithValidationErrors(w, []fieldError{{Field: "decision", Code: "invalid", Message: "must be upheld or overturned"}})
+		return
+	}
+
+	appeal, err := cfg.DB.ResolveAppeal(r.Context(), appealID, moderator.ID, overturn, params.Resolution)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrNotExist):
+			respondWithError(w, http.StatusNotFound, "Couldn't get appeal")
+		case errors.Is(err, database.ErrAlreadyResolved):
+			respondWithError(w, http.StatusConflict, "Appeal has already been resolved")
+		default:
+			respondWithError(w, http.StatusInternalServerError, "Couldn't resolve appeal")
+		}
+		return
+	}
+
+	cfg.audit(r, database.AuditAppealResolved, moderator.ID, appeal.UserID, map[string]string{
+		"appeal_id": strconv.Itoa(appeal.ID),
+		"action_id": strconv.Itoa(appeal.ActionID),
+		"decision":  string(appeal.Status),
+	})
+
+	respondWithJSON(w, http.StatusOK, appeal)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/database"
+)
+
+func TestModerationWorkflow(t *testing.T) {
+	cfg, mux := newTestAPI(t)
+	ctx := context.Background()
+	cfg.settings.Load().moderatorEmails["mod@example.com"] = struct{}{}
+
+	send := func(authorization, method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		if body != "" {
+			r.Header.Set("Content-Type", "application/json")
+		}
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+	decode := func(w *httptest.ResponseRecorder, v any) {
+		t.Helper()
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatalf("%v: %d %s", err, w.Code, w.Body)
+		}
+	}
+	login := func(email string) *httptest.ResponseRecorder {
+		t.Helper()
+		return send("", http.MethodPost, "/api/v1/login", `{"email":"`+email+`","password":"hunter22"}`)
+	}
+	var tokens, refreshTokens []string
+	for _, email := range []string{"mod@example.com", "alice@example.com", "bob@example.com"} {
+		if w := send("", http.MethodPost, "/api/v1/users", `{"email":"`+email+`","password":"hunter22"}`); w.Code != http.StatusCreated {
+			t.Fatalf("couldn't create %s: %d %s", email, w.Code, w.Body)
+		}
+		var res struct {
+			Token        string `json:"token"`
+			RefreshToken string `json:"refresh_token"`
+		}
+		decode(login(email), &res)
+		tokens = append(tokens, "Bearer "+res.Token)
+		refreshTokens = append(refreshTokens, "Bearer "+res.RefreshToken)
+	}
+	mod, alice, bob := tokens[0], tokens[1], tokens[2]
+
+	if w := send(alice, http.MethodPost, "/api/v1/chirps", `{"body":"buy my stuff"}`); w.Code != http.StatusCreated {
+		t.Fatalf("couldn't chirp: %d %s", w.Code, w.Body)
+	}
+
+	for _, tt := range []struct {
+		name string
+		path string
+		body string
+		want int
+	}{
+		{"valid", "/api/v1/chirps/1/reports", `{"reason":"spam","details":"again"}`, http.StatusCreated},
+		{"unknown reason", "/api/v1/chirps/1/reports", `{"reason":"boring"}`, http.StatusUnprocessableEntity},
+		{"missing chirp", "/api/v1/chirps/99/reports", `{"reason":"spam"}`, http.StatusNotFound},
+	} {
+		if w := send(bob, http.MethodPost, tt.path, tt.body); w.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d %s", tt.name, tt.want, w.Code, w.Body)
+		}
+	}
+
+	if w := send(bob, http.MethodGet, "/api/v1/moderation/reports", ""); w.Code != http.StatusForbidden {
+		t.Errorf("expected the queue to be for moderators only, got %d", w.Code)
+	}
+	var reports []database.Report
+	decode(send(mod, http.MethodGet, "/api/v1/moderation/reports", ""), &reports)
+	if len(reports) != 1 || reports[0].AuthorID != 2 || reports[0].ReporterID != 3 || reports[0].Status != database.ReportOpen {
+		t.Fatalf("expected bob's report in the queue, got %+v", reports)
+	}
+
+	w := send(mod, http.MethodPost, "/api/v1/moderation/reports/1/actions", `{"action":"suspend","reason":"spam","duration":"24h"}`)
+	var action database.ModerationAction
+	decode(w, &action)
+	if w.Code != http.StatusCreated || action.Type != database.ActionSuspend || action.ModeratorID != 1 || action.SuspendedUntil == nil {
+		t.Fatalf("expected a suspension, got %d %s", w.Code, w.Body)
+	}
+	if w := send(mod, http.MethodPost, "/api/v1/moderation/reports/1/actions", `{"action":"dismiss","reason":"oops"}`); w.Code != http.StatusConflict {
+		t.Errorf("expected 409 resolving a report twice, got %d", w.Code)
+	}
+	decode(send(mod, http.MethodGet, "/api/v1/moderation/reports", ""), &reports)
+	if len(reports) != 0 {
+		t.Errorf("expected the queue to be empty, got %+v", reports)
+	}
+
+	// suspended users can't log in, keep their sessions or chirp
+	var p problem
+	w = login("alice@example.com")
+	decode(w, &p)
+	if w.Code != http.StatusForbidden || p.Code != "account_suspended" {
+		t.Errorf("expected login to be refused, got %d %s", w.Code, w.Body)
+	}
+	if w := send(refreshTokens[1], http.MethodPost, "/api/v1/refresh", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected the suspension to revoke refresh tokens, got %d", w.Code)
+	}
+	if w := send(refreshTokens[2], http.MethodPost, "/api/v1/refresh", ""); w.Code != http.StatusOK {
+		t.Errorf("expected other users' sessions to survive, got %d", w.Code)
+	}
+	if err := cfg.DB.SaveRefreshToken(ctx, 2, "sneaky", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if w := send("Bearer sneaky", http.MethodPost, "/api/v1/refresh", ""); w.Code != http.StatusForbidden {
+		t.Errorf("expected refresh to be refused while suspended, got %d", w.Code)
+	}
+	if w := send(alice, http.MethodPost, "/api/v1/chirps", `{"body":"still here"}`); w.Code != http.StatusForbidden {
+		t.Errorf("expected chirping to be refused, got %d", w.Code)
+	}
+
+	w = send(alice, http.MethodPost, "/api/v1/appeals", `{"action_id":1,"message":"it was a joke"}`)
+	var appeal database.Appeal
+	decode(w, &appeal)
+	if w.Code != http.StatusCreated || appeal.Status != database.AppealOpen {
+		t.Fatalf("expected an appeal, got %d %s", w.Code, w.Body)
+	}
+	if w := send(alice, http.MethodPost, "/api/v1/appeals", `{"action_id":1,"message":"please"}`); w.Code != http.StatusConflict {
+		t.Errorf("expected 409 appealing twice, got %d", w.Code)
+	}
+	if w := send(bob, http.MethodPost, "/api/v1/appeals", `{"action_id":1,"message":"me too"}`); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 appealing someone else's action, got %d", w.Code)
+	}
+
+	var appeals []database.Appeal
+	decode(send(mod, http.MethodGet, "/api/v1/moderation/appeals", ""), &appeals)
+	if len(appeals) != 1 || appeals[0].ID != appeal.ID {
+		t.Fatalf("expected the appeal in the queue, got %+v", appeals)
+	}
+	w = send(mod, http.MethodPost, "/api/v1/moderation/appeals/1/resolve", `{"decision":"overturned","resolution":"fair enough"}`)
+	decode(w, &appeal)
+	if w.Code != http.StatusOK || appeal.Status != database.AppealOverturned || appeal.ModeratorID != 1 {
+		t.Fatalf("expected the appeal to be overturned, got %d %s", w.Code, w.Body)
+	}
+
+	if w := login("alice@example.com"); w.Code != http.StatusOK {
+		t.Errorf("expected the overturned suspension to allow logging in, got %d %s", w.Code, w.Body)
+	}
+	if w := send(alice, http.MethodPost, "/api/v1/chirps", `{"body":"back again"}`); w.Code != http.StatusCreated {
+		t.Errorf("expected chirping to work again, got %d %s", w.Code, w.Body)
+	}
+}
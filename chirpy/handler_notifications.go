@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/database"
+)
+
+type Notification struct {
+	ID        int        `json:"id"`
+	Type      string     `json:"type"`
+	ActorID   int        `json:"actor_id"`
+	ChirpID   int        `json:"chirp_id,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	Read      bool       `json:"read"`
+	ReadAt    *time.Time `json:"read_at,omitempty"`
+}
+
+func (cfg *apiConfig) handlerNotificationsGet(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.userIDFromRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	unreadOnly := r.URL.Query().Get("unread") == "true"
+	dbNotifications, err := cfg.DB.GetNotifications(r.Context(), userID, unreadOnly)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve notifications")
+		return
+	}
+
+	notifications := make([]Notification, 0, len(dbNotifications))
+	for _, n := range dbNotifications {
+		notifications = append(notifications, Notification{
+			ID:        n.ID,
+			Type:      string(n.Type),
+			ActorID:   n.ActorID,
+			ChirpID:   n.ChirpID,
+			CreatedAt: n.CreatedAt,
+			Read:      n.ReadAt != nil,
+			ReadAt:    n.ReadAt,
+		})
+	}
+
+	respondWithJSON(w, http.StatusOK, notifications)
+}
+
+func (cfg *apiConfig) handlerNotificationRead(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.userIDFromRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	notificationID, err := strconv.Atoi(r.PathValue("notificationID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid notification ID")
+		return
+	}
+
+	err = cfg.DB.MarkNotificationsRead(r.Context(), userID, notificationID)
+	if err != nil {
+		if errors.Is(err, database.ErrNotExist) {
+			respondWithError(w, http.StatusNotFound, "Couldn't get notification")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update notification")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerNotificationsReadAll(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.userIDFromRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	err = cfg.DB.MarkNotificationsRead(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update notifications")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
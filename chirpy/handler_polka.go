@@ -1,10 +1,10 @@
 package main
 
 import (
-	"encoding/json"
 	"net/http"
 
 	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/auth"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/certs"
 	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/database"
 )
 
@@ -16,6 +16,13 @@ func (cfg *apiConfig) handlerPolkaWebhook(w http.ResponseWriter, r *http.Request
 		} `json:"data"`
 	}
 
+	if cfg.polkaRequireClientCert {
+		if _, err := certs.VerifiedClient(r.TLS); err != nil {
+			respondWithError(w, http.StatusUnauthorized, "client certificate required")
+			return
+		}
+	}
+
 	apiKey, err := auth.GetPolkaKey(r.Header)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "no api key provided")
@@ -26,11 +33,8 @@ func (cfg *apiConfig) handlerPolkaWebhook(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	decoder := json.NewDecoder(r.Body)
 	payload := polkaRequest{}
-	err = decoder.Decode(&payload)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters")
+	if !decodeJSON(w, r, &payload) {
 		return
 	}
 
@@ -39,7 +43,7 @@ func (cfg *apiConfig) handlerPolkaWebhook(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	_, err = cfg.DB.UpgradeUser(payload.Data.UserID)
+	_, err = cfg.DB.UpgradeUser(r.Context(), payload.Data.UserID)
 	if err != nil {
 		if err == database.ErrNotExist {
 			respondWithError(w, http.StatusNotFound, err.Error())
@@ -49,6 +53,8 @@ func (cfg *apiConfig) handlerPolkaWebhook(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	cfg.audit(r, database.AuditAccountUpgraded, 0, payload.Data.UserID, map[string]string{"source": "polka"})
+
 	respondWithJSON(w, http.StatusNoContent, nil)
 
 }
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/database"
+)
+
+const (
+	// handleCooldown is how long a handle stays reserved for its previous
+	// owner after they change it.
+	handleCooldown    = 30 * 24 * time.Hour
+	maxDisplayNameLen = 50
+	maxBioLen         = 160
+)
+
+var handlePattern = regexp.MustCompile(`^[A-Za-z0-9_]{3,15}$`)
+
+// reservedHandles can't be claimed by anyone, either because they collide
+// with routes under /api/users or could be used to impersonate staff.
+var reservedHandles = map[string]struct{}{
+	"admin":     {},
+	"api":       {},
+	"chirpy":    {},
+	"me":        {},
+	"moderator": {},
+	"root":      {},
+	"support":   {},
+	"system":    {},
+}
+
+// Profile is the public view of a user. It must never include the
+// user's email address.
+type Profile struct {
+	ID          int    `json:"id"`
+	Handle      string `json:"handle"`
+	DisplayName string `json:"display_name"`
+	Bio         string `json:"bio"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+	IsChirpyRed bool   `json:"is_chirpy_red"`
+}
+
+func (cfg *apiConfig) newProfile(user database.User) Profile {
+	profile := Profile{
+		ID:          user.ID,
+		Handle:      user.Handle,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		IsChirpyRed: user.IsChirpyRed,
+	}
+	if user.AvatarMediaID != 0 {
+		profile.AvatarURL = fmt.Sprintf(apiV1Prefix+"/media/%d", user.AvatarMediaID)
+	}
+	return profile
+}
+
+func (cfg *apiConfig) handlerProfileUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Handle        *string `json:"handle"`
+		DisplayName   *string `json:"display_name"`
+		Bio           *string `json:"bio"`
+		AvatarMediaID *int    `json:"avatar_media_id"`
+	}
+
+	userID, err := cfg.userIDFromRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	params := parameters{}
+	if !decodeJSON(w, r, &params) {
+		return
+	}
+
+	v := validator{}
+	if params.Handle != nil {
+		if err := validateHandle(*params.Handle); err != nil {
+			v.add("handle", "invalid", err.Error())
+		}
+	}
+	if params.DisplayName != nil {
+		v.check(utf8.RuneCountInString(*params.DisplayName) <= maxDisplayNameLen, "display_name", "too_long", fmt.Sprintf("must be at most %d characters", maxDisplayNameLen))
+	}
+	if params.Bio != nil {
+		v.check(utf8.RuneCountInString(*params.Bio) <= maxBioLen, "bio", "too_long", fmt.Sprintf("must be at most %d characters", maxBioLen))
+	}
+	if !v.valid() {
+		respondWithValidationErrors(w, v.errs)
+		return
+	}
+
+	user, err := cfg.DB.UpdateProfile(r.Context(), userID, database.ProfileUpdate{
+		Handle:        params.Handle,
+		DisplayName:   params.DisplayName,
+		Bio:           params.Bio,
+		AvatarMediaID: params.AvatarMediaID,
+	}, handleCooldown)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrHandleTaken):
+			respondWithErrorCode(w, http.StatusConflict, "handle_taken", "Handle is already taken")
+		case errors.Is(err, database.ErrInvalidMedia):
+			respondWithValidationErrors(w, []fieldError{{Field: "avatar_media_id", Code: "invalid", Message: "must be media you uploaded"}})
+		case errors.Is(err, database.ErrNotExist):
+			respondWithError(w, http.StatusNotFound, "Couldn't get user")
+		default:
+			respondWithError(w, http.StatusInternalServerError, "Couldn't update profile")
+		}
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, cfg.newProfile(user))
+}
+
+func (cfg *apiConfig) handlerProfileGet(w http.ResponseWriter, r *http.Request) {
+	user, err := cfg.userForHandle(r, r.PathValue("handle"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get user")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, cfg.newProfile(user))
+}
+
+func (cfg *apiConfig) handlerProfileChirps(w http.ResponseWriter, r *http.Request) {
+	user, err := cfg.userForHandle(r, r.PathValue("handle"))
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, "Couldn't get user")
+		return
+	}
+
+	dbChirps, err := cfg.DB.GetChirps(r.Context())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirps")
+		return
+	}
+
+	visibility, err := cfg.visibilityForRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirps")
+		return
+	}
+
+	visible := []database.Chirp{}
+	for _, dbChirp := range dbChirps {
+		if dbChirp.AuthorID == user.ID && visibility.CanSeeChirp(dbChirp) {
+			visible = append(visible, dbChirp)
+		}
+	}
+	sort.Slice(visible, func(i, j int) bool {
+		return visible[i].ID > visible[j].ID
+	})
+	if !checkNotModified(w, r, chirpsVersion(visible), time.Time{}) {
+		return
+	}
+
+	chirps := make([]Chirp, 0, len(visible))
+	for _, dbChirp := range visible {
+		chirps = append(chirps, cfg.newChirp(r.Context(), dbChirp))
+	}
+
+	respondWithList(w, r, http.StatusOK, chirps)
+}
+
+// userForHandle resolves a handle to a user, falling back to handles
+// given up within the cooldown so old links keep working. Users who have
+// blocked, or been blocked by, the requester are reported as not found.
+func (cfg *apiConfig) userForHandle(r *http.Request, handle string) (database.User, error) {
+	handle = strings.TrimPrefix(handle, "@")
+	user, err := cfg.DB.GetUserByHandle(r.Context(), handle)
+	if errors.Is(err, database.ErrNotExist) {
+		user, err = cfg.DB.GetUserByPreviousHandle(r.Context(), handle, handleCooldown)
+	}
+	if err != nil {
+		return database.User{}, err
+	}
+
+	visibility, err := cfg.visibilityForRequest(r)
+	if err != nil {
+		return database.User{}, err
+	}
+	if !visibility.CanSee(user.ID) {
+		return database.User{}, database.ErrNotExist
+	}
+	return user, nil
+}
+
+func validateHandle(handle string) error {
+	if !handlePattern.MatchString(handle) {
+		return errors.New("Handle must be 3-15 letters, digits or underscores")
+	}
+	if _, ok := reservedHandles[strings.ToLower(handle)]; ok {
+		return errors.New("Handle is reserved")
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/auth"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/database"
+)
+
+func TestProfiles(t *testing.T) {
+	cfg, mux := newTestAPI(t)
+	ctx := context.Background()
+
+	var tokens []string
+	for _, email := range []string{"alice@example.com", "bob@example.com"} {
+		user, err := cfg.DB.CreateUser(ctx, email, "hash")
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := auth.MakeJWT(user.ID, cfg.jwtSecret, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens = append(tokens, "Bearer "+token)
+	}
+	alice, bob := tokens[0], tokens[1]
+	for _, body := range []string{"older", "newer"} {
+		if _, err := cfg.DB.CreateChirp(ctx, database.CreateChirpParams{Body: body, AuthorID: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	send := func(authorization, method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		if body != "" {
+			r.Header.Set("Content-Type", "application/json")
+		}
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+
+	for _, tt := range []struct {
+		name          string
+		authorization string
+		body          string
+		want          int
+		// code is the problem code, or the field in error for a 422
+		code string
+	}{
+		{"set profile", alice, `{"handle":"Alice","display_name":"Alice A","bio":"hi"}`, http.StatusOK, ""},
+		{"taken ignoring case", bob, `{"handle":"alice"}`, http.StatusConflict, "handle_taken"},
+		{"too short", bob, `{"handle":"ab"}`, http.StatusUnprocessableEntity, "handle"},
+		{"bad characters", bob, `{"handle":"bob-b"}`, http.StatusUnprocessableEntity, "handle"},
+		{"reserved", bob, `{"handle":"Admin"}`, http.StatusUnprocessableEntity, "handle"},
+		{"bio too long", bob, `{"bio":"` + strings.Repeat("a", maxBioLen+1) + `"}`, http.StatusUnprocessableEntity, "bio"},
+		{"someone else's avatar", bob, `{"avatar_media_id":99}`, http.StatusUnprocessableEntity, "avatar_media_id"},
+		{"rename", alice, `{"handle":"alice2"}`, http.StatusOK, ""},
+		{"previous handle in cooldown", bob, `{"handle":"alice"}`, http.StatusConflict, "handle_taken"},
+		{"unauthenticated", "", `{"handle":"bob"}`, http.StatusUnauthorized, ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			w := send(tt.authorization, http.MethodPut, "/api/v1/users/me/profile", tt.body)
+			if w.Code != tt.want {
+				t.Fatalf("expected %d, got %d %s", tt.want, w.Code, w.Body)
+			}
+			if tt.code == "" {
+				return
+			}
+			var p problem
+			if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+				t.Fatal(err)
+			}
+			got := p.Code
+			if len(p.Errors) > 0 {
+				got = p.Errors[0].Field
+			}
+			if got != tt.code {
+				t.Errorf("expected %s, got %s", tt.code, w.Body)
+			}
+		})
+	}
+
+	user, err := cfg.DB.GetUser(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(user.HandleHistory) != 1 || user.HandleHistory[0].Handle != "Alice" {
+		t.Errorf("expected the old handle in the history, got %+v", user.HandleHistory)
+	}
+
+	// the old handle still leads to the profile during the cooldown
+	for _, path := range []string{"/api/v1/users/alice2", "/api/v1/users/@ALICE2", "/api/v1/users/alice"} {
+		w := send(bob, http.MethodGet, path, "")
+		var profile Profile
+		if err := json.Unmarshal(w.Body.Bytes(), &profile); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("%s: expected a profile, got %d %s", path, w.Code, w.Body)
+		}
+		if profile.ID != 1 || profile.Handle != "alice2" || profile.DisplayName != "Alice A" || profile.Bio != "hi" {
+			t.Errorf("%s: unexpected profile %+v", path, profile)
+		}
+		if strings.Contains(w.Body.String(), "example.com") {
+			t.Errorf("%s: expected the profile not to expose the email, got %s", path, w.Body)
+		}
+	}
+
+	w := send("", http.MethodGet, "/api/v1/users/alice2/chirps", "")
+	var chirps []Chirp
+	if err := json.Unmarshal(w.Body.Bytes(), &chirps); err != nil {
+		t.Fatalf("%v: %d %s", err, w.Code, w.Body)
+	}
+	if len(chirps) != 2 || chirps[0].Body != "newer" || chirps[1].Body != "older" {
+		t.Errorf("expected alice's chirps newest first, got %+v", chirps)
+	}
+
+	if err := cfg.DB.BlockUser(ctx, 1, 2); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/api/v1/users/alice2", "/api/v1/users/alice2/chirps", "/api/v1/users/nobody"} {
+		if w := send(bob, http.MethodGet, path, ""); w.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404 for a blocked or unknown user, got %d", path, w.Code)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/auth"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/database"
 )
 
 func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
@@ -18,16 +19,20 @@ func (cfg *apiConfig) handlerRefresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := cfg.DB.UserForRefreshToken(refreshToken)
+	user, err := cfg.DB.UserForRefreshToken(r.Context(), refreshToken)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Couldn't get user for refresh token")
 		return
 	}
+	if user.IsSuspended() {
+		respondWithErrorCode(w, http.StatusForbidden, "account_suspended", "Account is suspended until "+user.SuspendedUntil.Format(time.RFC3339))
+		return
+	}
 
 	accessToken, err := auth.MakeJWT(
 		user.ID,
 		cfg.jwtSecret,
-		time.Hour,
+		cfg.settings.Load().accessTokenTTL,
 	)
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Couldn't validate token")
@@ -46,11 +51,14 @@ func (cfg *apiConfig) handlerRevoke(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = cfg.DB.RevokeRefreshToken(refreshToken)
+	userID, err := cfg.DB.RevokeRefreshToken(r.Context(), refreshToken)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't revoke session")
 		return
 	}
+	if userID != 0 {
+		cfg.audit(r, database.AuditTokenRevoked, userID, userID, nil)
+	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/database"
+)
+
+type Relation struct {
+	UserID    int       `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (cfg *apiConfig) handlerBlocksCreate(w http.ResponseWriter, r *http.Request) {
+	cfg.createRelation(w, r, cfg.DB.BlockUser)
+}
+
+func (cfg *apiConfig) handlerBlocksDelete(w http.ResponseWriter, r *http.Request) {
+	cfg.deleteRelation(w, r, cfg.DB.UnblockUser)
+}
+
+func (cfg *apiConfig) handlerBlocksGet(w http.ResponseWriter, r *http.Request) {
+	cfg.listRelations(w, r, cfg.DB.GetBlockedUsers)
+}
+
+func (cfg *apiConfig) handlerMutesCreate(w http.ResponseWriter, r *http.Request) {
+	cfg.createRelation(w, r, cfg.DB.MuteUser)
+}
+
+func (cfg *apiConfig) handlerMutesDelete(w http.ResponseWriter, r *http.Request) {
+	cfg.deleteRelation(w, r, cfg.DB.UnmuteUser)
+}
+
+func (cfg *apiConfig) handlerMutesGet(w http.ResponseWriter, r *http.Request) {
+	cfg.listRelations(w, r, cfg.DB.GetMutedUsers)
+}
+
+func (cfg *apiConfig) handlerFollowsCreate(w http.ResponseWriter, r *http.Request) {
+	cfg.createRelation(w, r, func(ctx context.Context, followerID, followedID int) error {
+		followed, err := cfg.DB.FollowUser(ctx, followerID, followedID)
+		if err != nil {
+			return err
+		}
+		// only a new follow is news, following again is a no-op
+		if followed {
+			cfg.notify(ctx, followedID, database.NotificationFollowed, followerID, 0)
+		}
+		return nil
+	})
+}
+
+func (cfg *apiConfig) handlerFollowsDelete(w http.ResponseWriter, r *http.Request) {
+	cfg.deleteRelation(w, r, cfg.DB.UnfollowUser)
+}
+
+func (cfg *apiConfig) handlerFollowsGet(w http.ResponseWriter, r *http.Request) {
+	cfg.listRelations(w, r, cfg.DB.GetFollowedUsers)
+}
+
+func (cfg *apiConfig) handlerFollowersGet(w http.ResponseWriter, r *http.Request) {
+	cfg.listRelations(w, r, cfg.DB.GetFollowers)
+}
+
+func (cfg *apiConfig) createRelation(w http.ResponseWriter, r *http.Request, create func(ctx context.Context, fromID, toID int) error) {
+	type parameters struct {
+		UserID int `json:"user_id"`
+	}
+
+	userID, err := cfg.userIDFromRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	params := parameters{}
+	if !decodeJSON(w, r, &params) {
+		return
+	}
+	if params.UserID == 0 {
+		respondWithValidationErrors(w, []fieldError{{Field: "user_id", Code: "required", Message: "is required"}})
+		return
+	}
+
+	err = create(r.Context(), userID, params.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrSelfRelationship):
+			respondWithValidationErrors(w, []fieldError{{Field: "user_id", Code: "self", Message: err.Error()}})
+		case errors.Is(err, database.ErrNotExist):
+			respondWithError(w, http.StatusNotFound, "Couldn't get user")
+		case errors.Is(err, database.ErrBlocked):
+			respondWithError(w, http.StatusForbidden, "You can't follow this user")
+		default:
+			respondWithError(w, http.StatusInternalServerError, "Couldn't save relationship")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) deleteRelation(w http.ResponseWriter, r *http.Request, remove func(ctx context.Context, fromID, toID int) error) {
+	userID, err := cfg.userIDFromRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	otherID, err := strconv.Atoi(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	err = remove(r.Context(), userID, otherID)
+	if err != nil {
+		if errors.Is(err, database.ErrNotExist) {
+			respondWithError(w, http.StatusNotFound, "No such relationship")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't remove relationship")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) listRelations(w http.ResponseWriter, r *http.Request, list func(ctx context.Context, userID int) ([]database.Relation, error)) {
+	userID, err := cfg.userIDFromRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	dbRelations, err := list(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve relationships")
+		return
+	}
+
+	relations := make([]Relation, 0, len(dbRelations))
+	for _, rel := range dbRelations {
+		relations = append(relations, Relation(rel))
+	}
+
+	respondWithJSON(w, http.StatusOK, relations)
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/auth"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/database"
+)
+
+func TestFollows(t *testing.T) {
+	cfg, mux := newTestAPI(t)
+	ctx := context.Background()
+
+	var tokens []string
+	for _, email := range []string{"alice@example.com", "bob@example.com", "carol@example.com"} {
+		user, err := cfg.DB.CreateUser(ctx, email, "hash")
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := auth.MakeJWT(user.ID, cfg.jwtSecret, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens = append(tokens, "Bearer "+token)
+	}
+	alice, bob, carol := tokens[0], tokens[1], tokens[2]
+
+	send := func(authorization, method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		if body != "" {
+			r.Header.Set("Content-Type", "application/json")
+		}
+		r.Header.Set("Authorization", authorization)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+	relations := func(authorization, path string) []int {
+		t.Helper()
+		w := send(authorization, http.MethodGet, path, "")
+		var list []Relation
+		if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+			t.Fatalf("%v: %d %s", err, w.Code, w.Body)
+		}
+		ids := []int{}
+		for _, rel := range list {
+			ids = append(ids, rel.UserID)
+		}
+		return ids
+	}
+
+	for _, tt := range []struct {
+		name          string
+		authorization string
+		method        string
+		path          string
+		body          string
+		want          int
+	}{
+		{"follow", alice, http.MethodPost, "/api/v1/follows", `{"user_id":2}`, http.StatusNoContent},
+		{"follow again", alice, http.MethodPost, "/api/v1/follows", `{"user_id":2}`, http.StatusNoContent},
+		{"followed back", bob, http.MethodPost, "/api/v1/follows", `{"user_id":1}`, http.StatusNoContent},
+		{"another follower", carol, http.MethodPost, "/api/v1/follows", `{"user_id":2}`, http.StatusNoContent},
+		{"self", alice, http.MethodPost, "/api/v1/follows", `{"user_id":1}`, http.StatusUnprocessableEntity},
+		{"missing user_id", alice, http.MethodPost, "/api/v1/follows", `{}`, http.StatusUnprocessableEntity},
+		{"unknown user", alice, http.MethodPost, "/api/v1/follows", `{"user_id":99}`, http.StatusNotFound},
+		{"unauthenticated", "", http.MethodPost, "/api/v1/follows", `{"user_id":2}`, http.StatusUnauthorized},
+	} {
+		if w := send(tt.authorization, tt.method, tt.path, tt.body); w.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d %s", tt.name, tt.want, w.Code, w.Body)
+		}
+	}
+
+	if got := relations(alice, "/api/v1/follows"); len(got) != 1 || got[0] != 2 {
+		t.Errorf("expected alice to follow bob, got %v", got)
+	}
+	if got := relations(bob, "/api/v1/followers"); len(got) != 2 || got[0] != 3 || got[1] != 1 {
+		t.Errorf("expected carol then alice to follow bob, got %v", got)
+	}
+
+	// following again mustn't notify again
+	notifications, err := cfg.DB.GetNotifications(ctx, 2, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notifications) != 2 {
+		t.Fatalf("expected a notification per follower, got %+v", notifications)
+	}
+	for _, n := range notifications {
+		if n.Type != database.NotificationFollowed || n.ChirpID != 0 {
+			t.Errorf("expected a followed notification, got %+v", n)
+		}
+	}
+
+	if w := send(alice, http.MethodDelete, "/api/v1/follows/2", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("couldn't unfollow: %d %s", w.Code, w.Body)
+	}
+	if w := send(alice, http.MethodDelete, "/api/v1/follows/2", ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 unfollowing again, got %d", w.Code)
+	}
+	if got := relations(bob, "/api/v1/followers"); len(got) != 1 || got[0] != 3 {
+		t.Errorf("expected only carol to follow bob, got %v", got)
+	}
+	if got := relations(bob, "/api/v1/follows"); len(got) != 1 || got[0] != 1 {
+		t.Errorf("expected bob's own follow to survive, got %v", got)
+	}
+}
+
+func TestBlocksAndMutes(t *testing.T) {
+	cfg, mux := newTestAPI(t)
+	ctx := context.Background()
+
+	// alice, bob and carol each chirp once, so chirp IDs match user IDs
+	var tokens []string
+	for _, email := range []string{"alice@example.com", "bob@example.com", "carol@example.com"} {
+		user, err := cfg.DB.CreateUser(ctx, email, "hash")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := cfg.DB.CreateChirp(ctx, database.CreateChirpParams{Body: "hello", AuthorID: user.ID}); err != nil {
+			t.Fatal(err)
+		}
+		token, err := auth.MakeJWT(user.ID, cfg.jwtSecret, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens = append(tokens, "Bearer "+token)
+	}
+	alice, bob, carol := tokens[0], tokens[1], tokens[2]
+
+	send := func(authorization, method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		if body != "" {
+			r.Header.Set("Content-Type", "application/json")
+		}
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		return w
+	}
+
+	for _, follow := range []struct{ authorization, body string }{
+		{alice, `{"user_id":2}`},
+		{bob, `{"user_id":1}`},
+		{carol, `{"user_id":1}`},
+	} {
+		if w := send(follow.authorization, http.MethodPost, "/api/v1/follows", follow.body); w.Code != http.StatusNoContent {
+			t.Fatalf("couldn't follow: %d %s", w.Code, w.Body)
+		}
+	}
+	if w := send(bob, http.MethodPost, "/api/v1/blocks", `{"user_id":1}`); w.Code != http.StatusNoContent {
+		t.Fatalf("couldn't block: %d %s", w.Code, w.Body)
+	}
+	if w := send(carol, http.MethodPost, "/api/v1/mutes", `{"user_id":1}`); w.Code != http.StatusNoContent {
+		t.Fatalf("couldn't mute: %d %s", w.Code, w.Body)
+	}
+
+	// blocking ends follows both ways, but leaves other users' alone
+	if followed, _ := cfg.DB.GetFollowedUsers(ctx, 1); len(followed) != 0 {
+		t.Errorf("expected the block to end alice's follow, got %+v", followed)
+	}
+	if followed, _ := cfg.DB.GetFollowedUsers(ctx, 2); len(followed) != 0 {
+		t.Errorf("expected the block to end bob's follow, got %+v", followed)
+	}
+	if followers, _ := cfg.DB.GetFollowers(ctx, 1); len(followers) != 1 || followers[0].UserID != 3 {
+		t.Errorf("expected carol to still follow alice, got %+v", followers)
+	}
+
+	for _, tt := range []struct {
+		name          string
+		authorization string
+		// list is what GET /chirps shows, visible what GET /chirps/{id} does
+		list    []int
+		visible []int
+	}{
+		{"anonymous", "", []int{1, 2, 3}, []int{1, 2, 3}},
+		{"blocked", alice, []int{1, 3}, []int{1, 3}},
+		{"blocker", bob, []int{2, 3}, []int{2, 3}},
+		{"muter", carol, []int{2, 3}, []int{1, 2, 3}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			w := send(tt.authorization, http.MethodGet, "/api/v1/chirps", "")
+			var chirps []Chirp
+			if err := json.Unmarshal(w.Body.Bytes(), &chirps); err != nil {
+				t.Fatalf("%v: %d %s", err, w.Code, w.Body)
+			}
+			list := []int{}
+			for _, c := range chirps {
+				list = append(list, c.ID)
+			}
+			if !slices.Equal(list, tt.list) {
+				t.Errorf("expected chirps %v, got %v", tt.list, list)
+			}
+
+			for id := 1; id <= 3; id++ {
+				want := http.StatusNotFound
+				if slices.Contains(tt.visible, id) {
+					want = http.StatusOK
+				}
+				if w := send(tt.authorization, http.MethodGet, "/api/v1/chirps/"+strconv.Itoa(id), ""); w.Code != want {
+					t.Errorf("chirp %d: expected %d, got %d", id, want, w.Code)
+				}
+			}
+		})
+	}
+
+	for _, tt := range []struct {
+		name          string
+		authorization string
+		method        string
+		path          string
+		body          string
+		want          int
+	}{
+		{"reply to blocker", alice, http.MethodPost, "/api/v1/chirps", `{"body":"hi","in_reply_to":2}`, http.StatusForbidden},
+		{"reply to blocked", bob, http.MethodPost, "/api/v1/chirps", `{"body":"hi","in_reply_to":1}`, http.StatusForbidden},
+		{"reply to muted", carol, http.MethodPost, "/api/v1/chirps", `{"body":"hi","in_reply_to":1}`, http.StatusCreated},
+		{"follow blocker", alice, http.MethodPost, "/api/v1/follows", `{"user_id":2}`, http.StatusForbidden},
+		{"follow blocked", bob, http.MethodPost, "/api/v1/follows", `{"user_id":1}`, http.StatusForbidden},
+		{"unblock", bob, http.MethodDelete, "/api/v1/blocks/1", "", http.StatusNoContent},
+		{"follow after unblock", alice, http.MethodPost, "/api/v1/follows", `{"user_id":2}`, http.StatusNoContent},
+		{"reply after unblock", alice, http.MethodPost, "/api/v1/chirps", `{"body":"hi","in_reply_to":2}`, http.StatusCreated},
+	} {
+		if w := send(tt.authorization, tt.method, tt.path, tt.body); w.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d %s", tt.name, tt.want, w.Code, w.Body)
+		}
+	}
+}
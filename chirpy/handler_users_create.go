@@ -1,11 +1,10 @@
 package main
 
 import (
-	"encoding/json"
 	"errors"
 	"net/http"
+	"net/mail"
 
-	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/auth"
 	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/database"
 )
 
@@ -14,6 +13,8 @@ type User struct {
 	Email       string `json:"email"`
 	Password    string `json:"-"`
 	IsChirpyRed bool   `json:"is_chirpy_red"`
+	Handle      string `json:"handle"`
+	DisplayName string `json:"display_name"`
 }
 
 func (cfg *apiConfig) handlerUsersCreate(w http.ResponseWriter, r *http.Request) {
@@ -25,30 +26,35 @@ func (cfg *apiConfig) handlerUsersCreate(w http.ResponseWriter, r *http.Request)
 		User
 	}
 
-	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
-	err := decoder.Decode(&params)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters")
+	if !decodeJSON(w, r, &params) {
+		return
+	}
+
+	v := validator{}
+	validateCredentials(&v, params.Email, params.Password)
+	if !v.valid() {
+		respondWithValidationErrors(w, v.errs)
 		return
 	}
 
-	hashedPassword, err := auth.HashPassword(params.Password)
+	hashedPassword, err := hashPassword(r.Context(), params.Password)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't hash password")
 		return
 	}
 
-	user, err := cfg.DB.CreateUser(params.Email, hashedPassword)
+	user, err := cfg.DB.CreateUser(r.Context(), params.Email, hashedPassword)
 	if err != nil {
 		if errors.Is(err, database.ErrAlreadyExists) {
-			respondWithError(w, http.StatusConflict, "User already exists")
+			respondWithErrorCode(w, http.StatusConflict, "email_taken", "User already exists")
 			return
 		}
 
 		respondWithError(w, http.StatusInternalServerError, "Couldn't create user")
 		return
 	}
+	cfg.audit(r, database.AuditAccountCreated, user.ID, user.ID, nil)
 
 	respondWithJSON(w, http.StatusCreated, response{
 		User: User{
@@ -58,3 +64,11 @@ func (cfg *apiConfig) handlerUsersCreate(w http.ResponseWriter, r *http.Request)
 		},
 	})
 }
+
+// validateCredentials checks the email and password a user signs up or
+// updates their account with.
+func validateCredentials(v *validator, email, password string) {
+	addr, err := mail.ParseAddress(email)
+	v.check(err == nil && addr.Address == email, "email", "invalid", "must be an email address")
+	v.check(password != "", "password", "required", "is required")
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/database"
+)
+
+func (cfg *apiConfig) handlerUsersDelete(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.userIDFromRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	orphanedBlobs, err := cfg.DB.DeleteUser(r.Context(), userID, cfg.settings.Load().anonymizeDeletedChirps)
+	if err != nil {
+		if errors.Is(err, database.ErrNotExist) {
+			respondWithError(w, http.StatusNotFound, "Couldn't get user")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete user")
+		return
+	}
+	cfg.audit(r, database.AuditAccountDeleted, userID, userID, nil)
+
+	for _, key := range orphanedBlobs {
+		err := cfg.blobs.Delete(key)
+		if err != nil {
+			slog.Error("Couldn't delete blob of deleted user", "blob", key, "user_id", userID, "error", err)
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerUsersExport streams a zip archive of everything stored about the
+// caller: a data.json document plus the original files of their uploads.
+func (cfg *apiConfig) handlerUsersExport(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.userIDFromRequest(r)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	export, err := cfg.DB.ExportUser(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, database.ErrNotExist) {
+			respondWithError(w, http.StatusNotFound, "Couldn't get user")
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "Couldn't export user")
+		return
+	}
+	export.User.HashedPassword = ""
+
+	filename := fmt.Sprintf("chirpy-export-%d-%s.zip", userID, time.Now().UTC().Format("20060102"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	w.WriteHeader(http.StatusOK)
+
+	// headers are already sent, so from here on failures can only be logged
+	archive := zip.NewWriter(w)
+	defer archive.Close()
+
+	dataFile, err := archive.Create("data.json")
+	if err != nil {
+		slog.Error("Couldn't write export", "user_id", userID, "error", err)
+		return
+	}
+	encoder := json.NewEncoder(dataFile)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(export)
+	if err != nil {
+		slog.Error("Couldn't write export", "user_id", userID, "error", err)
+		return
+	}
+
+	for _, m := range export.Media {
+		err := cfg.exportBlob(archive, m)
+		if err != nil {
+			slog.Error("Couldn't export media", "media_id", m.ID, "user_id", userID, "error", err)
+		}
+	}
+}
+
+func (cfg *apiConfig) exportBlob(archive *zip.Writer, m database.Media) error {
+	blob, err := cfg.blobs.Open(m.BlobKey)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+
+	name := fmt.Sprintf("media/%d", m.ID)
+	if exts, _ := mime.ExtensionsByType(m.ContentType); len(exts) > 0 {
+		name += exts[0]
+	}
+	f, err := archive.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Store,
+		Modified: m.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, blob)
+	return err
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/auth"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/database"
+)
+
+func TestUsersDelete(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		anonymize bool
+	}{
+		{"delete chirps", false},
+		{"anonymize chirps", true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mux := newTestAPI(t)
+			cfg.settings.Load().anonymizeDeletedChirps = tt.anonymize
+			ctx := context.Background()
+
+			var users []database.User
+			for _, email := range []string{"alice@example.com", "bob@example.com", "carol@example.com"} {
+				user, err := cfg.DB.CreateUser(ctx, email, "hash")
+				if err != nil {
+					t.Fatal(err)
+				}
+				users = append(users, user)
+			}
+			alice, bob, carol := users[0], users[1], users[2]
+
+			if err := cfg.DB.SaveRefreshToken(ctx, alice.ID, "alice-refresh", time.Hour); err != nil {
+				t.Fatal(err)
+			}
+			key, size, err := cfg.blobs.Put(strings.NewReader("not really a png"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			media, err := cfg.DB.CreateMedia(ctx, database.Media{OwnerID: alice.ID, BlobKey: key, ContentType: "image/png", Size: size})
+			if err != nil {
+				t.Fatal(err)
+			}
+			chirp, err := cfg.DB.CreateChirp(ctx, database.CreateChirpParams{Body: "hello", AuthorID: alice.ID, MediaIDs: []int{media.ID}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			mention, err := cfg.DB.CreateChirp(ctx, database.CreateChirpParams{
+				Body:     "hi @alice",
+				AuthorID: bob.ID,
+				Mentions: []database.Mention{{UserID: alice.ID, Text: "@alice", Start: 3, End: 9}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := cfg.DB.BlockUser(ctx, bob.ID, alice.ID); err != nil {
+				t.Fatal(err)
+			}
+			if err := cfg.DB.MuteUser(ctx, alice.ID, carol.ID); err != nil {
+				t.Fatal(err)
+			}
+
+			token, err := auth.MakeJWT(alice.ID, cfg.jwtSecret, time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			remove := func() *httptest.ResponseRecorder {
+				r := httptest.NewRequest(http.MethodDelete, "/api/v1/users", nil)
+				r.Header.Set("Authorization", "Bearer "+token)
+				w := httptest.NewRecorder()
+				mux.ServeHTTP(w, r)
+				return w
+			}
+			if w := remove(); w.Code != http.StatusNoContent {
+				t.Fatalf("expected 204, got %d %s", w.Code, w.Body)
+			}
+
+			if _, err := cfg.DB.GetUser(ctx, alice.ID); !errors.Is(err, database.ErrNotExist) {
+				t.Errorf("expected the user to be gone, got %v", err)
+			}
+			if _, err := cfg.DB.UserForRefreshToken(ctx, "alice-refresh"); !errors.Is(err, database.ErrNotExist) {
+				t.Errorf("expected the refresh token to be revoked, got %v", err)
+			}
+			if blocked, _ := cfg.DB.GetBlockedUsers(ctx, bob.ID); len(blocked) != 0 {
+				t.Errorf("expected blocks of the user to be removed, got %+v", blocked)
+			}
+			if muted, _ := cfg.DB.GetMutedUsers(ctx, alice.ID); len(muted) != 0 {
+				t.Errorf("expected the user's mutes to be removed, got %+v", muted)
+			}
+			if got, _ := cfg.DB.GetChirp(ctx, mention.ID); len(got.Mentions) != 0 {
+				t.Errorf("expected mentions of the user to be dropped, got %+v", got.Mentions)
+			}
+
+			got, chirpErr := cfg.DB.GetChirp(ctx, chirp.ID)
+			gotMedia, mediaErr := cfg.DB.GetMedia(ctx, media.ID)
+			blob, blobErr := cfg.blobs.Open(key)
+			if blobErr == nil {
+				blob.Close()
+			}
+			if tt.anonymize {
+				if chirpErr != nil || got.AuthorID != 0 {
+					t.Errorf("expected the chirp to be kept without an author, got %+v %v", got, chirpErr)
+				}
+				if mediaErr != nil || gotMedia.OwnerID != 0 || blobErr != nil {
+					t.Errorf("expected the attached media to be kept without an owner, got %+v %v %v", gotMedia, mediaErr, blobErr)
+				}
+			} else {
+				if !errors.Is(chirpErr, database.ErrNotExist) {
+					t.Errorf("expected the chirp to be deleted, got %+v %v", got, chirpErr)
+				}
+				if !errors.Is(mediaErr, database.ErrNotExist) || blobErr == nil {
+					t.Errorf("expected the media and its blob to be deleted, got %v %v", mediaErr, blobErr)
+				}
+			}
+
+			if w := remove(); w.Code != http.StatusNotFound {
+				t.Errorf("expected 404 deleting the user again, got %d", w.Code)
+			}
+
+			// the next signup mustn't reuse a live user's ID, or the deleted one's
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/users", strings.NewReader(`{"email":"dave@example.com","password":"hunter22"}`))
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+			var dave struct {
+				ID int `json:"id"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &dave); err != nil || w.Code != http.StatusCreated {
+				t.Fatalf("couldn't sign up: %d %s", w.Code, w.Body)
+			}
+			if dave.ID != carol.ID+1 {
+				t.Errorf("expected a new ID %d, got %d", carol.ID+1, dave.ID)
+			}
+			if user, err := cfg.DB.GetUserByEmail(ctx, "carol@example.com"); err != nil || user.ID != carol.ID {
+				t.Errorf("expected carol's account to be untouched, got %+v %v", user, err)
+			}
+		})
+	}
+}
@@ -1,11 +1,11 @@
 package main
 
 import (
-	"encoding/json"
 	"net/http"
 	"strconv"
 
 	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/auth"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/database"
 )
 
 func (cfg *apiConfig) handlerUsersUpdate(w http.ResponseWriter, r *http.Request) {
@@ -28,15 +28,19 @@ func (cfg *apiConfig) handlerUsersUpdate(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	decoder := json.NewDecoder(r.Body)
 	params := parameters{}
-	err = decoder.Decode(&params)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters")
+	if !decodeJSON(w, r, &params) {
+		return
+	}
+
+	v := validator{}
+	validateCredentials(&v, params.Email, params.Password)
+	if !v.valid() {
+		respondWithValidationErrors(w, v.errs)
 		return
 	}
 
-	hashedPassword, err := auth.HashPassword(params.Password)
+	hashedPassword, err := hashPassword(r.Context(), params.Password)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't hash password")
 		return
@@ -48,17 +52,34 @@ func (cfg *apiConfig) handlerUsersUpdate(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	user, err := cfg.DB.UpdateUser(userIDInt, params.Email, hashedPassword)
+	before, err := cfg.DB.GetUser(r.Context(), userIDInt)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get user")
+		return
+	}
+
+	// the password is always sent, so only a new one counts as a change
+	passwordChanged := checkPasswordHash(r.Context(), params.Password, before.HashedPassword) != nil
+
+	user, err := cfg.DB.UpdateUser(r.Context(), userIDInt, params.Email, hashedPassword)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't create user")
 		return
 	}
+	if user.Email != before.Email {
+		cfg.audit(r, database.AuditEmailChanged, user.ID, user.ID, map[string]string{"from": before.Email, "to": user.Email})
+	}
+	if passwordChanged {
+		cfg.audit(r, database.AuditPasswordChanged, user.ID, user.ID, nil)
+	}
 
 	respondWithJSON(w, http.StatusOK, response{
 		User: User{
 			ID:          user.ID,
 			Email:       user.Email,
 			IsChirpyRed: user.IsChirpyRed,
+			Handle:      user.Handle,
+			DisplayName: user.DisplayName,
 		},
 	})
 }
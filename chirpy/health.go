@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/certs"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/config"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/health"
+)
+
+var errDraining = errors.New("shutting down")
+
+// jobRunnerMaxSilence is how long the job runner can go without looking
+// for due jobs before chirpy reports itself not live.
+const jobRunnerMaxSilence = time.Minute
+
+// handlerLivez reports whether the process is working at all. Failing it
+// should get chirpy restarted, so it only covers chirpy's own state.
+func (cfg *apiConfig) handlerLivez(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, r, "livez", cfg.liveness.Run(r.Context()))
+}
+
+// handlerReadyz reports whether chirpy can serve traffic: its storage is
+// usable, its keys are loaded and it isn't shutting down.
+func (cfg *apiConfig) handlerReadyz(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, r, "readyz", cfg.readinessResults(r.Context()))
+}
+
+// handlerReadiness is the original health endpoint, kept for existing
+// probes. It reports the same as /readyz in a single word.
+func (cfg *apiConfig) handlerReadiness(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "text/plain; charset=utf-8")
+	status := http.StatusOK
+	if !health.Healthy(cfg.readinessResults(r.Context())) {
+		status = http.StatusServiceUnavailable
+	}
+	w.WriteHeader(status)
+	w.Write([]byte(http.StatusText(status)))
+}
+
+func (cfg *apiConfig) readinessResults(ctx context.Context) []health.Result {
+	results := cfg.readiness.Run(ctx)
+	if cfg.draining.Load() {
+		results = append([]health.Result{{Name: "shutdown", Err: errDraining}}, results...)
+	}
+	return results
+}
+
+// writeHealth responds 200 if every check passed and 503 otherwise. Each
+// check's status and latency is listed with ?verbose, or on failure.
+func writeHealth(w http.ResponseWriter, r *http.Request, name string, results []health.Result) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+
+	healthy := health.Healthy(results)
+	if healthy && !r.URL.Query().Has("verbose") {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+		return
+	}
+
+	var b strings.Builder
+	for _, res := range results {
+		if res.OK() {
+			fmt.Fprintf(&b, "[+]%s ok (%s)\n", res.Name, res.Latency.Round(time.Microsecond))
+		} else {
+			fmt.Fprintf(&b, "[-]%s failed: %v (%s)\n", res.Name, res.Err, res.Latency.Round(time.Microsecond))
+		}
+	}
+	if healthy {
+		fmt.Fprintf(&b, "%s check passed\n", name)
+		w.WriteHeader(http.StatusOK)
+	} else {
+		fmt.Fprintf(&b, "%s check failed\n", name)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	w.Write([]byte(b.String()))
+}
+
+// checkKeys makes sure the signing secrets are set and, with TLS, that
+// the served certificate is loaded and hasn't expired.
+func (cfg *apiConfig) checkKeys(tlsCerts *certs.Reloader) health.Func {
+	return func(ctx context.Context) error {
+		if cfg.jwtSecret == "" {
+			return errors.New("JWT secret is not set")
+		}
+		if cfg.polkaSecret == "" {
+			return errors.New("Polka key is not set")
+		}
+		if tlsCerts == nil {
+			return nil
+		}
+		cert, err := tlsCerts.GetCertificate(nil)
+		if err != nil {
+			return err
+		}
+		if cert == nil || cert.Leaf == nil {
+			return errors.New("no TLS certificate loaded")
+		}
+		if time.Now().After(cert.Leaf.NotAfter) {
+			return fmt.Errorf("TLS certificate expired at %s", cert.Leaf.NotAfter.Format(time.RFC3339))
+		}
+		return nil
+	}
+}
+
+// registerHealthChecks sets up the liveness and readiness checks. It must
+// run after registerJobs and before the server starts.
+func (cfg *apiConfig) registerHealthChecks(conf config.Config, tlsCerts *certs.Reloader) {
+	cfg.liveness = health.NewRegistry(conf.Health.CacheTTL, conf.Health.CheckTimeout)
+	cfg.liveness.Register("job_runner", health.Heartbeat(cfg.jobs.LastTick, jobRunnerMaxSilence))
+
+	cfg.readiness = health.NewRegistry(conf.Health.CacheTTL, conf.Health.CheckTimeout)
+	cfg.readiness.Register("database", cfg.DB.Ping)
+	cfg.readiness.Register("disk_database", health.FreeSpace(filepath.Dir(conf.Database.Path), conf.Health.MinFreeBytes))
+	cfg.readiness.Register("disk_media", health.FreeSpace(conf.Server.MediaRoot, conf.Health.MinFreeBytes))
+	cfg.readiness.Register("keys", cfg.checkKeys(tlsCerts))
+}
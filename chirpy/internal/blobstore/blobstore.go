@@ -0,0 +1,110 @@
+package blobstore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+var ErrNotExist = errors.New("blob does not exist")
+
+// BlobStore stores immutable blobs addressed by the hex sha256 of their
+// contents, so identical uploads are only ever written once.
+type BlobStore interface {
+	Put(r io.Reader) (key string, size int64, err error)
+	Open(key string) (io.ReadSeekCloser, error)
+	Delete(key string) error
+}
+
+// DiskStore is a BlobStore backed by a directory on the local filesystem.
+// Blobs are sharded into sub-directories by the first two hex characters
+// of their key.
+type DiskStore struct {
+	root string
+}
+
+func NewDiskStore(root string) (*DiskStore, error) {
+	err := os.MkdirAll(root, 0700)
+	if err != nil {
+		return nil, err
+	}
+	return &DiskStore{root: root}, nil
+}
+
+func (s *DiskStore) Put(r io.Reader) (string, int64, error) {
+	tmp, err := os.CreateTemp(s.root, "upload-*")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), r)
+	if err != nil {
+		return "", 0, err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return "", 0, err
+	}
+
+	key := hex.EncodeToString(hash.Sum(nil))
+	path := s.path(key)
+	if _, err := os.Stat(path); err == nil {
+		return key, size, nil
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return "", 0, err
+	}
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return key, size, nil
+}
+
+func (s *DiskStore) Open(key string) (io.ReadSeekCloser, error) {
+	if !validKey(key) {
+		return nil, ErrNotExist
+	}
+	f, err := os.Open(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (s *DiskStore) Delete(key string) error {
+	if !validKey(key) {
+		return ErrNotExist
+	}
+	err := os.Remove(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotExist
+	}
+	return err
+}
+
+func (s *DiskStore) path(key string) string {
+	return filepath.Join(s.root, key[:2], key)
+}
+
+// validKey guards against path traversal by only accepting keys that
+// look like a hex encoded sha256 digest.
+func validKey(key string) bool {
+	if len(key) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(key)
+	return err == nil
+}
@@ -0,0 +1,57 @@
+package blobstore
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestPutOpen(t *testing.T) {
+	store, err := NewDiskStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key1, size, err := store.Put(strings.NewReader("chirp chirp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != int64(len("chirp chirp")) {
+		t.Errorf("expected size %d, got %d", len("chirp chirp"), size)
+	}
+
+	key2, _, err := store.Put(strings.NewReader("chirp chirp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key1 != key2 {
+		t.Errorf("expected identical content to share a key")
+	}
+
+	blob, err := store.Open(key1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer blob.Close()
+	dat, err := io.ReadAll(blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(dat) != "chirp chirp" {
+		t.Errorf("expected to read back stored blob, got %q", dat)
+	}
+}
+
+func TestOpenInvalidKey(t *testing.T) {
+	store, err := NewDiskStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []string{"", "../database.json", strings.Repeat("z", 64)}
+	for _, key := range cases {
+		if _, err := store.Open(key); err != ErrNotExist {
+			t.Errorf("Open(%q): expected ErrNotExist, got %v", key, err)
+		}
+	}
+}
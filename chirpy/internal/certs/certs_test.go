@@ -0,0 +1,216 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type keyPair struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// newKeyPair makes a certificate signed by parent, or self-signed if
+// parent is nil.
+func newKeyPair(t *testing.T, name string, parent *keyPair, usage x509.ExtKeyUsage) keyPair {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keyPair{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func (kp keyPair) write(t *testing.T, dir string) (certFile, keyFile string) {
+	t.Helper()
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, kp.certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, kp.keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	first := newKeyPair(t, "first", nil, x509.ExtKeyUsageServerAuth)
+	certFile, keyFile := first.write(t, dir)
+
+	r, err := NewReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded, err := r.Reload(); reloaded || err != nil {
+		t.Fatalf("expected no reload for unchanged files, got %v %v", reloaded, err)
+	}
+
+	second := newKeyPair(t, "second", nil, x509.ExtKeyUsageServerAuth)
+	second.write(t, dir)
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, future, future)
+
+	reloaded, err := r.Reload()
+	if !reloaded || err != nil {
+		t.Fatalf("expected a reload, got %v %v", reloaded, err)
+	}
+	cert, _ := r.GetCertificate(nil)
+	if cert.Leaf == nil || cert.Leaf.Subject.CommonName != "second" {
+		t.Errorf("expected the new certificate to be served")
+	}
+
+	// a broken file keeps the old certificate
+	os.WriteFile(keyFile, []byte("garbage"), 0600)
+	later := future.Add(time.Minute)
+	os.Chtimes(keyFile, later, later)
+	if _, err := r.Reload(); err == nil {
+		t.Fatal("expected an error for a bad key")
+	}
+	if cert, _ := r.GetCertificate(nil); cert.Leaf.Subject.CommonName != "second" {
+		t.Errorf("expected the previous certificate to stay in use")
+	}
+}
+
+func TestServerConfigClientCerts(t *testing.T) {
+	dir := t.TempDir()
+	serverCA := newKeyPair(t, "server ca", nil, x509.ExtKeyUsageServerAuth)
+	server := newKeyPair(t, "server", &serverCA, x509.ExtKeyUsageServerAuth)
+	clientCA := newKeyPair(t, "client ca", nil, x509.ExtKeyUsageClientAuth)
+	client := newKeyPair(t, "polka", &clientCA, x509.ExtKeyUsageClientAuth)
+
+	certFile, keyFile := server.write(t, dir)
+	clientCAFile := filepath.Join(dir, "client-ca.pem")
+	os.WriteFile(clientCAFile, clientCA.certPEM, 0600)
+
+	r, err := NewReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := ServerConfig(r, clientCAFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cert, err := VerifiedClient(r.TLS)
+		if err != nil {
+			io.WriteString(w, "anonymous")
+			return
+		}
+		io.WriteString(w, cert.Subject.CommonName)
+	}))
+	// StartTLS would install httptest's own certificate, so wrap the
+	// listener directly
+	srv.Listener = tls.NewListener(srv.Listener, config)
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.Start()
+	defer srv.Close()
+	url := strings.Replace(srv.URL, "http://", "https://", 1)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(serverCA.cert)
+	get := func(certs ...tls.Certificate) (string, error) {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs: roots,
+			// always offer the certificate, even if the server doesn't
+			// list its CA as acceptable
+			GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				if len(certs) == 0 {
+					return &tls.Certificate{}, nil
+				}
+				return &certs[0], nil
+			},
+		}}}
+		resp, err := client.Get(url)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	if got, err := get(); err != nil || got != "anonymous" {
+		t.Errorf("expected an anonymous client to connect, got %q %v", got, err)
+	}
+
+	clientCert, err := tls.X509KeyPair(client.certPEM, client.keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := get(clientCert); err != nil || got != "polka" {
+		t.Errorf("expected the client certificate to be verified, got %q %v", got, err)
+	}
+
+	// a certificate from an unknown CA fails the handshake
+	rogue := newKeyPair(t, "rogue", nil, x509.ExtKeyUsageClientAuth)
+	rogueCert, _ := tls.X509KeyPair(rogue.certPEM, rogue.keyPEM)
+	if _, err := get(rogueCert); err == nil {
+		t.Errorf("expected an untrusted client certificate to be rejected")
+	}
+}
+
+func TestVerifiedClientWithoutTLS(t *testing.T) {
+	if _, err := VerifiedClient(nil); !errors.Is(err, ErrNoClientCert) {
+		t.Errorf("expected ErrNoClientCert, got %v", err)
+	}
+}
@@ -0,0 +1,581 @@
+// Package config loads chirpy's settings. Values are layered: built-in
+// defaults, then a YAML or TOML file, then environment variables, then
+// command-line flags, each overriding the one before.
+//
+// Every setting is a tagged struct field. The tags name its file key
+// (yaml/toml), its environment variable (env) and its flag (flag), and
+// mark fields that are secret or safe to change on reload.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/jobs"
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	Server     Server     `yaml:"server" toml:"server"`
+	HTTP       HTTP       `yaml:"http" toml:"http"`
+	TLS        TLS        `yaml:"tls" toml:"tls"`
+	Database   Database   `yaml:"database" toml:"database"`
+	Auth       Auth       `yaml:"auth" toml:"auth"`
+	Chirps     Chirps     `yaml:"chirps" toml:"chirps"`
+	Moderation Moderation `yaml:"moderation" toml:"moderation"`
+	Log        Log        `yaml:"log" toml:"log"`
+	Trace      Trace      `yaml:"trace" toml:"trace"`
+	Health     Health     `yaml:"health" toml:"health"`
+	Jobs       Jobs       `yaml:"jobs" toml:"jobs"`
+
+	// ResetDatabase wipes the database on startup. Only the -debug flag
+	// sets it, so no config file or environment variable can.
+	ResetDatabase bool `yaml:"-" toml:"-"`
+}
+
+type Server struct {
+	Port         int    `yaml:"port" toml:"port" env:"PORT" flag:"port"`
+	FilepathRoot string `yaml:"filepath_root" toml:"filepath_root" env:"FILEPATH_ROOT" flag:"filepath-root"`
+	MediaRoot    string `yaml:"media_root" toml:"media_root" env:"MEDIA_ROOT" flag:"media-root"`
+	// H2C serves HTTP/2 without TLS, for running behind a proxy that
+	// speaks HTTP/2 to its backends. It has no effect when TLS is on.
+	H2C bool `yaml:"h2c" toml:"h2c" env:"H2C" flag:"h2c"`
+	// TrustedProxies are IPs or CIDRs whose X-Forwarded-For is believed.
+	TrustedProxies []string `yaml:"trusted_proxies" toml:"trusted_proxies" env:"TRUSTED_PROXIES" flag:"trusted-proxies" reload:"true"`
+}
+
+type HTTP struct {
+	ReadTimeout       time.Duration `yaml:"read_timeout" toml:"read_timeout" env:"HTTP_READ_TIMEOUT" flag:"http-read-timeout"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" toml:"read_header_timeout" env:"HTTP_READ_HEADER_TIMEOUT" flag:"http-read-header-timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" toml:"write_timeout" env:"HTTP_WRITE_TIMEOUT" flag:"http-write-timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" toml:"idle_timeout" env:"HTTP_IDLE_TIMEOUT" flag:"http-idle-timeout"`
+	MaxHeaderBytes    int           `yaml:"max_header_bytes" toml:"max_header_bytes" env:"HTTP_MAX_HEADER_BYTES" flag:"http-max-header-bytes"`
+	MaxBodyBytes      int64         `yaml:"max_body_bytes" toml:"max_body_bytes" env:"HTTP_MAX_BODY_BYTES" flag:"http-max-body-bytes"`
+	// ShutdownDelay is how long /api/healthz reports unhealthy before the
+	// listener closes, giving load balancers time to stop sending traffic.
+	ShutdownDelay time.Duration `yaml:"shutdown_delay" toml:"shutdown_delay" env:"SHUTDOWN_DELAY" flag:"shutdown-delay"`
+	// ShutdownTimeout bounds how long in-flight requests get to finish.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" flag:"shutdown-timeout"`
+}
+
+// TLS is enabled by setting CertFile and KeyFile. The files are checked
+// for changes every ReloadInterval so renewed certificates are picked up.
+type TLS struct {
+	CertFile       string        `yaml:"cert_file" toml:"cert_file" env:"TLS_CERT_FILE" flag:"tls-cert"`
+	KeyFile        string        `yaml:"key_file" toml:"key_file" env:"TLS_KEY_FILE" flag:"tls-key"`
+	ReloadInterval time.Duration `yaml:"reload_interval" toml:"reload_interval" env:"TLS_RELOAD_INTERVAL" flag:"tls-reload-interval"`
+	// PolkaClientCAFile, if set, makes the Polka webhook require a client
+	// certificate signed by one of these CAs.
+	PolkaClientCAFile string `yaml:"polka_client_ca_file" toml:"polka_client_ca_file" env:"TLS_POLKA_CLIENT_CA_FILE" flag:"tls-polka-client-ca"`
+	// RedirectPort, if set, listens for plain HTTP and redirects to HTTPS.
+	RedirectPort int `yaml:"redirect_port" toml:"redirect_port" env:"TLS_REDIRECT_PORT" flag:"tls-redirect-port"`
+	// HSTSMaxAge, if set, sends Strict-Transport-Security on responses.
+	HSTSMaxAge time.Duration `yaml:"hsts_max_age" toml:"hsts_max_age" env:"TLS_HSTS_MAX_AGE" flag:"tls-hsts-max-age"`
+}
+
+// Enabled reports whether chirpy should serve HTTPS.
+func (t TLS) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != ""
+}
+
+type Database struct {
+	Path string `yaml:"path" toml:"path" env:"DATABASE_PATH" flag:"db"`
+}
+
+// Auth secrets have no flags so they never show up in process listings.
+type Auth struct {
+	JWTSecret       string        `yaml:"jwt_secret" toml:"jwt_secret" env:"JWT_SECRET" secret:"true"`
+	PolkaKey        string        `yaml:"polka_key" toml:"polka_key" env:"POLKA_KEY" secret:"true"`
+	AccessTokenTTL  time.Duration `yaml:"access_token_ttl" toml:"access_token_ttl" env:"ACCESS_TOKEN_TTL" flag:"access-token-ttl" reload:"true"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl" toml:"refresh_token_ttl" env:"REFRESH_TOKEN_TTL" flag:"refresh-token-ttl" reload:"true"`
+}
+
+type Chirps struct {
+	MaxLength  int           `yaml:"max_length" toml:"max_length" env:"CHIRP_MAX_LENGTH" flag:"chirp-max-length" reload:"true"`
+	EditWindow time.Duration `yaml:"edit_window" toml:"edit_window" env:"CHIRP_EDIT_WINDOW" flag:"chirp-edit-window" reload:"true"`
+	// DeletedUserChirps is "delete" or "anonymize".
+	DeletedUserChirps string `yaml:"deleted_user_chirps" toml:"deleted_user_chirps" env:"DELETED_USER_CHIRPS" flag:"deleted-user-chirps" reload:"true"`
+	// ScheduleInterval is how often scheduled chirps that are due get
+	// published, and so roughly how late they can be.
+	ScheduleInterval time.Duration `yaml:"schedule_interval" toml:"schedule_interval" env:"CHIRP_SCHEDULE_INTERVAL" flag:"chirp-schedule-interval"`
+}
+
+type Moderation struct {
+	ModeratorEmails []string `yaml:"moderator_emails" toml:"moderator_emails" env:"MODERATOR_EMAILS" flag:"moderator-emails" reload:"true"`
+}
+
+type Log struct {
+	Format string `yaml:"format" toml:"format" env:"LOG_FORMAT" flag:"log-format"`
+	Level  string `yaml:"level" toml:"level" env:"LOG_LEVEL" flag:"log-level" reload:"true"`
+}
+
+type Trace struct {
+	// Exporter is "stdout", "otlp" or "none".
+	Exporter string `yaml:"exporter" toml:"exporter" env:"TRACE_EXPORTER" flag:"trace-exporter"`
+}
+
+type Health struct {
+	// CacheTTL is how long a check's result is reused by later probes.
+	CacheTTL     time.Duration `yaml:"cache_ttl" toml:"cache_ttl" env:"HEALTH_CACHE_TTL" flag:"health-cache-ttl"`
+	CheckTimeout time.Duration `yaml:"check_timeout" toml:"check_timeout" env:"HEALTH_CHECK_TIMEOUT" flag:"health-check-timeout"`
+	// MinFreeBytes is the free disk space below which chirpy reports
+	// itself not ready.
+	MinFreeBytes uint64 `yaml:"min_free_bytes" toml:"min_free_bytes" env:"HEALTH_MIN_FREE_BYTES" flag:"health-min-free-bytes"`
+}
+
+// Jobs holds the schedules of the maintenance jobs, as cron expressions
+// in UTC or as @hourly, @daily or "@every 10m" and the like.
+type Jobs struct {
+	TokenPurge    string `yaml:"token_purge" toml:"token_purge" env:"JOB_TOKEN_PURGE" flag:"job-token-purge"`
+	Compact       string `yaml:"compact" toml:"compact" env:"JOB_COMPACT" flag:"job-compact"`
+	ExpireRecords string `yaml:"expire_records" toml:"expire_records" env:"JOB_EXPIRE_RECORDS" flag:"job-expire-records"`
+	// HistorySize is how many runs of each job /admin/jobs shows.
+	HistorySize int `yaml:"history_size" toml:"history_size" env:"JOB_HISTORY_SIZE" flag:"job-history-size"`
+}
+
+// Default returns the settings chirpy uses when nothing overrides them.
+func Default() Config {
+	return Config{
+		Server: Server{
+			Port:         8080,
+			FilepathRoot: ".",
+			MediaRoot:    "media",
+		},
+		HTTP: HTTP{
+			ReadTimeout:       30 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      60 * time.Second,
+			IdleTimeout:       120 * time.Second,
+			MaxHeaderBytes:    1 << 20,
+			MaxBodyBytes:      1 << 20,
+			ShutdownTimeout:   30 * time.Second,
+		},
+		TLS: TLS{
+			ReloadInterval: time.Minute,
+		},
+		Database: Database{
+			Path: "database.json",
+		},
+		Auth: Auth{
+			AccessTokenTTL:  time.Hour,
+			RefreshTokenTTL: time.Hour,
+		},
+		Chirps: Chirps{
+			MaxLength:         140,
+			EditWindow:        15 * time.Minute,
+			DeletedUserChirps: "delete",
+			ScheduleInterval:  15 * time.Second,
+		},
+		Log: Log{
+			Format: "text",
+			Level:  "info",
+		},
+		Trace: Trace{
+			Exporter: "none",
+		},
+		Health: Health{
+			CacheTTL:     5 * time.Second,
+			CheckTimeout: 2 * time.Second,
+			MinFreeBytes: 100 << 20,
+		},
+		Jobs: Jobs{
+			TokenPurge:    "@hourly",
+			Compact:       "30 4 * * *",
+			ExpireRecords: "@every 15m",
+			HistorySize:   20,
+		},
+	}
+}
+
+// Load builds a Config from the defaults, the file named by -config or
+// CHIRPY_CONFIG, the environment and args. It does not validate the
+// result; call Validate for that. Asking for -help returns flag.ErrHelp.
+func Load(args []string, getenv func(string) string, output io.Writer) (Config, error) {
+	c := Default()
+	fields := fieldsOf(&c)
+
+	fs := flag.NewFlagSet("chirpy", flag.ContinueOnError)
+	fs.SetOutput(output)
+	path := fs.String("config", getenv("CHIRPY_CONFIG"), "path to a YAML or TOML config file (env CHIRPY_CONFIG)")
+	flagValues := map[string]string{}
+	for _, f := range fields {
+		name := f.tag.Get("flag")
+		if name == "" {
+			continue
+		}
+		fs.Var(&rawFlag{
+			values: flagValues,
+			name:   name,
+			isBool: f.value.Kind() == reflect.Bool,
+		}, name, fmt.Sprintf("overrides %s (env %s)", f.key, f.tag.Get("env")))
+	}
+	fs.BoolVar(&c.ResetDatabase, "debug", false, "wipe the database on startup")
+	if err := fs.Parse(args); err != nil {
+		return c, err
+	}
+	if fs.NArg() > 0 {
+		return c, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	if *path != "" {
+		if err := loadFile(&c, *path); err != nil {
+			return c, err
+		}
+	}
+
+	for _, f := range fields {
+		env := f.tag.Get("env")
+		if v := getenv(env); env != "" && v != "" {
+			if err := setValue(f.value, v); err != nil {
+				return c, fmt.Errorf("%s: %w", env, err)
+			}
+		}
+	}
+	for _, f := range fields {
+		name := f.tag.Get("flag")
+		if v, ok := flagValues[name]; ok {
+			if err := setValue(f.value, v); err != nil {
+				return c, fmt.Errorf("-%s: %w", name, err)
+			}
+		}
+	}
+	return c, nil
+}
+
+func loadFile(c *Config, path string) error {
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		dec := yaml.NewDecoder(f)
+		dec.KnownFields(true)
+		if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	case ".toml":
+		md, err := toml.DecodeFile(path, c)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("%s: unknown key %s", path, undecoded[0])
+		}
+	default:
+		return fmt.Errorf("%s: unsupported config file type %q, expected .yaml, .yml or .toml", path, ext)
+	}
+	return nil
+}
+
+// Validate reports every invalid setting at once, one per line.
+func (c Config) Validate() error {
+	var errs []error
+	invalid := func(key, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: "+format, append([]any{key}, args...)...))
+	}
+
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		invalid("server.port", "must be between 1 and 65535, got %d", c.Server.Port)
+	}
+	for _, p := range c.Server.TrustedProxies {
+		if net.ParseIP(p) == nil {
+			if _, _, err := net.ParseCIDR(p); err != nil {
+				invalid("server.trusted_proxies", "%q is not an IP address or CIDR", p)
+			}
+		}
+	}
+
+	for _, d := range []struct {
+		key string
+		d   time.Duration
+	}{
+		{"http.read_timeout", c.HTTP.ReadTimeout},
+		{"http.read_header_timeout", c.HTTP.ReadHeaderTimeout},
+		{"http.write_timeout", c.HTTP.WriteTimeout},
+		{"http.idle_timeout", c.HTTP.IdleTimeout},
+		{"http.shutdown_timeout", c.HTTP.ShutdownTimeout},
+		{"auth.access_token_ttl", c.Auth.AccessTokenTTL},
+		{"auth.refresh_token_ttl", c.Auth.RefreshTokenTTL},
+		{"chirps.schedule_interval", c.Chirps.ScheduleInterval},
+		{"health.check_timeout", c.Health.CheckTimeout},
+	} {
+		if d.d <= 0 {
+			invalid(d.key, "must be positive, got %s", d.d)
+		}
+	}
+	if c.HTTP.ShutdownDelay < 0 {
+		invalid("http.shutdown_delay", "must not be negative, got %s", c.HTTP.ShutdownDelay)
+	}
+	if c.Health.CacheTTL < 0 {
+		invalid("health.cache_ttl", "must not be negative, got %s", c.Health.CacheTTL)
+	}
+	if c.Chirps.ScheduleInterval > 0 && c.Chirps.ScheduleInterval < time.Second {
+		invalid("chirps.schedule_interval", "must be at least 1s, got %s", c.Chirps.ScheduleInterval)
+	}
+	if c.Chirps.EditWindow < 0 {
+		invalid("chirps.edit_window", "must not be negative, got %s", c.Chirps.EditWindow)
+	}
+	if c.HTTP.MaxHeaderBytes <= 0 {
+		invalid("http.max_header_bytes", "must be positive, got %d", c.HTTP.MaxHeaderBytes)
+	}
+	if c.HTTP.MaxBodyBytes <= 0 {
+		invalid("http.max_body_bytes", "must be positive, got %d", c.HTTP.MaxBodyBytes)
+	}
+	for _, j := range []struct {
+		key  string
+		spec string
+	}{
+		{"jobs.token_purge", c.Jobs.TokenPurge},
+		{"jobs.compact", c.Jobs.Compact},
+		{"jobs.expire_records", c.Jobs.ExpireRecords},
+	} {
+		if _, err := jobs.ParseSchedule(j.spec); err != nil {
+			invalid(j.key, "%v", err)
+		}
+	}
+	if c.Jobs.HistorySize < 1 {
+		invalid("jobs.history_size", "must be positive, got %d", c.Jobs.HistorySize)
+	}
+
+	if c.TLS.Enabled() {
+		if c.TLS.CertFile == "" || c.TLS.KeyFile == "" {
+			invalid("tls", "cert_file and key_file must be set together")
+		}
+		if c.TLS.ReloadInterval <= 0 {
+			invalid("tls.reload_interval", "must be positive, got %s", c.TLS.ReloadInterval)
+		}
+		if c.TLS.RedirectPort < 0 || c.TLS.RedirectPort > 65535 || c.TLS.RedirectPort == c.Server.Port {
+			invalid("tls.redirect_port", "must be between 0 and 65535 and differ from server.port, got %d", c.TLS.RedirectPort)
+		}
+	} else {
+		for _, s := range []struct {
+			key string
+			set bool
+		}{
+			{"tls.polka_client_ca_file", c.TLS.PolkaClientCAFile != ""},
+			{"tls.redirect_port", c.TLS.RedirectPort != 0},
+			{"tls.hsts_max_age", c.TLS.HSTSMaxAge != 0},
+		} {
+			if s.set {
+				invalid(s.key, "requires tls.cert_file and tls.key_file")
+			}
+		}
+	}
+	if c.TLS.HSTSMaxAge < 0 {
+		invalid("tls.hsts_max_age", "must not be negative, got %s", c.TLS.HSTSMaxAge)
+	}
+
+	if c.Database.Path == "" {
+		invalid("database.path", "is required")
+	}
+	if c.Auth.JWTSecret == "" {
+		invalid("auth.jwt_secret", "is required (set JWT_SECRET)")
+	}
+	if c.Auth.PolkaKey == "" {
+		invalid("auth.polka_key", "is required (set POLKA_KEY)")
+	}
+
+	if c.Chirps.MaxLength <= 0 {
+		invalid("chirps.max_length", "must be positive, got %d", c.Chirps.MaxLength)
+	}
+	switch c.Chirps.DeletedUserChirps {
+	case "delete", "anonymize":
+	default:
+		invalid("chirps.deleted_user_chirps", "must be \"delete\" or \"anonymize\", got %q", c.Chirps.DeletedUserChirps)
+	}
+
+	switch c.Log.Format {
+	case "text", "json":
+	default:
+		invalid("log.format", "must be \"text\" or \"json\", got %q", c.Log.Format)
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		invalid("log.level", "must be debug, info, warn or error, got %q", c.Log.Level)
+	}
+	switch c.Trace.Exporter {
+	case "stdout", "otlp", "none":
+	default:
+		invalid("trace.exporter", "must be \"stdout\", \"otlp\" or \"none\", got %q", c.Trace.Exporter)
+	}
+
+	return errors.Join(errs...)
+}
+
+// Reload returns c with the reloadable settings taken from next, along
+// with the keys of any other settings that differ and so need a restart.
+func (c Config) Reload(next Config) (Config, []string) {
+	var restart []string
+	nextFields := fieldsOf(&next)
+	for i, f := range fieldsOf(&c) {
+		if reflect.DeepEqual(f.value.Interface(), nextFields[i].value.Interface()) {
+			continue
+		}
+		if f.tag.Get("reload") == "true" {
+			f.value.Set(nextFields[i].value)
+		} else {
+			restart = append(restart, f.key)
+		}
+	}
+	return c, restart
+}
+
+// WriteYAML writes c as YAML in the config file format, with secrets
+// redacted.
+func (c Config) WriteYAML(w io.Writer) error {
+	node, err := yamlNode(reflect.ValueOf(c), reflect.StructTag(""))
+	if err != nil {
+		return err
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(node); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+func yamlNode(v reflect.Value, tag reflect.StructTag) (*yaml.Node, error) {
+	node := &yaml.Node{}
+	switch {
+	case v.Kind() == reflect.Struct:
+		node.Kind = yaml.MappingNode
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.Tag.Get("yaml") == "-" {
+				continue
+			}
+			value, err := yamlNode(v.Field(i), field.Tag)
+			if err != nil {
+				return nil, err
+			}
+			key := &yaml.Node{Kind: yaml.ScalarNode, Value: field.Tag.Get("yaml")}
+			node.Content = append(node.Content, key, value)
+		}
+		return node, nil
+	case tag.Get("secret") == "true" && v.String() != "":
+		return node, node.Encode("[REDACTED]")
+	case v.Type() == durationType:
+		return node, node.Encode(v.Interface().(time.Duration).String())
+	case v.Kind() == reflect.Slice:
+		if err := node.Encode(v.Interface()); err != nil {
+			return nil, err
+		}
+		node.Style = yaml.FlowStyle
+		return node, nil
+	default:
+		return node, node.Encode(v.Interface())
+	}
+}
+
+type field struct {
+	key   string
+	value reflect.Value
+	tag   reflect.StructTag
+}
+
+// fieldsOf lists the settable leaf fields of c, in declaration order,
+// with dotted keys like "server.port". Fields without a file key are
+// left out.
+func fieldsOf(c *Config) []field {
+	var fields []field
+	var walk func(v reflect.Value, prefix string)
+	walk = func(v reflect.Value, prefix string) {
+		for i := 0; i < v.NumField(); i++ {
+			sf := v.Type().Field(i)
+			if sf.Tag.Get("yaml") == "-" {
+				continue
+			}
+			key := prefix + sf.Tag.Get("yaml")
+			if sf.Type.Kind() == reflect.Struct && sf.Type != durationType {
+				walk(v.Field(i), key+".")
+				continue
+			}
+			fields = append(fields, field{key: key, value: v.Field(i), tag: sf.Tag})
+		}
+	}
+	walk(reflect.ValueOf(c).Elem(), "")
+	return fields
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// setValue parses s into v. Lists are comma separated.
+func setValue(v reflect.Value, s string) error {
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(s)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Int || v.Kind() == reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case v.Kind() == reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		var list []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		v.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+	return nil
+}
+
+// rawFlag records a flag's text so flags can be applied after the file
+// and environment, whatever order they were parsed in.
+type rawFlag struct {
+	values map[string]string
+	name   string
+	isBool bool
+}
+
+func (f *rawFlag) String() string {
+	if f == nil || f.values == nil {
+		return ""
+	}
+	return f.values[f.name]
+}
+
+func (f *rawFlag) Set(s string) error {
+	f.values[f.name] = s
+	return nil
+}
+
+func (f *rawFlag) IsBoolFlag() bool {
+	return f.isBool
+}
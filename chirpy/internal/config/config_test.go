@@ -0,0 +1,202 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func envFrom(m map[string]string) func(string) string {
+	return func(key string) string { return m[key] }
+}
+
+func writeFile(t *testing.T, name, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadLayering(t *testing.T) {
+	path := writeFile(t, "chirpy.yaml", `
+server:
+  port: 9000
+  media_root: /srv/media
+chirps:
+  max_length: 200
+  edit_window: 5m
+`)
+	env := envFrom(map[string]string{
+		"CHIRPY_CONFIG":    path,
+		"PORT":             "9001",
+		"MODERATOR_EMAILS": "a@b.c, d@e.f",
+	})
+
+	c, err := Load([]string{"-port", "9002", "-debug"}, env, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Server.Port != 9002 {
+		t.Errorf("expected flag to win for port, got %d", c.Server.Port)
+	}
+	if c.Server.MediaRoot != "/srv/media" {
+		t.Errorf("expected media root from file, got %q", c.Server.MediaRoot)
+	}
+	if c.Chirps.MaxLength != 200 || c.Chirps.EditWindow != 5*time.Minute {
+		t.Errorf("expected chirp settings from file, got %+v", c.Chirps)
+	}
+	if got := strings.Join(c.Moderation.ModeratorEmails, "|"); got != "a@b.c|d@e.f" {
+		t.Errorf("expected moderator emails from env, got %q", got)
+	}
+	if !c.ResetDatabase {
+		t.Errorf("expected -debug to reset the database")
+	}
+	if c.Database.Path != "database.json" {
+		t.Errorf("expected default database path, got %q", c.Database.Path)
+	}
+}
+
+func TestLoadTOML(t *testing.T) {
+	path := writeFile(t, "chirpy.toml", `
+[auth]
+access_token_ttl = "30m"
+
+[log]
+format = "json"
+`)
+	c, err := Load([]string{"-config", path}, envFrom(nil), io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Auth.AccessTokenTTL != 30*time.Minute || c.Log.Format != "json" {
+		t.Errorf("unexpected config %+v %+v", c.Auth, c.Log)
+	}
+}
+
+func TestLoadRejectsUnknownKeys(t *testing.T) {
+	for _, tc := range []struct{ name, contents string }{
+		{"chirpy.yaml", "server:\n  prot: 1\n"},
+		{"chirpy.toml", "[server]\nprot = 1\n"},
+	} {
+		path := writeFile(t, tc.name, tc.contents)
+		_, err := Load([]string{"-config", path}, envFrom(nil), io.Discard)
+		if err == nil || !strings.Contains(err.Error(), "prot") {
+			t.Errorf("%s: expected an unknown key error, got %v", tc.name, err)
+		}
+	}
+}
+
+func TestLoadResetDatabaseIsFlagOnly(t *testing.T) {
+	c, err := Load(nil, envFrom(map[string]string{"DEBUG": "1"}), io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.ResetDatabase {
+		t.Errorf("expected DEBUG not to reset the database")
+	}
+	for _, tc := range []struct{ name, contents string }{
+		{"chirpy.yaml", "debug: true\n"},
+		{"chirpy.toml", "debug = true\n"},
+	} {
+		path := writeFile(t, tc.name, tc.contents)
+		if _, err := Load([]string{"-config", path}, envFrom(nil), io.Discard); err == nil {
+			t.Errorf("%s: expected debug to be rejected as an unknown key", tc.name)
+		}
+	}
+}
+
+func TestLoadHelp(t *testing.T) {
+	var out bytes.Buffer
+	_, err := Load([]string{"-h"}, envFrom(nil), &out)
+	if !errors.Is(err, flag.ErrHelp) {
+		t.Fatalf("expected flag.ErrHelp, got %v", err)
+	}
+	if !strings.Contains(out.String(), "env CHIRP_EDIT_WINDOW") {
+		t.Errorf("expected usage to mention env vars, got:\n%s", out.String())
+	}
+}
+
+func TestValidate(t *testing.T) {
+	c := Default()
+	c.Server.Port = 0
+	c.Chirps.DeletedUserChirps = "keep"
+	c.Server.TrustedProxies = []string{"10.0.0.0/8", "nope"}
+	c.Jobs.Compact = "every night"
+
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, want := range []string{
+		"server.port",
+		"auth.jwt_secret",
+		"auth.polka_key",
+		"chirps.deleted_user_chirps",
+		`"nope"`,
+		"jobs.compact",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in:\n%v", want, err)
+		}
+	}
+
+	c = Default()
+	c.Auth.JWTSecret = "s"
+	c.Auth.PolkaKey = "k"
+	if err := c.Validate(); err != nil {
+		t.Errorf("expected defaults with secrets to be valid, got %v", err)
+	}
+}
+
+func TestReload(t *testing.T) {
+	c := Default()
+	next := Default()
+	next.Server.Port = 9000
+	next.Chirps.MaxLength = 280
+	next.Log.Level = "debug"
+
+	got, restart := c.Reload(next)
+	if got.Chirps.MaxLength != 280 || got.Log.Level != "debug" {
+		t.Errorf("expected reloadable settings to change, got %+v %+v", got.Chirps, got.Log)
+	}
+	if got.Server.Port != 8080 {
+		t.Errorf("expected port to be kept, got %d", got.Server.Port)
+	}
+	if len(restart) != 1 || restart[0] != "server.port" {
+		t.Errorf("expected server.port to need a restart, got %v", restart)
+	}
+}
+
+func TestWriteYAMLRedactsSecrets(t *testing.T) {
+	c := Default()
+	c.Auth.JWTSecret = "hunter2"
+
+	var out bytes.Buffer
+	if err := c.WriteYAML(&out); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "hunter2") {
+		t.Fatalf("secret leaked:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "edit_window: 15m0s") {
+		t.Errorf("expected durations as strings, got:\n%s", out.String())
+	}
+
+	// the output is a valid config file
+	path := writeFile(t, "shown.yaml", out.String())
+	shown, err := Load([]string{"-config", path}, envFrom(nil), io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shown.Chirps != c.Chirps || shown.Auth.JWTSecret != "[REDACTED]" {
+		t.Errorf("unexpected round trip %+v %+v", shown.Chirps, shown.Auth)
+	}
+}
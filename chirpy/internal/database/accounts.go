@@ -0,0 +1,217 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// UserExport is everything stored about a single user.
+type UserExport struct {
+	User              User                    `json:"user"`
+	Sessions          []time.Time             `json:"session_expiries"`
+	Chirps            []Chirp                 `json:"chirps"`
+	Drafts            []Draft                 `json:"drafts"`
+	ChirpRevisions    map[int][]ChirpRevision `json:"chirp_revisions"`
+	Media             []Media                 `json:"media"`
+	Notifications     []Notification          `json:"notifications"`
+	Blocks            []Relation              `json:"blocks"`
+	Mutes             []Relation              `json:"mutes"`
+	Following         []Relation              `json:"following"`
+	Reports           []Report                `json:"reports"`
+	ModerationActions []ModerationAction      `json:"moderation_actions"`
+	Appeals           []Appeal                `json:"appeals"`
+}
+
+// ExportUser collects every record that belongs to, or is about, a user.
+func (db *DB) ExportUser(ctx context.Context, id int) (UserExport, error) {
+	ctx, span := db.startSpan(ctx, "ExportUser")
+	defer span.End()
+
+	dbStructure, err := db.loadDB(ctx)
+	if err != nil {
+		return UserExport{}, err
+	}
+
+	user, ok := dbStructure.Users[id]
+	if !ok {
+		return UserExport{}, ErrNotExist
+	}
+
+	export := UserExport{
+		User:              user,
+		Sessions:          []time.Time{},
+		Chirps:            []Chirp{},
+		Drafts:            []Draft{},
+		ChirpRevisions:    map[int][]ChirpRevision{},
+		Media:             []Media{},
+		Notifications:     []Notification{},
+		Blocks:            []Relation{},
+		Mutes:             []Relation{},
+		Following:         []Relation{},
+		Reports:           []Report{},
+		ModerationActions: []ModerationAction{},
+		Appeals:           []Appeal{},
+	}
+
+	for _, token := range dbStructure.RefreshTokens {
+		if token.UserID == id {
+			export.Sessions = append(export.Sessions, token.ExpiresAt)
+		}
+	}
+	for _, chirp := range dbStructure.Chirps {
+		if chirp.AuthorID != id {
+			continue
+		}
+		export.Chirps = append(export.Chirps, chirp)
+		if revisions, ok := dbStructure.ChirpRevisions[chirp.ID]; ok {
+			export.ChirpRevisions[chirp.ID] = revisions
+		}
+	}
+	for _, draft := range dbStructure.Drafts {
+		if draft.AuthorID == id {
+			export.Drafts = append(export.Drafts, draft)
+		}
+	}
+	for _, m := range dbStructure.Media {
+		if m.OwnerID == id {
+			export.Media = append(export.Media, m)
+		}
+	}
+	for _, n := range dbStructure.Notifications {
+		if n.UserID == id {
+			export.Notifications = append(export.Notifications, n)
+		}
+	}
+	for blockedID, createdAt := range dbStructure.Blocks[id] {
+		export.Blocks = append(export.Blocks, Relation{UserID: blockedID, CreatedAt: createdAt})
+	}
+	for mutedID, createdAt := range dbStructure.Mutes[id] {
+		export.Mutes = append(export.Mutes, Relation{UserID: mutedID, CreatedAt: createdAt})
+	}
+	for followedID, createdAt := range dbStructure.Follows[id] {
+		export.Following = append(export.Following, Relation{UserID: followedID, CreatedAt: createdAt})
+	}
+	for _, report := range dbStructure.Reports {
+		if report.ReporterID == id {
+			export.Reports = append(export.Reports, report)
+		}
+	}
+	for _, action := range dbStructure.ModerationActions {
+		if action.TargetUserID == id {
+			export.ModerationActions = append(export.ModerationActions, action)
+		}
+	}
+	for _, appeal := range dbStructure.Appeals {
+		if appeal.UserID == id {
+			export.Appeals = append(export.Appeals, appeal)
+		}
+	}
+
+	return export, nil
+}
+
+// DeleteUser removes a user, their sessions, drafts, notifications,
+// blocks, mutes, follows and media. Their chirps are deleted, or if anonymize is set, kept
+// with the author and any media attachments detached from the account.
+// Mentions of the user in other chirps are dropped. Audit log entries
+// about the user are kept. The blob keys that
+// are no longer referenced by any media are returned so the caller can
+// remove them from blob storage.
+func (db *DB) DeleteUser(ctx context.Context, id int, anonymize bool) ([]string, error) {
+	ctx, span := db.startSpan(ctx, "DeleteUser")
+	defer span.End()
+
+	var deleted []Chirp
+	removedKeys := map[string]struct{}{}
+	err := db.update(ctx, func(dbStructure *DBStructure) error {
+		if _, ok := dbStructure.Users[id]; !ok {
+			return ErrNotExist
+		}
+		delete(dbStructure.Users, id)
+
+		for token, refreshToken := range dbStructure.RefreshTokens {
+			if refreshToken.UserID == id {
+				delete(dbStructure.RefreshTokens, token)
+			}
+		}
+
+		for draftID, draft := range dbStructure.Drafts {
+			if draft.AuthorID == id {
+				delete(dbStructure.Drafts, draftID)
+			}
+		}
+
+		keptMedia := map[int]struct{}{}
+		for chirpID, chirp := range dbStructure.Chirps {
+			if chirp.AuthorID == id {
+				if !anonymize {
+					delete(dbStructure.Chirps, chirpID)
+					delete(dbStructure.ChirpRevisions, chirpID)
+					deleted = append(deleted, chirp)
+					continue
+				}
+				chirp.AuthorID = 0
+				for _, mediaID := range chirp.MediaIDs {
+					keptMedia[mediaID] = struct{}{}
+				}
+			}
+
+			mentions := chirp.Mentions[:0:0]
+			for _, m := range chirp.Mentions {
+				if m.UserID != id {
+					mentions = append(mentions, m)
+				}
+			}
+			chirp.Mentions = mentions
+			dbStructure.Chirps[chirpID] = chirp
+		}
+
+		for mediaID, m := range dbStructure.Media {
+			if m.OwnerID != id {
+				continue
+			}
+			if _, ok := keptMedia[mediaID]; ok {
+				m.OwnerID = 0
+				dbStructure.Media[mediaID] = m
+				continue
+			}
+			delete(dbStructure.Media, mediaID)
+			removedKeys[m.BlobKey] = struct{}{}
+			if m.ThumbnailKey != "" {
+				removedKeys[m.ThumbnailKey] = struct{}{}
+			}
+		}
+		// content addressed blobs may be shared with other users' uploads
+		for _, m := range dbStructure.Media {
+			delete(removedKeys, m.BlobKey)
+			delete(removedKeys, m.ThumbnailKey)
+		}
+
+		for notificationID, n := range dbStructure.Notifications {
+			if n.UserID == id || n.ActorID == id {
+				delete(dbStructure.Notifications, notificationID)
+			}
+		}
+
+		for _, relations := range []map[int]map[int]time.Time{dbStructure.Blocks, dbStructure.Mutes, dbStructure.Follows} {
+			delete(relations, id)
+			for fromID, to := range relations {
+				delete(to, id)
+				if len(to) == 0 {
+					delete(relations, fromID)
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	db.publish(EventChirpDeleted, deleted...)
+
+	orphaned := make([]string, 0, len(removedKeys))
+	for key := range removedKeys {
+		orphaned = append(orphaned, key)
+	}
+	return orphaned, nil
+}
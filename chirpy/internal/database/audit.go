@@ -0,0 +1,176 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrAuditTampered is returned by VerifyAuditLog when an entry no longer
+// matches its hash or the entry before it.
+var ErrAuditTampered = errors.New("audit log has been tampered with")
+
+type AuditEvent string
+
+const (
+	AuditLogin        AuditEvent = "auth.login"
+	AuditLoginFailed  AuditEvent = "auth.login_failed"
+	AuditTokenRevoked AuditEvent = "auth.token_revoked"
+
+	AuditAccountCreated   AuditEvent = "account.created"
+	AuditEmailChanged     AuditEvent = "account.email_changed"
+	AuditPasswordChanged  AuditEvent = "account.password_changed"
+	AuditAccountDeleted   AuditEvent = "account.deleted"
+	AuditAccountUpgraded  AuditEvent = "account.upgraded"
+	AuditModerationAction AuditEvent = "admin.moderation_action"
+	AuditAppealResolved   AuditEvent = "admin.appeal_resolved"
+	AuditJobRun           AuditEvent = "admin.job_run"
+)
+
+// AuditEntry is one security-relevant event. The audit log is append
+// only: each entry's Hash covers its contents and the Hash of the entry
+// before it, so changing or removing an entry breaks the chain from that
+// point on. Entries outlive the accounts they mention.
+type AuditEntry struct {
+	ID    int        `json:"id"`
+	Time  time.Time  `json:"time"`
+	Event AuditEvent `json:"event"`
+	// ActorID is who caused the event, or 0 for someone not logged in or
+	// a webhook. UserID is the account it happened to.
+	ActorID  int               `json:"actor_id,omitempty"`
+	UserID   int               `json:"user_id,omitempty"`
+	IP       string            `json:"ip,omitempty"`
+	Details  map[string]string `json:"details,omitempty"`
+	PrevHash string            `json:"prev_hash"`
+	Hash     string            `json:"hash"`
+}
+
+// hash returns the hash the entry should have, given its PrevHash.
+func (e AuditEntry) hash() (string, error) {
+	e.Hash = ""
+	dat, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(dat)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// AppendAudit adds entry to the end of the audit log, filling in its ID,
+// time and hashes, and returns it.
+func (db *DB) AppendAudit(ctx context.Context, entry AuditEntry) (AuditEntry, error) {
+	ctx, span := db.startSpan(ctx, "AppendAudit")
+	defer span.End()
+
+	err := db.update(ctx, func(dbStructure *DBStructure) error {
+		entry.ID = len(dbStructure.AuditLog) + 1
+		entry.Time = time.Now().UTC()
+		entry.PrevHash = ""
+		if n := len(dbStructure.AuditLog); n > 0 {
+			entry.PrevHash = dbStructure.AuditLog[n-1].Hash
+		}
+		var err error
+		entry.Hash, err = entry.hash()
+		if err != nil {
+			return err
+		}
+		dbStructure.AuditLog = append(dbStructure.AuditLog, entry)
+		return nil
+	})
+	if err != nil {
+		return AuditEntry{}, err
+	}
+	return entry, nil
+}
+
+// AuditFilter narrows GetAuditLog. Zero fields match everything.
+type AuditFilter struct {
+	// UserID matches entries where the user is the actor or the account
+	// affected.
+	UserID int
+	// Event matches an event exactly or, if it ends in ".", every event
+	// starting with it, such as "auth.".
+	Event AuditEvent
+	Since time.Time
+	Until time.Time
+	Limit int
+}
+
+func (f AuditFilter) matches(e AuditEntry) bool {
+	if f.UserID != 0 && e.ActorID != f.UserID && e.UserID != f.UserID {
+		return false
+	}
+	if f.Event != "" {
+		if prefix, ok := strings.CutSuffix(string(f.Event), "."); ok {
+			if !strings.HasPrefix(string(e.Event), prefix+".") {
+				return false
+			}
+		} else if e.Event != f.Event {
+			return false
+		}
+	}
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !e.Time.Before(f.Until) {
+		return false
+	}
+	return true
+}
+
+// GetAuditLog returns the entries matching filter, newest first.
+func (db *DB) GetAuditLog(ctx context.Context, filter AuditFilter) ([]AuditEntry, error) {
+	ctx, span := db.startSpan(ctx, "GetAuditLog")
+	defer span.End()
+
+	dbStructure, err := db.loadDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []AuditEntry{}
+	for i := len(dbStructure.AuditLog) - 1; i >= 0; i-- {
+		if filter.Limit > 0 && len(entries) == filter.Limit {
+			break
+		}
+		if filter.matches(dbStructure.AuditLog[i]) {
+			entries = append(entries, dbStructure.AuditLog[i])
+		}
+	}
+	return entries, nil
+}
+
+// VerifyAuditLog checks the hash chain and returns the number of entries
+// and the hash of the last one, which can be kept elsewhere to notice
+// the whole log being rewritten. A broken chain is reported with an
+// error wrapping ErrAuditTampered.
+func (db *DB) VerifyAuditLog(ctx context.Context) (int, string, error) {
+	ctx, span := db.startSpan(ctx, "VerifyAuditLog")
+	defer span.End()
+
+	dbStructure, err := db.loadDB(ctx)
+	if err != nil {
+		return 0, "", err
+	}
+
+	prev := ""
+	for i, entry := range dbStructure.AuditLog {
+		if entry.ID != i+1 || entry.PrevHash != prev {
+			return i, prev, fmt.Errorf("%w: entry %d is out of sequence", ErrAuditTampered, i+1)
+		}
+		hash, err := entry.hash()
+		if err != nil {
+			return i, prev, err
+		}
+		if hash != entry.Hash {
+			return i, prev, fmt.Errorf("%w: entry %d doesn't match its hash", ErrAuditTampered, entry.ID)
+		}
+		prev = entry.Hash
+	}
+	return len(dbStructure.AuditLog), prev, nil
+}
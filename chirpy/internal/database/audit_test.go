@@ -0,0 +1,106 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAuditLogChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.json")
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	for _, entry := range []AuditEntry{
+		{Event: AuditLogin, ActorID: 1, UserID: 1, IP: "192.0.2.1"},
+		{Event: AuditEmailChanged, ActorID: 1, UserID: 1, Details: map[string]string{"from": "a@example.com", "to": "b@example.com"}},
+		{Event: AuditAccountUpgraded, UserID: 2},
+	} {
+		if _, err := db.AppendAudit(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, head, err := db.VerifyAuditLog(ctx)
+	if err != nil || entries != 3 || head == "" {
+		t.Fatalf("expected a valid chain of 3, got %d %q %v", entries, head, err)
+	}
+
+	got, err := db.GetAuditLog(ctx, AuditFilter{UserID: 1, Event: "account."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Event != AuditEmailChanged || got[0].PrevHash == "" {
+		t.Errorf("expected the email change, got %+v", got)
+	}
+
+	// quietly rewrite history, as someone with access to the file might
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw map[string]any
+	if err := json.Unmarshal(dat, &raw); err != nil {
+		t.Fatal(err)
+	}
+	raw["audit_log"].([]any)[1].(map[string]any)["details"].(map[string]any)["to"] = "mallory@example.com"
+	dat, _ = json.Marshal(raw)
+	if err := os.WriteFile(path, dat, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, _, err = db.VerifyAuditLog(ctx)
+	if !errors.Is(err, ErrAuditTampered) || entries != 1 {
+		t.Errorf("expected the edit to be caught at entry 2, got %d %v", entries, err)
+	}
+}
+
+func TestAuditLogConcurrentAppends(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "database.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	const n = 50
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if i%2 == 0 {
+				// interleave other writes, which mustn't drop entries either
+				if err := db.SaveRefreshToken(ctx, 1, fmt.Sprint("token", i), time.Hour); err != nil {
+					errs <- err
+				}
+			}
+			_, err := db.AppendAudit(ctx, AuditEntry{Event: AuditLogin, UserID: i})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, _, err := db.VerifyAuditLog(ctx)
+	if err != nil || entries != n {
+		t.Errorf("expected a valid chain of %d, got %d %v", n, entries, err)
+	}
+	if sessions, _ := db.CountActiveSessions(ctx); sessions != n/2 {
+		t.Errorf("expected %d refresh tokens, got %d", n/2, sessions)
+	}
+}
@@ -1,42 +1,137 @@
 package database
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"time"
+)
+
+var ErrEditWindowClosed = errors.New("edit window has closed")
+
+// ErrVersionMismatch is returned by writes made against a version of a
+// chirp that is no longer current.
+var ErrVersionMismatch = errors.New("chirp has changed")
+
 type Chirp struct {
-	ID       int    `json:"id"`
-	Body     string `json:"body"`
-	AuthorID int    `json:"author_id"`
+	ID        int        `json:"id"`
+	Body      string     `json:"body"`
+	AuthorID  int        `json:"author_id"`
+	MediaIDs  []int      `json:"media_ids,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	EditedAt  *time.Time `json:"edited_at,omitempty"`
+	Revision  int        `json:"revision"`
+	InReplyTo int        `json:"in_reply_to,omitempty"`
+	Mentions  []Mention  `json:"mentions,omitempty"`
+	Hashtags  []Hashtag  `json:"hashtags,omitempty"`
+	// Hidden chirps were taken down by a moderator and are only visible
+	// to their author.
+	Hidden bool `json:"hidden,omitempty"`
+}
+
+// Version hashes everything that changes a chirp's representation: edits
+// bump the revision, and moderation, account deletion and media are
+// hashed in directly. The body and creation time are hashed too, so a
+// chirp can't share a version with an older one by the same author.
+func (c Chirp) Version() uint64 {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d:%d:%d:%t:%d:%v:%d:%q", c.ID, c.Revision, c.AuthorID, c.Hidden, c.InReplyTo, c.MediaIDs, c.CreatedAt.UnixNano(), c.Body)
+	return h.Sum64()
+}
+
+// Mention is an @mention in a chirp body that resolved to a user. Start
+// and End are byte offsets into the body.
+type Mention struct {
+	UserID int    `json:"user_id"`
+	Text   string `json:"text"`
+	Start  int    `json:"start"`
+	End    int    `json:"end"`
 }
 
-func (db *DB) CreateChirp(body string, authorID int) (Chirp, error) {
-	dbStructure, err := db.loadDB()
+// Hashtag is a #tag in a chirp body. Tag is stored lowercased without
+// the leading '#'.
+type Hashtag struct {
+	Tag   string `json:"tag"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+type CreateChirpParams struct {
+	Body      string
+	AuthorID  int
+	MediaIDs  []int
+	InReplyTo int
+	Mentions  []Mention
+	Hashtags  []Hashtag
+}
+
+// ChirpRevision is a snapshot of a chirp body as it was before an edit.
+type ChirpRevision struct {
+	Revision  int       `json:"revision"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (db *DB) CreateChirp(ctx context.Context, params CreateChirpParams) (Chirp, error) {
+	ctx, span := db.startSpan(ctx, "CreateChirp")
+	defer span.End()
+
+	var chirp Chirp
+	err := db.update(ctx, func(dbStructure *DBStructure) error {
+		var err error
+		chirp, err = insertChirp(dbStructure, params)
+		return err
+	})
 	if err != nil {
 		return Chirp{}, err
 	}
+	db.publish(EventChirpCreated, chirp)
 
-	id := len(dbStructure.Chirps) + 1
-	for {
-		if _, ok := dbStructure.Chirps[id]; !ok {
-			break
-		}
-		id++
-	}
-	
-	chirp := Chirp{
-		ID:       id,
-		Body:     body,
-		AuthorID: authorID,
-	}
-	dbStructure.Chirps[id] = chirp
+	return chirp, nil
+}
 
-	err = db.writeDB(dbStructure)
+// insertChirp adds a new chirp to dbStructure, checking its media and
+// the chirp it replies to.
+func insertChirp(dbStructure *DBStructure, params CreateChirpParams) (Chirp, error) {
+	err := checkMediaIDs(*dbStructure, params.AuthorID, params.MediaIDs)
 	if err != nil {
 		return Chirp{}, err
 	}
+	if params.InReplyTo != 0 {
+		if _, ok := dbStructure.Chirps[params.InReplyTo]; !ok {
+			return Chirp{}, ErrNotExist
+		}
+	}
 
+	// files written before LastChirpID existed only have the map
+	for id := range dbStructure.Chirps {
+		dbStructure.LastChirpID = max(dbStructure.LastChirpID, id)
+	}
+	dbStructure.LastChirpID++
+	id := dbStructure.LastChirpID
+
+	chirp := Chirp{
+		ID:        id,
+		Body:      params.Body,
+		AuthorID:  params.AuthorID,
+		MediaIDs:  params.MediaIDs,
+		CreatedAt: time.Now().UTC(),
+		Revision:  1,
+		InReplyTo: params.InReplyTo,
+		Mentions:  params.Mentions,
+		Hashtags:  params.Hashtags,
+	}
+	dbStructure.Chirps[id] = chirp
 	return chirp, nil
 }
 
-func (db *DB) GetChirps() ([]Chirp, error) {
-	dbStructure, err := db.loadDB()
+func (db *DB) GetChirps(ctx context.Context) ([]Chirp, error) {
+	ctx, span := db.startSpan(ctx, "GetChirps")
+	defer span.End()
+
+	dbStructure, err := db.loadDB(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -49,8 +144,11 @@ func (db *DB) GetChirps() ([]Chirp, error) {
 	return chirps, nil
 }
 
-func (db *DB) GetChirp(id int) (Chirp, error) {
-	dbStructure, err := db.loadDB()
+func (db *DB) GetChirp(ctx context.Context, id int) (Chirp, error) {
+	ctx, span := db.startSpan(ctx, "GetChirp")
+	defer span.End()
+
+	dbStructure, err := db.loadDB(ctx)
 	if err != nil {
 		return Chirp{}, err
 	}
@@ -63,25 +161,233 @@ func (db *DB) GetChirp(id int) (Chirp, error) {
 	return chirp, nil
 }
 
-func (db *DB) DeleteChirp(id int) error {
-	dbStructure, err := db.loadDB()
+// GetChirpsByID returns the chirps with the given IDs in one read. IDs
+// that don't exist are left out of the result.
+func (db *DB) GetChirpsByID(ctx context.Context, ids []int) (map[int]Chirp, error) {
+	ctx, span := db.startSpan(ctx, "GetChirpsByID")
+	defer span.End()
+
+	dbStructure, err := db.loadDB(ctx)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	chirps := make(map[int]Chirp, len(ids))
+	for _, id := range ids {
+		if chirp, ok := dbStructure.Chirps[id]; ok {
+			chirps[id] = chirp
+		}
+	}
+	return chirps, nil
+}
+
+// GetChirpsByAuthor returns the chirps of each of the given authors,
+// newest first, in one read.
+func (db *DB) GetChirpsByAuthor(ctx context.Context, authorIDs []int) (map[int][]Chirp, error) {
+	ctx, span := db.startSpan(ctx, "GetChirpsByAuthor")
+	defer span.End()
+
+	dbStructure, err := db.loadDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	chirps := make(map[int][]Chirp, len(authorIDs))
+	for _, id := range authorIDs {
+		chirps[id] = []Chirp{}
+	}
+	for _, chirp := range dbStructure.Chirps {
+		if list, ok := chirps[chirp.AuthorID]; ok {
+			chirps[chirp.AuthorID] = append(list, chirp)
+		}
+	}
+	for _, list := range chirps {
+		sort.Slice(list, func(i, j int) bool {
+			return list[i].ID > list[j].ID
+		})
+	}
+	return chirps, nil
+}
+
+// UpdateChirp replaces the body and entities of a chirp, archiving the
+// previous body as a revision. Edits are only allowed within window of
+// the chirp's creation. If version isn't zero the chirp must still be at
+// that version, or ErrVersionMismatch is returned.
+func (db *DB) UpdateChirp(ctx context.Context, id int, version uint64, body string, mentions []Mention, hashtags []Hashtag, window time.Duration) (Chirp, error) {
+	ctx, span := db.startSpan(ctx, "UpdateChirp")
+	defer span.End()
+
+	var chirp Chirp
+	err := db.update(ctx, func(dbStructure *DBStructure) error {
+		var ok bool
+		chirp, ok = dbStructure.Chirps[id]
+		if !ok {
+			return ErrNotExist
+		}
+		if version != 0 && chirp.Version() != version {
+			return ErrVersionMismatch
+		}
+
+		now := time.Now().UTC()
+		if chirp.CreatedAt.IsZero() || now.After(chirp.CreatedAt.Add(window)) {
+			return ErrEditWindowClosed
+		}
+
+		revisionCreatedAt := chirp.CreatedAt
+		if chirp.EditedAt != nil {
+			revisionCreatedAt = *chirp.EditedAt
+		}
+		dbStructure.ChirpRevisions[id] = append(dbStructure.ChirpRevisions[id], ChirpRevision{
+			Revision:  max(chirp.Revision, 1),
+			Body:      chirp.Body,
+			CreatedAt: revisionCreatedAt,
+		})
+
+		chirp.Body = body
+		chirp.Mentions = mentions
+		chirp.Hashtags = hashtags
+		chirp.EditedAt = &now
+		chirp.Revision = max(chirp.Revision, 1) + 1
+		dbStructure.Chirps[id] = chirp
+		return nil
+	})
+	if err != nil {
+		return Chirp{}, err
+	}
+	db.publish(EventChirpUpdated, chirp)
+
+	return chirp, nil
+}
+
+// GetChirpRevisions returns every previous revision of a chirp, oldest
+// first. The current body is not included.
+func (db *DB) GetChirpRevisions(ctx context.Context, id int) ([]ChirpRevision, error) {
+	ctx, span := db.startSpan(ctx, "GetChirpRevisions")
+	defer span.End()
+
+	dbStructure, err := db.loadDB(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	// Check if the chirp exists
 	if _, ok := dbStructure.Chirps[id]; !ok {
-		return ErrNotExist
+		return nil, ErrNotExist
 	}
 
-	// Delete the chirp
-	delete(dbStructure.Chirps, id)
+	revisions := make([]ChirpRevision, len(dbStructure.ChirpRevisions[id]))
+	copy(revisions, dbStructure.ChirpRevisions[id])
+	return revisions, nil
+}
+
+// DeleteChirp removes a chirp along with its revisions: a deleted chirp's
+// earlier bodies are gone too, rather than kept where nothing can read
+// them. If version isn't zero the chirp must still be at that version, or
+// ErrVersionMismatch is returned.
+func (db *DB) DeleteChirp(ctx context.Context, id int, version uint64) error {
+	ctx, span := db.startSpan(ctx, "DeleteChirp")
+	defer span.End()
+
+	var chirp Chirp
+	err := db.update(ctx, func(dbStructure *DBStructure) error {
+		// Check if the chirp exists
+		var ok bool
+		chirp, ok = dbStructure.Chirps[id]
+		if !ok {
+			return ErrNotExist
+		}
+		if version != 0 && chirp.Version() != version {
+			return ErrVersionMismatch
+		}
 
-	// Persist the changes to the database
-	err = db.writeDB(dbStructure)
+		// Delete the chirp
+		delete(dbStructure.Chirps, id)
+		delete(dbStructure.ChirpRevisions, id)
+		return nil
+	})
 	if err != nil {
 		return err
 	}
+	db.publish(EventChirpDeleted, chirp)
 
 	return nil
 }
+
+// GetChirpsByHashtag returns every chirp tagged with tag, newest first.
+func (db *DB) GetChirpsByHashtag(ctx context.Context, tag string) ([]Chirp, error) {
+	ctx, span := db.startSpan(ctx, "GetChirpsByHashtag")
+	defer span.End()
+
+	dbStructure, err := db.loadDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	chirps := []Chirp{}
+	for _, chirp := range dbStructure.Chirps {
+		if chirp.hasHashtag(tag) {
+			chirps = append(chirps, chirp)
+		}
+	}
+	sort.Slice(chirps, func(i, j int) bool {
+		return chirps[i].ID > chirps[j].ID
+	})
+
+	return chirps, nil
+}
+
+type HashtagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// TrendingHashtags counts how many chirps created after since use each
+// hashtag and returns the top limit tags, most used first.
+func (db *DB) TrendingHashtags(ctx context.Context, since time.Time, limit int) ([]HashtagCount, error) {
+	ctx, span := db.startSpan(ctx, "TrendingHashtags")
+	defer span.End()
+
+	dbStructure, err := db.loadDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := map[string]int{}
+	for _, chirp := range dbStructure.Chirps {
+		if chirp.CreatedAt.Before(since) || chirp.Hidden {
+			continue
+		}
+		seen := map[string]struct{}{}
+		for _, h := range chirp.Hashtags {
+			if _, ok := seen[h.Tag]; ok {
+				continue
+			}
+			seen[h.Tag] = struct{}{}
+			counts[h.Tag]++
+		}
+	}
+
+	trending := make([]HashtagCount, 0, len(counts))
+	for tag, count := range counts {
+		trending = append(trending, HashtagCount{Tag: tag, Count: count})
+	}
+	sort.Slice(trending, func(i, j int) bool {
+		if trending[i].Count != trending[j].Count {
+			return trending[i].Count > trending[j].Count
+		}
+		return trending[i].Tag < trending[j].Tag
+	})
+	if len(trending) > limit {
+		trending = trending[:limit]
+	}
+
+	return trending, nil
+}
+
+func (c Chirp) hasHashtag(tag string) bool {
+	for _, h := range c.Hashtags {
+		if h.Tag == tag {
+			return true
+		}
+	}
+	return false
+}
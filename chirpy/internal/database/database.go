@@ -1,23 +1,120 @@
 package database
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"os"
+	"path/filepath"
 	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var ErrNotExist = errors.New("resource does not exist")
 
+// ErrClosed is returned by writes made after Close.
+var ErrClosed = errors.New("database is closed")
+
 type DB struct {
-	path string
-	mu   *sync.RWMutex
+	path      string
+	mu        *sync.RWMutex
+	observer  Observer
+	publisher Publisher
+	closed    bool
+}
+
+// Observer is called after every read or write of the database file with
+// the operation ("load" or "write"), how long it took and its error.
+type Observer func(op string, d time.Duration, err error)
+
+// SetObserver registers a function to be told about database operations,
+// e.g. to record timings. It must be called before the DB is in use.
+func (db *DB) SetObserver(observer Observer) {
+	db.observer = observer
+}
+
+// Chirp event types passed to a Publisher.
+const (
+	EventChirpCreated = "chirp.created"
+	EventChirpUpdated = "chirp.updated"
+	EventChirpDeleted = "chirp.deleted"
+	// EventChirpHidden is a chirp taken down by a moderator.
+	EventChirpHidden = "chirp.hidden"
+)
+
+// Publisher is told about chirps that were created, edited, deleted or
+// hidden, once the change has been written. Deleted and hidden chirps
+// are passed as they were, so they reach everyone who could see them.
+type Publisher func(eventType string, chirp Chirp)
+
+// SetPublisher registers a function to be told about chirp changes, e.g.
+// to push them to streaming clients. It must be called before the DB is
+// in use.
+func (db *DB) SetPublisher(publisher Publisher) {
+	db.publisher = publisher
+}
+
+func (db *DB) publish(eventType string, chirps ...Chirp) {
+	if db.publisher == nil {
+		return
+	}
+	for _, chirp := range chirps {
+		db.publisher(eventType, chirp)
+	}
+}
+
+var tracer = otel.Tracer("github.com/JoshuaTapp/BootDevProjects/chirpy/internal/database")
+
+// startSpan starts a span for a DB method. The global tracer provider is
+// a no-op unless tracing has been set up, so this is cheap by default.
+func (db *DB) startSpan(ctx context.Context, method string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "DB."+method, trace.WithAttributes(
+		attribute.String("db.system", "jsonfile"),
+		attribute.String("db.operation", method),
+	))
+}
+
+func (db *DB) observe(op string, start time.Time, err error) {
+	if db.observer != nil {
+		db.observer(op, time.Since(start), err)
+	}
 }
 
 type DBStructure struct {
-	Chirps        map[int]Chirp           `json:"chirps"`
-	Users         map[int]User            `json:"users"`
-	RefreshTokens map[string]RefreshToken `json:"refresh_tokens"`
+	Chirps         map[int]Chirp           `json:"chirps"`
+	Users          map[int]User            `json:"users"`
+	RefreshTokens  map[string]RefreshToken `json:"refresh_tokens"`
+	Media          map[int]Media           `json:"media"`
+	ChirpRevisions map[int][]ChirpRevision `json:"chirp_revisions"`
+	Notifications  map[int]Notification    `json:"notifications"`
+	// Blocks and Mutes map a user ID to the set of user IDs they have
+	// blocked or muted, and when.
+	Blocks map[int]map[int]time.Time `json:"blocks"`
+	Mutes  map[int]map[int]time.Time `json:"mutes"`
+	// Follows maps a user ID to the set of user IDs they follow.
+	Follows map[int]map[int]time.Time `json:"follows"`
+
+	Reports           map[int]Report           `json:"reports"`
+	ModerationActions map[int]ModerationAction `json:"moderation_actions"`
+	Appeals           map[int]Appeal           `json:"appeals"`
+
+	Drafts map[int]Draft `json:"drafts"`
+
+	// LastUserID is the highest user ID ever given out. User IDs are never
+	// reused, so a new account can't take over the ID of a deleted one
+	// and whatever still refers to it.
+	LastUserID int `json:"last_user_id,omitempty"`
+	// LastChirpID is the same for chirps, so a new chirp can't be taken
+	// for a deleted one by caches, replies or notifications.
+	LastChirpID int `json:"last_chirp_id,omitempty"`
+
+	// AuditLog is only ever appended to; see AuditEntry.
+	AuditLog []AuditEntry `json:"audit_log"`
 }
 
 func NewDB(path string) (*DB, error) {
@@ -25,40 +122,131 @@ func NewDB(path string) (*DB, error) {
 		path: path,
 		mu:   &sync.RWMutex{},
 	}
-	err := db.ensureDB()
+	err := db.ensureDB(context.Background())
 	return db, err
 }
 
-func (db *DB) createDB() error {
-	dbStructure := DBStructure{
-		Chirps:        map[int]Chirp{},
-		Users:         map[int]User{},
-		RefreshTokens: map[string]RefreshToken{},
+func (db *DB) createDB(ctx context.Context) error {
+	dbStructure := DBStructure{}
+	dbStructure.initMaps()
+	return db.writeDB(ctx, dbStructure)
+}
+
+// initMaps makes sure every collection is non-nil, so database files
+// written before a collection existed can still be loaded and written to.
+func (dbStructure *DBStructure) initMaps() {
+	if dbStructure.Chirps == nil {
+		dbStructure.Chirps = map[int]Chirp{}
+	}
+	if dbStructure.Users == nil {
+		dbStructure.Users = map[int]User{}
+	}
+	if dbStructure.RefreshTokens == nil {
+		dbStructure.RefreshTokens = map[string]RefreshToken{}
+	}
+	if dbStructure.Media == nil {
+		dbStructure.Media = map[int]Media{}
+	}
+	if dbStructure.ChirpRevisions == nil {
+		dbStructure.ChirpRevisions = map[int][]ChirpRevision{}
+	}
+	if dbStructure.Notifications == nil {
+		dbStructure.Notifications = map[int]Notification{}
+	}
+	if dbStructure.Blocks == nil {
+		dbStructure.Blocks = map[int]map[int]time.Time{}
+	}
+	if dbStructure.Mutes == nil {
+		dbStructure.Mutes = map[int]map[int]time.Time{}
+	}
+	if dbStructure.Follows == nil {
+		dbStructure.Follows = map[int]map[int]time.Time{}
+	}
+	if dbStructure.Reports == nil {
+		dbStructure.Reports = map[int]Report{}
+	}
+	if dbStructure.ModerationActions == nil {
+		dbStructure.ModerationActions = map[int]ModerationAction{}
+	}
+	if dbStructure.Appeals == nil {
+		dbStructure.Appeals = map[int]Appeal{}
+	}
+	if dbStructure.Drafts == nil {
+		dbStructure.Drafts = map[int]Draft{}
+	}
+	if dbStructure.AuditLog == nil {
+		dbStructure.AuditLog = []AuditEntry{}
 	}
-	return db.writeDB(dbStructure)
 }
 
-func (db *DB) ensureDB() error {
+func (db *DB) ensureDB(ctx context.Context) error {
 	_, err := os.ReadFile(db.path)
 	if errors.Is(err, os.ErrNotExist) {
-		return db.createDB()
+		return db.createDB(ctx)
 	}
 	return err
 }
 
-func (db *DB) ResetDB() error {
+func (db *DB) ResetDB(ctx context.Context) error {
+	ctx, span := db.startSpan(ctx, "ResetDB")
+	defer span.End()
+
 	err := os.Remove(db.path)
 	if errors.Is(err, os.ErrNotExist) {
 		return nil
 	}
-	return db.ensureDB()
+	return db.ensureDB(ctx)
 }
 
-func (db *DB) loadDB() (DBStructure, error) {
+func (db *DB) loadDB(ctx context.Context) (DBStructure, error) {
 	db.mu.RLock()
 	defer db.mu.RUnlock()
+	return db.load(ctx)
+}
+
+func (db *DB) writeDB(ctx context.Context, dbStructure DBStructure) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.write(ctx, dbStructure)
+}
+
+// errUnchanged can be returned by an update function to skip the write
+// when it turns out there is nothing to change. update returns nil.
+var errUnchanged = errors.New("unchanged")
+
+// update loads the database, lets fn change it and writes it back,
+// holding the write lock throughout so no other write can land in
+// between and be lost. Nothing is written if fn returns an error.
+// Every method that changes the database goes through here.
+func (db *DB) update(ctx context.Context, fn func(dbStructure *DBStructure) error) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+	dbStructure, err := db.load(ctx)
+	if err != nil {
+		return err
+	}
+	err = fn(&dbStructure)
+	if errors.Is(err, errUnchanged) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return db.write(ctx, dbStructure)
+}
+
+// load reads the database file. The caller must hold db.mu.
+func (db *DB) load(ctx context.Context) (dbStructure DBStructure, err error) {
+	_, span := tracer.Start(ctx, "DB.loadDB")
+	defer func(start time.Time) {
+		db.observe("load", start, err)
+		endSpan(span, err)
+	}(time.Now())
 
-	dbStructure := DBStructure{}
 	dat, err := os.ReadFile(db.path)
 	if errors.Is(err, os.ErrNotExist) {
 		return dbStructure, err
@@ -67,13 +255,23 @@ func (db *DB) loadDB() (DBStructure, error) {
 	if err != nil {
 		return dbStructure, err
 	}
+	dbStructure.initMaps()
 
 	return dbStructure, nil
 }
 
-func (db *DB) writeDB(dbStructure DBStructure) error {
-	db.mu.Lock()
-	defer db.mu.Unlock()
+// write replaces the database file. The caller must hold db.mu for
+// writing.
+func (db *DB) write(ctx context.Context, dbStructure DBStructure) (err error) {
+	_, span := tracer.Start(ctx, "DB.writeDB")
+	defer func(start time.Time) {
+		db.observe("write", start, err)
+		endSpan(span, err)
+	}(time.Now())
+
+	if db.closed {
+		return ErrClosed
+	}
 
 	dat, err := json.Marshal(dbStructure)
 	if err != nil {
@@ -86,3 +284,138 @@ func (db *DB) writeDB(dbStructure DBStructure) error {
 	}
 	return nil
 }
+
+// Close waits for any write in progress, syncs the database file to disk
+// and rejects further writes. Reads keep working so requests still
+// draining during shutdown can finish.
+func (db *DB) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return nil
+	}
+	db.closed = true
+
+	f, err := os.Open(db.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
+
+// Ping checks that the database file can be read and parsed, and that
+// it and its directory can be written to, without changing anything.
+func (db *DB) Ping(ctx context.Context) error {
+	ctx, span := db.startSpan(ctx, "Ping")
+	defer span.End()
+
+	if _, err := db.loadDB(ctx); err != nil {
+		return err
+	}
+
+	db.mu.RLock()
+	closed := db.closed
+	db.mu.RUnlock()
+	if closed {
+		return ErrClosed
+	}
+
+	f, err := os.OpenFile(db.path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	f.Close()
+
+	probe, err := os.CreateTemp(filepath.Dir(db.path), ".ping-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(probe.Name())
+	_, err = probe.Write([]byte("ping"))
+	if closeErr := probe.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// CompactStats describes what Compact did.
+type CompactStats struct {
+	// Removed is the number of records dropped.
+	Removed    int
+	SizeBefore int64
+	SizeAfter  int64
+}
+
+// Compact drops records left behind by deletes: the revisions of and
+// notifications about chirps that no longer exist, and empty block, mute
+// and follow sets. The file is rewritten even if nothing was dropped, which
+// also sheds fields that are no longer in DBStructure. Other writes wait
+// until it is done.
+func (db *DB) Compact(ctx context.Context) (CompactStats, error) {
+	ctx, span := db.startSpan(ctx, "Compact")
+	defer span.End()
+
+	// not db.update, since the sizes have to be taken under the same lock
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	stats := CompactStats{}
+	if db.closed {
+		return stats, ErrClosed
+	}
+	info, err := os.Stat(db.path)
+	if err != nil {
+		return stats, err
+	}
+	stats.SizeBefore = info.Size()
+
+	dbStructure, err := db.load(ctx)
+	if err != nil {
+		return stats, err
+	}
+
+	for chirpID, revisions := range dbStructure.ChirpRevisions {
+		if _, ok := dbStructure.Chirps[chirpID]; !ok {
+			delete(dbStructure.ChirpRevisions, chirpID)
+			stats.Removed += len(revisions)
+		}
+	}
+	for notificationID, n := range dbStructure.Notifications {
+		if _, ok := dbStructure.Chirps[n.ChirpID]; n.ChirpID != 0 && !ok {
+			delete(dbStructure.Notifications, notificationID)
+			stats.Removed++
+		}
+	}
+	for _, relations := range []map[int]map[int]time.Time{dbStructure.Blocks, dbStructure.Mutes, dbStructure.Follows} {
+		for fromID, to := range relations {
+			if len(to) == 0 {
+				delete(relations, fromID)
+				stats.Removed++
+			}
+		}
+	}
+
+	err = db.write(ctx, dbStructure)
+	if err != nil {
+		return stats, err
+	}
+	info, err = os.Stat(db.path)
+	if err != nil {
+		return stats, err
+	}
+	stats.SizeAfter = info.Size()
+	return stats, nil
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCompactConcurrentWrites(t *testing.T) {
+	db, err := NewDB(filepath.Join(t.TempDir(), "database.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// a revision and a notification left behind by a deleted chirp
+	chirp, err := db.CreateChirp(ctx, CreateChirpParams{Body: "first", AuthorID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.UpdateChirp(ctx, chirp.ID, 0, "edited", nil, nil, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.CreateNotification(ctx, 2, NotificationReplied, 1, chirp.ID); err != nil {
+		t.Fatal(err)
+	}
+	dbStructure, err := db.loadDB(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delete(dbStructure.Chirps, chirp.ID)
+	if err := db.writeDB(ctx, dbStructure); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := db.Compact(ctx)
+	if err != nil || stats.Removed != 2 || stats.SizeAfter >= stats.SizeBefore {
+		t.Fatalf("expected the deleted chirp's revision and notification to be dropped, got %+v %v", stats, err)
+	}
+
+	const n = 50
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*n)
+	for i := 0; i < n; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, err := db.CreateChirp(ctx, CreateChirpParams{Body: "chirp", AuthorID: 1})
+			errs <- err
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := db.Compact(ctx)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	chirps, err := db.GetChirps(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chirps) != n {
+		t.Errorf("expected %d chirps to survive compaction, got %d", n, len(chirps))
+	}
+}
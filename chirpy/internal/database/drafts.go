@@ -0,0 +1,260 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+)
+
+var (
+	// ErrDraftChanged is returned by PublishDraft when the draft was
+	// edited after it was read.
+	ErrDraftChanged = errors.New("draft has changed")
+	// ErrReplyNotExist is returned by PublishDraft when the chirp the
+	// draft replies to has been deleted.
+	ErrReplyNotExist = errors.New("replied to chirp does not exist")
+)
+
+// Draft is a chirp that hasn't been published. Drafts with a PublishAt
+// are scheduled and published by the scheduler once it has passed; the
+// rest wait for their author. Either way they are only visible to their
+// author until published.
+type Draft struct {
+	ID        int        `json:"id"`
+	AuthorID  int        `json:"author_id"`
+	Body      string     `json:"body"`
+	MediaIDs  []int      `json:"media_ids,omitempty"`
+	InReplyTo int        `json:"in_reply_to,omitempty"`
+	PublishAt *time.Time `json:"publish_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	// PublishError says why a scheduled draft couldn't be published. The
+	// draft is unscheduled so it isn't retried until its author saves it
+	// again.
+	PublishError string `json:"publish_error,omitempty"`
+}
+
+// Scheduled reports whether the draft is waiting to be published.
+func (d Draft) Scheduled() bool {
+	return d.PublishAt != nil
+}
+
+type DraftParams struct {
+	Body      string
+	MediaIDs  []int
+	InReplyTo int
+	PublishAt *time.Time
+}
+
+func (db *DB) CreateDraft(ctx context.Context, authorID int, params DraftParams) (Draft, error) {
+	ctx, span := db.startSpan(ctx, "CreateDraft")
+	defer span.End()
+
+	var draft Draft
+	err := db.update(ctx, func(dbStructure *DBStructure) error {
+		err := checkMediaIDs(*dbStructure, authorID, params.MediaIDs)
+		if err != nil {
+			return err
+		}
+
+		id := len(dbStructure.Drafts) + 1
+		for {
+			if _, ok := dbStructure.Drafts[id]; !ok {
+				break
+			}
+			id++
+		}
+
+		now := time.Now().UTC()
+		draft = Draft{
+			ID:        id,
+			AuthorID:  authorID,
+			Body:      params.Body,
+			MediaIDs:  params.MediaIDs,
+			InReplyTo: params.InReplyTo,
+			PublishAt: params.PublishAt,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		dbStructure.Drafts[id] = draft
+		return nil
+	})
+	if err != nil {
+		return Draft{}, err
+	}
+	return draft, nil
+}
+
+func (db *DB) GetDraft(ctx context.Context, id int) (Draft, error) {
+	ctx, span := db.startSpan(ctx, "GetDraft")
+	defer span.End()
+
+	dbStructure, err := db.loadDB(ctx)
+	if err != nil {
+		return Draft{}, err
+	}
+
+	draft, ok := dbStructure.Drafts[id]
+	if !ok {
+		return Draft{}, ErrNotExist
+	}
+	return draft, nil
+}
+
+// GetDrafts returns a user's drafts, newest first.
+func (db *DB) GetDrafts(ctx context.Context, authorID int) ([]Draft, error) {
+	ctx, span := db.startSpan(ctx, "GetDrafts")
+	defer span.End()
+
+	dbStructure, err := db.loadDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	drafts := []Draft{}
+	for _, draft := range dbStructure.Drafts {
+		if draft.AuthorID == authorID {
+			drafts = append(drafts, draft)
+		}
+	}
+	sort.Slice(drafts, func(i, j int) bool {
+		return drafts[i].ID > drafts[j].ID
+	})
+	return drafts, nil
+}
+
+// GetDueDrafts returns the drafts scheduled at or before now, oldest
+// publish time first.
+func (db *DB) GetDueDrafts(ctx context.Context, now time.Time) ([]Draft, error) {
+	ctx, span := db.startSpan(ctx, "GetDueDrafts")
+	defer span.End()
+
+	dbStructure, err := db.loadDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	drafts := []Draft{}
+	for _, draft := range dbStructure.Drafts {
+		if draft.Scheduled() && !draft.PublishAt.After(now) {
+			drafts = append(drafts, draft)
+		}
+	}
+	sort.Slice(drafts, func(i, j int) bool {
+		if !drafts[i].PublishAt.Equal(*drafts[j].PublishAt) {
+			return drafts[i].PublishAt.Before(*drafts[j].PublishAt)
+		}
+		return drafts[i].ID < drafts[j].ID
+	})
+	return drafts, nil
+}
+
+// UpdateDraft replaces a draft's contents and schedule, clearing any
+// previous publish error.
+func (db *DB) UpdateDraft(ctx context.Context, id int, params DraftParams) (Draft, error) {
+	ctx, span := db.startSpan(ctx, "UpdateDraft")
+	defer span.End()
+
+	var draft Draft
+	err := db.update(ctx, func(dbStructure *DBStructure) error {
+		var ok bool
+		draft, ok = dbStructure.Drafts[id]
+		if !ok {
+			return ErrNotExist
+		}
+		err := checkMediaIDs(*dbStructure, draft.AuthorID, params.MediaIDs)
+		if err != nil {
+			return err
+		}
+
+		draft.Body = params.Body
+		draft.MediaIDs = params.MediaIDs
+		draft.InReplyTo = params.InReplyTo
+		draft.PublishAt = params.PublishAt
+		draft.PublishError = ""
+		draft.UpdatedAt = time.Now().UTC()
+		dbStructure.Drafts[id] = draft
+		return nil
+	})
+	if err != nil {
+		return Draft{}, err
+	}
+	return draft, nil
+}
+
+// FailDraft unschedules a draft that couldn't be published, recording
+// why.
+func (db *DB) FailDraft(ctx context.Context, id int, reason string) error {
+	ctx, span := db.startSpan(ctx, "FailDraft")
+	defer span.End()
+
+	return db.update(ctx, func(dbStructure *DBStructure) error {
+		draft, ok := dbStructure.Drafts[id]
+		if !ok {
+			return ErrNotExist
+		}
+		draft.PublishAt = nil
+		draft.PublishError = reason
+		dbStructure.Drafts[id] = draft
+		return nil
+	})
+}
+
+func (db *DB) DeleteDraft(ctx context.Context, id int) error {
+	ctx, span := db.startSpan(ctx, "DeleteDraft")
+	defer span.End()
+
+	return db.update(ctx, func(dbStructure *DBStructure) error {
+		if _, ok := dbStructure.Drafts[id]; !ok {
+			return ErrNotExist
+		}
+		delete(dbStructure.Drafts, id)
+		return nil
+	})
+}
+
+// PublishDraft turns draft into a chirp with the given entities, which
+// were parsed from its body. The chirp is created and the draft removed
+// in the same write, so a draft is never published twice even if chirpy
+// stops in between. If the stored draft was edited since draft was read
+// it is left alone and ErrDraftChanged is returned.
+func (db *DB) PublishDraft(ctx context.Context, draft Draft, mentions []Mention, hashtags []Hashtag) (Chirp, error) {
+	ctx, span := db.startSpan(ctx, "PublishDraft")
+	defer span.End()
+
+	var chirp Chirp
+	err := db.update(ctx, func(dbStructure *DBStructure) error {
+		stored, ok := dbStructure.Drafts[draft.ID]
+		if !ok {
+			return ErrNotExist
+		}
+		if !stored.UpdatedAt.Equal(draft.UpdatedAt) {
+			return ErrDraftChanged
+		}
+
+		var err error
+		chirp, err = insertChirp(dbStructure, CreateChirpParams{
+			Body:      stored.Body,
+			AuthorID:  stored.AuthorID,
+			MediaIDs:  stored.MediaIDs,
+			InReplyTo: stored.InReplyTo,
+			Mentions:  mentions,
+			Hashtags:  hashtags,
+		})
+		if errors.Is(err, ErrNotExist) {
+			return ErrReplyNotExist
+		}
+		if err != nil {
+			return err
+		}
+		delete(dbStructure.Drafts, draft.ID)
+		return nil
+	})
+	if err != nil {
+		return Chirp{}, err
+	}
+	db.publish(EventChirpCreated, chirp)
+
+	return chirp, nil
+}
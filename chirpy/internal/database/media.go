@@ -0,0 +1,118 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrInvalidMedia = errors.New("invalid media reference")
+
+type Media struct {
+	ID           int       `json:"id"`
+	OwnerID      int       `json:"owner_id"`
+	BlobKey      string    `json:"blob_key"`
+	ContentType  string    `json:"content_type"`
+	Size         int64     `json:"size"`
+	ThumbnailKey string    `json:"thumbnail_key,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func (db *DB) CreateMedia(ctx context.Context, m Media) (Media, error) {
+	ctx, span := db.startSpan(ctx, "CreateMedia")
+	defer span.End()
+
+	err := db.update(ctx, func(dbStructure *DBStructure) error {
+		id := len(dbStructure.Media) + 1
+		for {
+			if _, ok := dbStructure.Media[id]; !ok {
+				break
+			}
+			id++
+		}
+
+		m.ID = id
+		m.CreatedAt = time.Now().UTC()
+		dbStructure.Media[id] = m
+		return nil
+	})
+	if err != nil {
+		return Media{}, err
+	}
+
+	return m, nil
+}
+
+func (db *DB) GetMedia(ctx context.Context, id int) (Media, error) {
+	ctx, span := db.startSpan(ctx, "GetMedia")
+	defer span.End()
+
+	dbStructure, err := db.loadDB(ctx)
+	if err != nil {
+		return Media{}, err
+	}
+
+	m, ok := dbStructure.Media[id]
+	if !ok {
+		return Media{}, ErrNotExist
+	}
+
+	return m, nil
+}
+
+// GetMediaByID returns the media with the given IDs in one read. IDs
+// that don't exist are left out of the result.
+func (db *DB) GetMediaByID(ctx context.Context, ids []int) (map[int]Media, error) {
+	ctx, span := db.startSpan(ctx, "GetMediaByID")
+	defer span.End()
+
+	dbStructure, err := db.loadDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	media := make(map[int]Media, len(ids))
+	for _, id := range ids {
+		if m, ok := dbStructure.Media[id]; ok {
+			media[id] = m
+		}
+	}
+	return media, nil
+}
+
+// BlobInUse reports whether any media refers to the blob key, as its
+// original or its thumbnail. Blobs are content addressed, so the blob of
+// one upload may well be another's too.
+func (db *DB) BlobInUse(ctx context.Context, key string) (bool, error) {
+	ctx, span := db.startSpan(ctx, "BlobInUse")
+	defer span.End()
+
+	dbStructure, err := db.loadDB(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	for _, m := range dbStructure.Media {
+		if m.BlobKey == key || m.ThumbnailKey == key {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// checkMediaIDs makes sure every referenced media item exists and was
+// uploaded by the chirp's author.
+func checkMediaIDs(dbStructure DBStructure, authorID int, mediaIDs []int) error {
+	seen := map[int]struct{}{}
+	for _, id := range mediaIDs {
+		m, ok := dbStructure.Media[id]
+		if !ok || m.OwnerID != authorID {
+			return ErrInvalidMedia
+		}
+		if _, ok := seen[id]; ok {
+			return ErrInvalidMedia
+		}
+		seen[id] = struct{}{}
+	}
+	return nil
+}
@@ -0,0 +1,386 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+)
+
+var (
+	ErrAlreadyResolved = errors.New("already resolved")
+	ErrNotAppealable   = errors.New("action can't be appealed")
+)
+
+type Role string
+
+const (
+	RoleUser      Role = ""
+	RoleModerator Role = "moderator"
+)
+
+type ReportReason string
+
+const (
+	ReportSpam           ReportReason = "spam"
+	ReportHarassment     ReportReason = "harassment"
+	ReportHate           ReportReason = "hate"
+	ReportViolence       ReportReason = "violence"
+	ReportMisinformation ReportReason = "misinformation"
+	ReportOther          ReportReason = "other"
+)
+
+// ValidReportReasons lists the reasons a chirp can be reported for.
+var ValidReportReasons = map[ReportReason]struct{}{
+	ReportSpam:           {},
+	ReportHarassment:     {},
+	ReportHate:           {},
+	ReportViolence:       {},
+	ReportMisinformation: {},
+	ReportOther:          {},
+}
+
+type ReportStatus string
+
+const (
+	ReportOpen      ReportStatus = "open"
+	ReportActioned  ReportStatus = "actioned"
+	ReportDismissed ReportStatus = "dismissed"
+)
+
+type Report struct {
+	ID         int          `json:"id"`
+	ChirpID    int          `json:"chirp_id"`
+	AuthorID   int          `json:"author_id"`
+	ChirpBody  string       `json:"chirp_body"`
+	ReporterID int          `json:"reporter_id"`
+	Reason     ReportReason `json:"reason"`
+	Details    string       `json:"details,omitempty"`
+	Status     ReportStatus `json:"status"`
+	CreatedAt  time.Time    `json:"created_at"`
+	ActionID   int          `json:"action_id,omitempty"`
+}
+
+type ModerationActionType string
+
+const (
+	ActionHide    ModerationActionType = "hide"
+	ActionDelete  ModerationActionType = "delete"
+	ActionSuspend ModerationActionType = "suspend"
+	ActionDismiss ModerationActionType = "dismiss"
+)
+
+// ModerationAction records who did what to which chirp or user, when and
+// why.
+type ModerationAction struct {
+	ID             int                  `json:"id"`
+	Type           ModerationActionType `json:"type"`
+	ModeratorID    int                  `json:"moderator_id"`
+	ChirpID        int                  `json:"chirp_id"`
+	TargetUserID   int                  `json:"target_user_id"`
+	Reason         string               `json:"reason"`
+	SuspendedUntil *time.Time           `json:"suspended_until,omitempty"`
+	CreatedAt      time.Time            `json:"created_at"`
+	ReversedAt     *time.Time           `json:"reversed_at,omitempty"`
+}
+
+type AppealStatus string
+
+const (
+	AppealOpen       AppealStatus = "open"
+	AppealUpheld     AppealStatus = "upheld"
+	AppealOverturned AppealStatus = "overturned"
+)
+
+type Appeal struct {
+	ID          int          `json:"id"`
+	ActionID    int          `json:"action_id"`
+	UserID      int          `json:"user_id"`
+	Message     string       `json:"message"`
+	Status      AppealStatus `json:"status"`
+	CreatedAt   time.Time    `json:"created_at"`
+	ModeratorID int          `json:"moderator_id,omitempty"`
+	Resolution  string       `json:"resolution,omitempty"`
+	ResolvedAt  *time.Time   `json:"resolved_at,omitempty"`
+}
+
+// IsSuspended reports whether the user is currently suspended.
+func (u User) IsSuspended() bool {
+	return u.SuspendedUntil != nil && u.SuspendedUntil.After(time.Now())
+}
+
+func (db *DB) CreateReport(ctx context.Context, chirpID, reporterID int, reason ReportReason, details string) (Report, error) {
+	ctx, span := db.startSpan(ctx, "CreateReport")
+	defer span.End()
+
+	var report Report
+	err := db.update(ctx, func(dbStructure *DBStructure) error {
+		chirp, ok := dbStructure.Chirps[chirpID]
+		if !ok {
+			return ErrNotExist
+		}
+
+		id := len(dbStructure.Reports) + 1
+		for {
+			if _, ok := dbStructure.Reports[id]; !ok {
+				break
+			}
+			id++
+		}
+
+		report = Report{
+			ID:         id,
+			ChirpID:    chirpID,
+			AuthorID:   chirp.AuthorID,
+			ChirpBody:  chirp.Body,
+			ReporterID: reporterID,
+			Reason:     reason,
+			Details:    details,
+			Status:     ReportOpen,
+			CreatedAt:  time.Now().UTC(),
+		}
+		dbStructure.Reports[id] = report
+		return nil
+	})
+	if err != nil {
+		return Report{}, err
+	}
+	return report, nil
+}
+
+// GetReports returns reports with the given status, oldest first so the
+// moderation queue is worked in order. An empty status returns all.
+func (db *DB) GetReports(ctx context.Context, status ReportStatus) ([]Report, error) {
+	ctx, span := db.startSpan(ctx, "GetReports")
+	defer span.End()
+
+	dbStructure, err := db.loadDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reports := []Report{}
+	for _, report := range dbStructure.Reports {
+		if status != "" && report.Status != status {
+			continue
+		}
+		reports = append(reports, report)
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].ID < reports[j].ID
+	})
+	return reports, nil
+}
+
+// ResolveReport applies a moderation action for a report. Every other
+// open report against the same chirp is resolved with it. suspendFor is
+// only used by ActionSuspend, which also revokes the author's refresh
+// tokens so they have to log in again, which they can't until the
+// suspension ends.
+func (db *DB) ResolveReport(ctx context.Context, reportID, moderatorID int, actionType ModerationActionType, reason string, suspendFor time.Duration) (ModerationAction, error) {
+	ctx, span := db.startSpan(ctx, "ResolveReport")
+	defer span.End()
+
+	var action ModerationAction
+	var deleted, hidden []Chirp
+	err := db.update(ctx, func(dbStructure *DBStructure) error {
+		report, ok := dbStructure.Reports[reportID]
+		if !ok {
+			return ErrNotExist
+		}
+		if report.Status != ReportOpen {
+			return ErrAlreadyResolved
+		}
+
+		now := time.Now().UTC()
+		action = ModerationAction{
+			ID:           len(dbStructure.ModerationActions) + 1,
+			Type:         actionType,
+			ModeratorID:  moderatorID,
+			ChirpID:      report.ChirpID,
+			TargetUserID: report.AuthorID,
+			Reason:       reason,
+			CreatedAt:    now,
+		}
+		for {
+			if _, ok := dbStructure.ModerationActions[action.ID]; !ok {
+				break
+			}
+			action.ID++
+		}
+
+		switch actionType {
+		case ActionHide:
+			chirp, ok := dbStructure.Chirps[report.ChirpID]
+			if ok && !chirp.Hidden {
+				hidden = append(hidden, chirp)
+				chirp.Hidden = true
+				dbStructure.Chirps[chirp.ID] = chirp
+			}
+		case ActionDelete:
+			if chirp, ok := dbStructure.Chirps[report.ChirpID]; ok {
+				deleted = append(deleted, chirp)
+			}
+			delete(dbStructure.Chirps, report.ChirpID)
+			delete(dbStructure.ChirpRevisions, report.ChirpID)
+		case ActionSuspend:
+			user, ok := dbStructure.Users[report.AuthorID]
+			if !ok {
+				return ErrNotExist
+			}
+			until := now.Add(suspendFor)
+			user.SuspendedUntil = &until
+			dbStructure.Users[user.ID] = user
+			action.SuspendedUntil = &until
+			for token, refreshToken := range dbStructure.RefreshTokens {
+				if refreshToken.UserID == user.ID {
+					delete(dbStructure.RefreshTokens, token)
+				}
+			}
+		}
+		dbStructure.ModerationActions[action.ID] = action
+
+		status := ReportActioned
+		if actionType == ActionDismiss {
+			status = ReportDismissed
+		}
+		for id, r := range dbStructure.Reports {
+			if r.ChirpID != report.ChirpID || r.Status != ReportOpen {
+				continue
+			}
+			r.Status = status
+			r.ActionID = action.ID
+			dbStructure.Reports[id] = r
+		}
+		return nil
+	})
+	if err != nil {
+		return ModerationAction{}, err
+	}
+	db.publish(EventChirpDeleted, deleted...)
+	db.publish(EventChirpHidden, hidden...)
+	return action, nil
+}
+
+// CreateAppeal lets the user targeted by a moderation action contest it.
+// Only hides and suspensions can be appealed, since they can be undone.
+func (db *DB) CreateAppeal(ctx context.Context, actionID, userID int, message string) (Appeal, error) {
+	ctx, span := db.startSpan(ctx, "CreateAppeal")
+	defer span.End()
+
+	var appeal Appeal
+	err := db.update(ctx, func(dbStructure *DBStructure) error {
+		action, ok := dbStructure.ModerationActions[actionID]
+		if !ok || action.TargetUserID != userID {
+			return ErrNotExist
+		}
+		if action.Type != ActionHide && action.Type != ActionSuspend {
+			return ErrNotAppealable
+		}
+		for _, appeal := range dbStructure.Appeals {
+			if appeal.ActionID == actionID {
+				return ErrAlreadyExists
+			}
+		}
+
+		id := len(dbStructure.Appeals) + 1
+		for {
+			if _, ok := dbStructure.Appeals[id]; !ok {
+				break
+			}
+			id++
+		}
+
+		appeal = Appeal{
+			ID:        id,
+			ActionID:  actionID,
+			UserID:    userID,
+			Message:   message,
+			Status:    AppealOpen,
+			CreatedAt: time.Now().UTC(),
+		}
+		dbStructure.Appeals[id] = appeal
+		return nil
+	})
+	if err != nil {
+		return Appeal{}, err
+	}
+	return appeal, nil
+}
+
+// GetAppeals returns appeals with the given status, oldest first. An
+// empty status returns all.
+func (db *DB) GetAppeals(ctx context.Context, status AppealStatus) ([]Appeal, error) {
+	ctx, span := db.startSpan(ctx, "GetAppeals")
+	defer span.End()
+
+	dbStructure, err := db.loadDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	appeals := []Appeal{}
+	for _, appeal := range dbStructure.Appeals {
+		if status != "" && appeal.Status != status {
+			continue
+		}
+		appeals = append(appeals, appeal)
+	}
+	sort.Slice(appeals, func(i, j int) bool {
+		return appeals[i].ID < appeals[j].ID
+	})
+	return appeals, nil
+}
+
+// ResolveAppeal records a moderator's decision on an appeal. Overturning
+// an appeal reverses the original action.
+func (db *DB) ResolveAppeal(ctx context.Context, appealID, moderatorID int, overturn bool, resolution string) (Appeal, error) {
+	ctx, span := db.startSpan(ctx, "ResolveAppeal")
+	defer span.End()
+
+	var appeal Appeal
+	var unhidden []Chirp
+	err := db.update(ctx, func(dbStructure *DBStructure) error {
+		var ok bool
+		appeal, ok = dbStructure.Appeals[appealID]
+		if !ok {
+			return ErrNotExist
+		}
+		if appeal.Status != AppealOpen {
+			return ErrAlreadyResolved
+		}
+
+		now := time.Now().UTC()
+		appeal.Status = AppealUpheld
+		if overturn {
+			appeal.Status = AppealOverturned
+
+			action := dbStructure.ModerationActions[appeal.ActionID]
+			switch action.Type {
+			case ActionHide:
+				if chirp, ok := dbStructure.Chirps[action.ChirpID]; ok && chirp.Hidden {
+					chirp.Hidden = false
+					dbStructure.Chirps[chirp.ID] = chirp
+					unhidden = append(unhidden, chirp)
+				}
+			case ActionSuspend:
+				if user, ok := dbStructure.Users[action.TargetUserID]; ok {
+					user.SuspendedUntil = nil
+					dbStructure.Users[user.ID] = user
+				}
+			}
+			action.ReversedAt = &now
+			dbStructure.ModerationActions[action.ID] = action
+		}
+		appeal.ModeratorID = moderatorID
+		appeal.Resolution = resolution
+		appeal.ResolvedAt = &now
+		dbStructure.Appeals[appealID] = appeal
+		return nil
+	})
+	if err != nil {
+		return Appeal{}, err
+	}
+	db.publish(EventChirpUpdated, unhidden...)
+	return appeal, nil
+}
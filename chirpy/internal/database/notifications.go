@@ -0,0 +1,118 @@
+package database
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+type NotificationType string
+
+const (
+	NotificationMentioned NotificationType = "mentioned"
+	NotificationReplied   NotificationType = "replied"
+	NotificationFollowed  NotificationType = "followed"
+)
+
+type Notification struct {
+	ID        int              `json:"id"`
+	UserID    int              `json:"user_id"`
+	Type      NotificationType `json:"type"`
+	ActorID   int              `json:"actor_id"`
+	ChirpID   int              `json:"chirp_id,omitempty"`
+	CreatedAt time.Time        `json:"created_at"`
+	ReadAt    *time.Time       `json:"read_at,omitempty"`
+}
+
+func (db *DB) CreateNotification(ctx context.Context, userID int, notificationType NotificationType, actorID, chirpID int) (Notification, error) {
+	ctx, span := db.startSpan(ctx, "CreateNotification")
+	defer span.End()
+
+	var notification Notification
+	err := db.update(ctx, func(dbStructure *DBStructure) error {
+		id := len(dbStructure.Notifications) + 1
+		for {
+			if _, ok := dbStructure.Notifications[id]; !ok {
+				break
+			}
+			id++
+		}
+
+		notification = Notification{
+			ID:        id,
+			UserID:    userID,
+			Type:      notificationType,
+			ActorID:   actorID,
+			ChirpID:   chirpID,
+			CreatedAt: time.Now().UTC(),
+		}
+		dbStructure.Notifications[id] = notification
+		return nil
+	})
+	if err != nil {
+		return Notification{}, err
+	}
+
+	return notification, nil
+}
+
+// GetNotifications returns a user's notifications, newest first.
+func (db *DB) GetNotifications(ctx context.Context, userID int, unreadOnly bool) ([]Notification, error) {
+	ctx, span := db.startSpan(ctx, "GetNotifications")
+	defer span.End()
+
+	dbStructure, err := db.loadDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	notifications := []Notification{}
+	for _, n := range dbStructure.Notifications {
+		if n.UserID != userID {
+			continue
+		}
+		if unreadOnly && n.ReadAt != nil {
+			continue
+		}
+		notifications = append(notifications, n)
+	}
+	sort.Slice(notifications, func(i, j int) bool {
+		return notifications[i].ID > notifications[j].ID
+	})
+
+	return notifications, nil
+}
+
+// MarkNotificationsRead marks the given notifications as read. If ids is
+// empty every notification belonging to the user is marked. IDs that
+// don't belong to the user are reported as ErrNotExist.
+func (db *DB) MarkNotificationsRead(ctx context.Context, userID int, ids ...int) error {
+	ctx, span := db.startSpan(ctx, "MarkNotificationsRead")
+	defer span.End()
+
+	return db.update(ctx, func(dbStructure *DBStructure) error {
+		now := time.Now().UTC()
+		markRead := func(n Notification) {
+			if n.ReadAt == nil {
+				n.ReadAt = &now
+				dbStructure.Notifications[n.ID] = n
+			}
+		}
+
+		if len(ids) == 0 {
+			for _, n := range dbStructure.Notifications {
+				if n.UserID == userID {
+					markRead(n)
+				}
+			}
+		}
+		for _, id := range ids {
+			n, ok := dbStructure.Notifications[id]
+			if !ok || n.UserID != userID {
+				return ErrNotExist
+			}
+			markRead(n)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,143 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+var ErrHandleTaken = errors.New("handle is taken")
+
+// HandleChange records a handle a user gave up and when.
+type HandleChange struct {
+	Handle    string    `json:"handle"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// ProfileUpdate holds the profile fields to change. Nil fields are left
+// untouched.
+type ProfileUpdate struct {
+	Handle        *string
+	DisplayName   *string
+	Bio           *string
+	AvatarMediaID *int
+}
+
+// GetUserByHandle looks up a user by their current handle, ignoring case.
+func (db *DB) GetUserByHandle(ctx context.Context, handle string) (User, error) {
+	ctx, span := db.startSpan(ctx, "GetUserByHandle")
+	defer span.End()
+
+	dbStructure, err := db.loadDB(ctx)
+	if err != nil {
+		return User{}, err
+	}
+
+	user, ok := userByHandle(dbStructure, handle)
+	if !ok {
+		return User{}, ErrNotExist
+	}
+	return user, nil
+}
+
+// GetUserByPreviousHandle finds the user who gave up handle within the
+// last cooldown, so links to a renamed profile keep working for a while.
+func (db *DB) GetUserByPreviousHandle(ctx context.Context, handle string, cooldown time.Duration) (User, error) {
+	ctx, span := db.startSpan(ctx, "GetUserByPreviousHandle")
+	defer span.End()
+
+	dbStructure, err := db.loadDB(ctx)
+	if err != nil {
+		return User{}, err
+	}
+
+	user, ok := userByPreviousHandle(dbStructure, handle, time.Now().Add(-cooldown))
+	if !ok {
+		return User{}, ErrNotExist
+	}
+	return user, nil
+}
+
+// UpdateProfile applies a profile update. A new handle must not be in use
+// by anyone else, nor have been given up by another user within the last
+// cooldown. The old handle is appended to the user's handle history.
+func (db *DB) UpdateProfile(ctx context.Context, id int, update ProfileUpdate, cooldown time.Duration) (User, error) {
+	ctx, span := db.startSpan(ctx, "UpdateProfile")
+	defer span.End()
+
+	var user User
+	err := db.update(ctx, func(dbStructure *DBStructure) error {
+		var ok bool
+		user, ok = dbStructure.Users[id]
+		if !ok {
+			return ErrNotExist
+		}
+
+		if update.Handle != nil && *update.Handle != user.Handle {
+			err := checkHandleAvailable(*dbStructure, id, *update.Handle, cooldown)
+			if err != nil {
+				return err
+			}
+			if user.Handle != "" && !strings.EqualFold(user.Handle, *update.Handle) {
+				user.HandleHistory = append(user.HandleHistory, HandleChange{
+					Handle:    user.Handle,
+					ChangedAt: time.Now().UTC(),
+				})
+			}
+			user.Handle = *update.Handle
+		}
+		if update.DisplayName != nil {
+			user.DisplayName = *update.DisplayName
+		}
+		if update.Bio != nil {
+			user.Bio = *update.Bio
+		}
+		if update.AvatarMediaID != nil {
+			if *update.AvatarMediaID != 0 {
+				err := checkMediaIDs(*dbStructure, id, []int{*update.AvatarMediaID})
+				if err != nil {
+					return err
+				}
+			}
+			user.AvatarMediaID = *update.AvatarMediaID
+		}
+		dbStructure.Users[id] = user
+		return nil
+	})
+	if err != nil {
+		return User{}, err
+	}
+
+	return user, nil
+}
+
+func checkHandleAvailable(dbStructure DBStructure, userID int, handle string, cooldown time.Duration) error {
+	if user, ok := userByHandle(dbStructure, handle); ok && user.ID != userID {
+		return ErrHandleTaken
+	}
+	if user, ok := userByPreviousHandle(dbStructure, handle, time.Now().Add(-cooldown)); ok && user.ID != userID {
+		return ErrHandleTaken
+	}
+	return nil
+}
+
+func userByHandle(dbStructure DBStructure, handle string) (User, bool) {
+	for _, user := range dbStructure.Users {
+		if user.Handle != "" && strings.EqualFold(user.Handle, handle) {
+			return user, true
+		}
+	}
+	return User{}, false
+}
+
+func userByPreviousHandle(dbStructure DBStructure, handle string, since time.Time) (User, bool) {
+	for _, user := range dbStructure.Users {
+		for _, change := range user.HandleHistory {
+			if strings.EqualFold(change.Handle, handle) && change.ChangedAt.After(since) {
+				return user, true
+			}
+		}
+	}
+	return User{}, false
+}
@@ -1,6 +1,9 @@
 package database
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 type RefreshToken struct {
 	UserID    int       `json:"user_id"`
@@ -8,41 +11,43 @@ type RefreshToken struct {
 	ExpiresAt time.Time `json:"expires_at"`
 }
 
-func (db *DB) SaveRefreshToken(userID int, token string) error {
-	dbStructure, err := db.loadDB()
-	if err != nil {
-		return err
-	}
-
-	refreshToken := RefreshToken{
-		UserID:    userID,
-		Token:     token,
-		ExpiresAt: time.Now().Add(time.Hour),
-	}
-	dbStructure.RefreshTokens[token] = refreshToken
+func (db *DB) SaveRefreshToken(ctx context.Context, userID int, token string, ttl time.Duration) error {
+	ctx, span := db.startSpan(ctx, "SaveRefreshToken")
+	defer span.End()
 
-	err = db.writeDB(dbStructure)
-	if err != nil {
-		return err
-	}
-	return nil
+	return db.update(ctx, func(dbStructure *DBStructure) error {
+		dbStructure.RefreshTokens[token] = RefreshToken{
+			UserID:    userID,
+			Token:     token,
+			ExpiresAt: time.Now().Add(ttl),
+		}
+		return nil
+	})
 }
 
-func (db *DB) RevokeRefreshToken(token string) error {
-	dbStructure, err := db.loadDB()
-	if err != nil {
-		return err
-	}
-	delete(dbStructure.RefreshTokens, token)
-	err = db.writeDB(dbStructure)
+// RevokeRefreshToken deletes a refresh token and returns the ID of the
+// user it belonged to, or 0 if there was no such token.
+func (db *DB) RevokeRefreshToken(ctx context.Context, token string) (int, error) {
+	ctx, span := db.startSpan(ctx, "RevokeRefreshToken")
+	defer span.End()
+
+	var refreshToken RefreshToken
+	err := db.update(ctx, func(dbStructure *DBStructure) error {
+		refreshToken = dbStructure.RefreshTokens[token]
+		delete(dbStructure.RefreshTokens, token)
+		return nil
+	})
 	if err != nil {
-		return err
+		return 0, err
 	}
-	return nil
+	return refreshToken.UserID, nil
 }
 
-func (db *DB) UserForRefreshToken(token string) (User, error) {
-	dbStructure, err := db.loadDB()
+func (db *DB) UserForRefreshToken(ctx context.Context, token string) (User, error) {
+	ctx, span := db.startSpan(ctx, "UserForRefreshToken")
+	defer span.End()
+
+	dbStructure, err := db.loadDB(ctx)
 	if err != nil {
 		return User{}, err
 	}
@@ -56,10 +61,56 @@ func (db *DB) UserForRefreshToken(token string) (User, error) {
 		return User{}, ErrNotExist
 	}
 
-	user, err := db.GetUser(refreshToken.UserID)
+	user, err := db.GetUser(ctx, refreshToken.UserID)
 	if err != nil {
 		return User{}, err
 	}
 
 	return user, nil
 }
+
+// CountActiveSessions returns how many unexpired refresh tokens exist.
+func (db *DB) CountActiveSessions(ctx context.Context) (int, error) {
+	ctx, span := db.startSpan(ctx, "CountActiveSessions")
+	defer span.End()
+
+	dbStructure, err := db.loadDB(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	count := 0
+	for _, token := range dbStructure.RefreshTokens {
+		if token.ExpiresAt.After(now) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// PurgeExpiredRefreshTokens deletes the refresh tokens that expired
+// before now and returns how many there were. UserForRefreshToken ignores
+// them anyway; this just keeps them from piling up.
+func (db *DB) PurgeExpiredRefreshTokens(ctx context.Context, now time.Time) (int, error) {
+	ctx, span := db.startSpan(ctx, "PurgeExpiredRefreshTokens")
+	defer span.End()
+
+	purged := 0
+	err := db.update(ctx, func(dbStructure *DBStructure) error {
+		for token, refreshToken := range dbStructure.RefreshTokens {
+			if refreshToken.ExpiresAt.Before(now) {
+				delete(dbStructure.RefreshTokens, token)
+				purged++
+			}
+		}
+		if purged == 0 {
+			return errUnchanged
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return purged, nil
+}
@@ -0,0 +1,294 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+)
+
+var ErrSelfRelationship = errors.New("users can't block, mute or follow themselves")
+
+// ErrBlocked is returned when following a user who has blocked, or been
+// blocked by, the follower.
+var ErrBlocked = errors.New("users have blocked each other")
+
+// Relation is one entry in a user's block, mute or follow list.
+type Relation struct {
+	UserID    int       `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Visibility describes which authors a viewer shouldn't see. Blocks hide
+// users from each other in both directions everywhere, mutes only hide
+// the muted user from the muter's feeds.
+type Visibility struct {
+	viewerID int
+	blocked  map[int]struct{}
+	muted    map[int]struct{}
+}
+
+// CanSee reports whether content by authorID may be shown to the viewer
+// at all, e.g. when fetched directly by ID.
+func (v Visibility) CanSee(authorID int) bool {
+	_, ok := v.blocked[authorID]
+	return !ok
+}
+
+// CanSeeChirp is CanSee for a chirp's author, additionally hiding chirps
+// taken down by a moderator from everyone but their author.
+func (v Visibility) CanSeeChirp(c Chirp) bool {
+	if c.Hidden && c.AuthorID != v.viewerID {
+		return false
+	}
+	return v.CanSee(c.AuthorID)
+}
+
+// ShowChirpInFeed is ShowInFeed for a chirp's author, with the same
+// moderation rules as CanSeeChirp.
+func (v Visibility) ShowChirpInFeed(c Chirp) bool {
+	return v.CanSeeChirp(c) && v.ShowInFeed(c.AuthorID)
+}
+
+// ShowInFeed reports whether content by authorID belongs in the viewer's
+// lists and feeds.
+func (v Visibility) ShowInFeed(authorID int) bool {
+	if !v.CanSee(authorID) {
+		return false
+	}
+	_, ok := v.muted[authorID]
+	return !ok
+}
+
+// BlockUser makes blockerID block blockedID, ending any follows between
+// them in either direction.
+func (db *DB) BlockUser(ctx context.Context, blockerID, blockedID int) error {
+	ctx, span := db.startSpan(ctx, "BlockUser")
+	defer span.End()
+
+	_, err := db.addRelation(ctx, blockerID, blockedID, func(s *DBStructure) map[int]map[int]time.Time {
+		return s.Blocks
+	}, func(s *DBStructure) error {
+		delete(s.Follows[blockerID], blockedID)
+		delete(s.Follows[blockedID], blockerID)
+		return nil
+	})
+	return err
+}
+
+func (db *DB) UnblockUser(ctx context.Context, blockerID, blockedID int) error {
+	ctx, span := db.startSpan(ctx, "UnblockUser")
+	defer span.End()
+
+	return db.removeRelation(ctx, blockerID, blockedID, func(s *DBStructure) map[int]map[int]time.Time {
+		return s.Blocks
+	})
+}
+
+func (db *DB) GetBlockedUsers(ctx context.Context, userID int) ([]Relation, error) {
+	ctx, span := db.startSpan(ctx, "GetBlockedUsers")
+	defer span.End()
+
+	return db.listRelations(ctx, userID, func(s *DBStructure) map[int]map[int]time.Time {
+		return s.Blocks
+	})
+}
+
+func (db *DB) MuteUser(ctx context.Context, muterID, mutedID int) error {
+	ctx, span := db.startSpan(ctx, "MuteUser")
+	defer span.End()
+
+	_, err := db.addRelation(ctx, muterID, mutedID, func(s *DBStructure) map[int]map[int]time.Time {
+		return s.Mutes
+	}, nil)
+	return err
+}
+
+func (db *DB) UnmuteUser(ctx context.Context, muterID, mutedID int) error {
+	ctx, span := db.startSpan(ctx, "UnmuteUser")
+	defer span.End()
+
+	return db.removeRelation(ctx, muterID, mutedID, func(s *DBStructure) map[int]map[int]time.Time {
+		return s.Mutes
+	})
+}
+
+func (db *DB) GetMutedUsers(ctx context.Context, userID int) ([]Relation, error) {
+	ctx, span := db.startSpan(ctx, "GetMutedUsers")
+	defer span.End()
+
+	return db.listRelations(ctx, userID, func(s *DBStructure) map[int]map[int]time.Time {
+		return s.Mutes
+	})
+}
+
+// FollowUser makes followerID follow followedID and reports whether they
+// weren't already. It returns ErrBlocked if either has blocked the other.
+func (db *DB) FollowUser(ctx context.Context, followerID, followedID int) (bool, error) {
+	ctx, span := db.startSpan(ctx, "FollowUser")
+	defer span.End()
+
+	return db.addRelation(ctx, followerID, followedID, func(s *DBStructure) map[int]map[int]time.Time {
+		return s.Follows
+	}, func(s *DBStructure) error {
+		_, blocked := s.Blocks[followerID][followedID]
+		_, blockedBy := s.Blocks[followedID][followerID]
+		if blocked || blockedBy {
+			return ErrBlocked
+		}
+		return nil
+	})
+}
+
+func (db *DB) UnfollowUser(ctx context.Context, followerID, followedID int) error {
+	ctx, span := db.startSpan(ctx, "UnfollowUser")
+	defer span.End()
+
+	return db.removeRelation(ctx, followerID, followedID, func(s *DBStructure) map[int]map[int]time.Time {
+		return s.Follows
+	})
+}
+
+// GetFollowedUsers returns the users userID follows.
+func (db *DB) GetFollowedUsers(ctx context.Context, userID int) ([]Relation, error) {
+	ctx, span := db.startSpan(ctx, "GetFollowedUsers")
+	defer span.End()
+
+	return db.listRelations(ctx, userID, func(s *DBStructure) map[int]map[int]time.Time {
+		return s.Follows
+	})
+}
+
+// GetFollowers returns the users following userID, most recent first.
+func (db *DB) GetFollowers(ctx context.Context, userID int) ([]Relation, error) {
+	ctx, span := db.startSpan(ctx, "GetFollowers")
+	defer span.End()
+
+	dbStructure, err := db.loadDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	list := []Relation{}
+	for followerID, followed := range dbStructure.Follows {
+		if createdAt, ok := followed[userID]; ok {
+			list = append(list, Relation{UserID: followerID, CreatedAt: createdAt})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.After(list[j].CreatedAt)
+	})
+
+	return list, nil
+}
+
+// IsBlocked reports whether either user has blocked the other.
+func (db *DB) IsBlocked(ctx context.Context, a, b int) (bool, error) {
+	ctx, span := db.startSpan(ctx, "IsBlocked")
+	defer span.End()
+
+	v, err := db.GetVisibility(ctx, a)
+	if err != nil {
+		return false, err
+	}
+	return !v.CanSee(b), nil
+}
+
+// GetVisibility builds the Visibility for viewerID. A viewerID of 0 is an
+// anonymous viewer who can see everything.
+func (db *DB) GetVisibility(ctx context.Context, viewerID int) (Visibility, error) {
+	ctx, span := db.startSpan(ctx, "GetVisibility")
+	defer span.End()
+
+	v := Visibility{
+		viewerID: viewerID,
+		blocked:  map[int]struct{}{},
+		muted:    map[int]struct{}{},
+	}
+	if viewerID == 0 {
+		return v, nil
+	}
+
+	dbStructure, err := db.loadDB(ctx)
+	if err != nil {
+		return Visibility{}, err
+	}
+
+	for id := range dbStructure.Blocks[viewerID] {
+		v.blocked[id] = struct{}{}
+	}
+	for blockerID, blocked := range dbStructure.Blocks {
+		if _, ok := blocked[viewerID]; ok {
+			v.blocked[blockerID] = struct{}{}
+		}
+	}
+	for id := range dbStructure.Mutes[viewerID] {
+		v.muted[id] = struct{}{}
+	}
+
+	return v, nil
+}
+
+// addRelation adds toID to fromID's relations and reports whether it
+// wasn't there already. If before isn't nil it runs first, under the same
+// lock, and can veto the relation by returning an error.
+func (db *DB) addRelation(ctx context.Context, fromID, toID int, relations func(*DBStructure) map[int]map[int]time.Time, before func(*DBStructure) error) (bool, error) {
+	if fromID == toID {
+		return false, ErrSelfRelationship
+	}
+
+	added := false
+	err := db.update(ctx, func(dbStructure *DBStructure) error {
+		if _, ok := dbStructure.Users[toID]; !ok {
+			return ErrNotExist
+		}
+		if before != nil {
+			if err := before(dbStructure); err != nil {
+				return err
+			}
+		}
+
+		rels := relations(dbStructure)
+		if _, ok := rels[fromID][toID]; ok {
+			return errUnchanged
+		}
+		if rels[fromID] == nil {
+			rels[fromID] = map[int]time.Time{}
+		}
+		rels[fromID][toID] = time.Now().UTC()
+		added = true
+		return nil
+	})
+	return added, err
+}
+
+func (db *DB) removeRelation(ctx context.Context, fromID, toID int, relations func(*DBStructure) map[int]map[int]time.Time) error {
+	return db.update(ctx, func(dbStructure *DBStructure) error {
+		rels := relations(dbStructure)
+		if _, ok := rels[fromID][toID]; !ok {
+			return ErrNotExist
+		}
+		delete(rels[fromID], toID)
+		if len(rels[fromID]) == 0 {
+			delete(rels, fromID)
+		}
+		return nil
+	})
+}
+
+func (db *DB) listRelations(ctx context.Context, userID int, relations func(*DBStructure) map[int]map[int]time.Time) ([]Relation, error) {
+	dbStructure, err := db.loadDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	list := []Relation{}
+	for id, createdAt := range relations(&dbStructure)[userID] {
+		list = append(list, Relation{UserID: id, CreatedAt: createdAt})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.After(list[j].CreatedAt)
+	})
+
+	return list, nil
+}
@@ -1,36 +1,54 @@
 package database
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"time"
+)
 
 type User struct {
-	ID             int    `json:"id"`
-	Email          string `json:"email"`
-	HashedPassword string `json:"hashed_password"`
-	IsChirpyRed    bool   `json:"is_chirpy_red"`
+	ID             int            `json:"id"`
+	Email          string         `json:"email"`
+	HashedPassword string         `json:"hashed_password"`
+	IsChirpyRed    bool           `json:"is_chirpy_red"`
+	Handle         string         `json:"handle,omitempty"`
+	DisplayName    string         `json:"display_name,omitempty"`
+	Bio            string         `json:"bio,omitempty"`
+	AvatarMediaID  int            `json:"avatar_media_id,omitempty"`
+	HandleHistory  []HandleChange `json:"handle_history,omitempty"`
+	Role           Role           `json:"role,omitempty"`
+	SuspendedUntil *time.Time     `json:"suspended_until,omitempty"`
 }
 
 var ErrAlreadyExists = errors.New("already exists")
 
-func (db *DB) CreateUser(email, hashedPassword string) (User, error) {
-	if _, err := db.GetUserByEmail(email); !errors.Is(err, ErrNotExist) {
-		return User{}, ErrAlreadyExists
-	}
-
-	dbStructure, err := db.loadDB()
-	if err != nil {
-		return User{}, err
-	}
+func (db *DB) CreateUser(ctx context.Context, email, hashedPassword string) (User, error) {
+	ctx, span := db.startSpan(ctx, "CreateUser")
+	defer span.End()
 
-	id := len(dbStructure.Users) + 1
-	user := User{
-		ID:             id,
-		Email:          email,
-		HashedPassword: hashedPassword,
-		IsChirpyRed:    false,
-	}
-	dbStructure.Users[id] = user
+	var user User
+	err := db.update(ctx, func(dbStructure *DBStructure) error {
+		for _, u := range dbStructure.Users {
+			if u.Email == email {
+				return ErrAlreadyExists
+			}
+		}
 
-	err = db.writeDB(dbStructure)
+		// files written before LastUserID existed only have the map
+		for id := range dbStructure.Users {
+			dbStructure.LastUserID = max(dbStructure.LastUserID, id)
+		}
+		dbStructure.LastUserID++
+		id := dbStructure.LastUserID
+		user = User{
+			ID:             id,
+			Email:          email,
+			HashedPassword: hashedPassword,
+			IsChirpyRed:    false,
+		}
+		dbStructure.Users[id] = user
+		return nil
+	})
 	if err != nil {
 		return User{}, err
 	}
@@ -38,8 +56,11 @@ func (db *DB) CreateUser(email, hashedPassword string) (User, error) {
 	return user, nil
 }
 
-func (db *DB) GetUser(id int) (User, error) {
-	dbStructure, err := db.loadDB()
+func (db *DB) GetUser(ctx context.Context, id int) (User, error) {
+	ctx, span := db.startSpan(ctx, "GetUser")
+	defer span.End()
+
+	dbStructure, err := db.loadDB(ctx)
 	if err != nil {
 		return User{}, err
 	}
@@ -52,8 +73,31 @@ func (db *DB) GetUser(id int) (User, error) {
 	return user, nil
 }
 
-func (db *DB) GetUserByEmail(email string) (User, error) {
-	dbStructure, err := db.loadDB()
+// GetUsers returns the users with the given IDs in one read. IDs that
+// don't exist are left out of the result.
+func (db *DB) GetUsers(ctx context.Context, ids []int) (map[int]User, error) {
+	ctx, span := db.startSpan(ctx, "GetUsers")
+	defer span.End()
+
+	dbStructure, err := db.loadDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	users := make(map[int]User, len(ids))
+	for _, id := range ids {
+		if user, ok := dbStructure.Users[id]; ok {
+			users[id] = user
+		}
+	}
+	return users, nil
+}
+
+func (db *DB) GetUserByEmail(ctx context.Context, email string) (User, error) {
+	ctx, span := db.startSpan(ctx, "GetUserByEmail")
+	defer span.End()
+
+	dbStructure, err := db.loadDB(ctx)
 	if err != nil {
 		return User{}, err
 	}
@@ -67,14 +111,17 @@ func (db *DB) GetUserByEmail(email string) (User, error) {
 	return User{}, ErrNotExist
 }
 
-func (db *DB) UpdateUser(id int, email, hashedPassword string) (User, error) {
+func (db *DB) UpdateUser(ctx context.Context, id int, email, hashedPassword string) (User, error) {
+	ctx, span := db.startSpan(ctx, "UpdateUser")
+	defer span.End()
+
 	user := User{
 		ID:             id,
 		Email:          email,
 		HashedPassword: hashedPassword,
 	}
 
-	user, err := db.updateUser(user)
+	user, err := db.updateUser(ctx, user)
 	if err != nil {
 		return User{}, err
 	}
@@ -82,29 +129,27 @@ func (db *DB) UpdateUser(id int, email, hashedPassword string) (User, error) {
 	return user, nil
 }
 
-func (db *DB) updateUser(u User) (User, error) {
-	dbStructure, err := db.loadDB()
-	if err != nil {
-		return User{}, err
-	}
-
-	user, ok := dbStructure.Users[u.ID]
-	if !ok {
-		return User{}, ErrNotExist
-	}
-
-	if u.Email != "" {
-		user.Email = u.Email
-	}
-	if u.HashedPassword != "" {
-		user.HashedPassword = u.HashedPassword
-	}
-	if u.IsChirpyRed {
-		user.IsChirpyRed = true
-	}
-	dbStructure.Users[u.ID] = user
+func (db *DB) updateUser(ctx context.Context, u User) (User, error) {
+	var user User
+	err := db.update(ctx, func(dbStructure *DBStructure) error {
+		var ok bool
+		user, ok = dbStructure.Users[u.ID]
+		if !ok {
+			return ErrNotExist
+		}
 
-	err = db.writeDB(dbStructure)
+		if u.Email != "" {
+			user.Email = u.Email
+		}
+		if u.HashedPassword != "" {
+			user.HashedPassword = u.HashedPassword
+		}
+		if u.IsChirpyRed {
+			user.IsChirpyRed = true
+		}
+		dbStructure.Users[u.ID] = user
+		return nil
+	})
 	if err != nil {
 		return User{}, err
 	}
@@ -112,14 +157,17 @@ func (db *DB) updateUser(u User) (User, error) {
 	return user, nil
 }
 
-func (db *DB) UpgradeUser(id int) (User, error) {
-	u, err := db.GetUser(id)
+func (db *DB) UpgradeUser(ctx context.Context, id int) (User, error) {
+	ctx, span := db.startSpan(ctx, "UpgradeUser")
+	defer span.End()
+
+	u, err := db.GetUser(ctx, id)
 	if err != nil {
 		return User{}, err
 	}
 
 	u.IsChirpyRed = true
-	user, err := db.updateUser(u)
+	user, err := db.updateUser(ctx, u)
 	if err != nil {
 		return User{}, err
 	}
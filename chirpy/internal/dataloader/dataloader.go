@@ -0,0 +1,95 @@
+// Package dataloader batches and caches lookups by key, so resolving a
+// field on every item of a list costs one read rather than one per item.
+package dataloader
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned by Load for keys the BatchFunc didn't return.
+var ErrNotFound = errors.New("not found")
+
+// BatchFunc fetches the values for keys in one go. Keys missing from the
+// result are reported as ErrNotFound; an error fails every key in the
+// batch.
+type BatchFunc[K comparable, V any] func(ctx context.Context, keys []K) (map[K]V, error)
+
+type result[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+// Loader collects the keys asked for within a short wait into one batch.
+// Results are cached for the life of the Loader, so it is meant to be
+// made per request: later writes aren't seen.
+type Loader[K comparable, V any] struct {
+	fetch   BatchFunc[K, V]
+	wait    time.Duration
+	mu      sync.Mutex
+	cache   map[K]*result[V]
+	pending []K
+}
+
+// New returns a loader that fetches each batch wait after its first key
+// is asked for.
+func New[K comparable, V any](fetch BatchFunc[K, V], wait time.Duration) *Loader[K, V] {
+	return &Loader[K, V]{
+		fetch: fetch,
+		wait:  wait,
+		cache: map[K]*result[V]{},
+	}
+}
+
+// Load returns the value for key, waiting for the batch it joins.
+func (l *Loader[K, V]) Load(ctx context.Context, key K) (V, error) {
+	l.mu.Lock()
+	res, ok := l.cache[key]
+	if !ok {
+		res = &result[V]{done: make(chan struct{})}
+		l.cache[key] = res
+		l.pending = append(l.pending, key)
+		if len(l.pending) == 1 {
+			// the batch is fetched for everyone in it, so it mustn't be
+			// cancelled just because the first caller gave up
+			batchCtx := context.WithoutCancel(ctx)
+			time.AfterFunc(l.wait, func() { l.dispatch(batchCtx) })
+		}
+	}
+	l.mu.Unlock()
+
+	select {
+	case <-res.done:
+		return res.value, res.err
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+func (l *Loader[K, V]) dispatch(ctx context.Context) {
+	l.mu.Lock()
+	keys := l.pending
+	l.pending = nil
+	l.mu.Unlock()
+
+	values, err := l.fetch(ctx, keys)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, key := range keys {
+		res := l.cache[key]
+		switch value, ok := values[key]; {
+		case err != nil:
+			res.err = err
+		case !ok:
+			res.err = ErrNotFound
+		default:
+			res.value = value
+		}
+		close(res.done)
+	}
+}
@@ -0,0 +1,67 @@
+package dataloader
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLoadBatches(t *testing.T) {
+	var mu sync.Mutex
+	var batches [][]int
+	loader := New(func(ctx context.Context, keys []int) (map[int]string, error) {
+		mu.Lock()
+		batches = append(batches, keys)
+		mu.Unlock()
+		values := map[int]string{}
+		for _, k := range keys {
+			if k != 0 {
+				values[k] = string(rune('a' + k))
+			}
+		}
+		return values, nil
+	}, 5*time.Millisecond)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for _, key := range []int{1, 2, 1, 3} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := loader.Load(ctx, key); err != nil || v != string(rune('a'+key)) {
+				t.Errorf("Load(%d) = %q, %v", key, v, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(batches) != 1 || len(batches[0]) != 3 {
+		t.Fatalf("expected one batch of the 3 distinct keys, got %v", batches)
+	}
+
+	if _, err := loader.Load(ctx, 2); err != nil || len(batches) != 1 {
+		t.Errorf("expected a cached key not to be fetched again, got %v and %d batches", err, len(batches))
+	}
+	if _, err := loader.Load(ctx, 0); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a missing key, got %v", err)
+	}
+}
+
+func TestLoadError(t *testing.T) {
+	errDown := errors.New("down")
+	loader := New(func(ctx context.Context, keys []int) (map[int]int, error) {
+		return nil, errDown
+	}, time.Millisecond)
+
+	if _, err := loader.Load(context.Background(), 1); !errors.Is(err, errDown) {
+		t.Errorf("expected the batch error, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := loader.Load(ctx, 2); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected Load to stop with the context, got %v", err)
+	}
+}
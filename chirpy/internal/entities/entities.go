@@ -0,0 +1,76 @@
+package entities
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Entity is a mention or hashtag found in a chirp body. Start and End
+// are byte offsets into the body, and Text excludes the leading sigil.
+type Entity struct {
+	Text  string
+	Start int
+	End   int
+}
+
+// Parse scans a chirp body for @mentions and #hashtags. A sigil only
+// starts an entity at the beginning of the body or after whitespace, so
+// email addresses inside words are not mistaken for mentions. Mentions
+// may contain the characters of an email address or handle; hashtags
+// are letters, digits and underscores.
+func Parse(body string) (mentions, hashtags []Entity) {
+	for i := 0; i < len(body); {
+		r, size := utf8.DecodeRuneInString(body[i:])
+		if (r == '@' || r == '#') && (i == 0 || isSpaceBefore(body, i)) {
+			valid := isTagRune
+			if r == '@' {
+				valid = isMentionRune
+			}
+
+			end := i + size
+			for end < len(body) {
+				next, nextSize := utf8.DecodeRuneInString(body[end:])
+				if !valid(next) {
+					break
+				}
+				end += nextSize
+			}
+
+			// trailing punctuation usually ends the sentence rather than
+			// the mention, e.g. "thanks @bob."
+			text := strings.TrimRight(body[i+size:end], ".-")
+			end = i + size + len(text)
+			if text != "" {
+				e := Entity{Text: text, Start: i, End: end}
+				if r == '@' {
+					mentions = append(mentions, e)
+				} else {
+					hashtags = append(hashtags, e)
+				}
+			}
+			i = end
+			continue
+		}
+		i += size
+	}
+	return mentions, hashtags
+}
+
+// NormalizeTag folds a hashtag to the form it is stored and looked up by.
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimPrefix(tag, "#"))
+}
+
+func isSpaceBefore(body string, i int) bool {
+	r, _ := utf8.DecodeLastRuneInString(body[:i])
+	return unicode.IsSpace(r)
+}
+
+func isTagRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func isMentionRune(r rune) bool {
+	return isTagRune(r) || r == '.' || r == '-' || r == '+' || r == '@'
+}
@@ -0,0 +1,59 @@
+package entities
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		body     string
+		mentions []string
+		hashtags []string
+	}{
+		{
+			body: "hello world",
+		},
+		{
+			body:     "hey @bob@example.com check #Go and #go_lang!",
+			mentions: []string{"bob@example.com"},
+			hashtags: []string{"Go", "go_lang"},
+		},
+		{
+			body:     "thanks @alice. see you #soon.",
+			mentions: []string{"alice"},
+			hashtags: []string{"soon"},
+		},
+		{
+			body: "mail me at bob@example.com or issue#12",
+		},
+		{
+			body: "lonely @ and # sigils",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.body, func(t *testing.T) {
+			mentions, hashtags := Parse(c.body)
+			if got := texts(mentions); !reflect.DeepEqual(got, c.mentions) {
+				t.Errorf("mentions: expected %v, got %v", c.mentions, got)
+			}
+			if got := texts(hashtags); !reflect.DeepEqual(got, c.hashtags) {
+				t.Errorf("hashtags: expected %v, got %v", c.hashtags, got)
+			}
+			for _, e := range append(mentions, hashtags...) {
+				if c.body[e.Start+1:e.End] != e.Text {
+					t.Errorf("offsets %d:%d don't match %q", e.Start, e.End, e.Text)
+				}
+			}
+		})
+	}
+}
+
+func texts(es []Entity) []string {
+	var out []string
+	for _, e := range es {
+		out = append(out, e.Text)
+	}
+	return out
+}
@@ -0,0 +1,142 @@
+// Package health runs named health checks for the liveness and readiness
+// endpoints. Results are cached briefly so frequent probes don't add load
+// to what they are checking.
+package health
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Func checks one dependency and returns an error if it is unhealthy.
+type Func func(ctx context.Context) error
+
+// Result is the outcome of one check.
+type Result struct {
+	Name      string
+	Err       error
+	Latency   time.Duration
+	CheckedAt time.Time
+}
+
+// OK reports whether the check passed.
+func (r Result) OK() bool {
+	return r.Err == nil
+}
+
+type check struct {
+	name string
+	fn   Func
+
+	// mu is held while the check runs so concurrent probes share one run.
+	mu     sync.Mutex
+	result Result
+}
+
+// Registry holds an ordered set of checks.
+type Registry struct {
+	cacheTTL time.Duration
+	timeout  time.Duration
+	checks   []*check
+}
+
+// NewRegistry returns a registry that reuses a check's result for
+// cacheTTL and fails a check that takes longer than timeout.
+func NewRegistry(cacheTTL, timeout time.Duration) *Registry {
+	return &Registry{
+		cacheTTL: cacheTTL,
+		timeout:  timeout,
+	}
+}
+
+// Register adds a check. It must not be called once the registry is in
+// use.
+func (reg *Registry) Register(name string, fn Func) {
+	reg.checks = append(reg.checks, &check{name: name, fn: fn})
+}
+
+// Run runs every check concurrently, or returns its cached result if it
+// is fresh, and returns the results in registration order.
+func (reg *Registry) Run(ctx context.Context) []Result {
+	results := make([]Result, len(reg.checks))
+	var wg sync.WaitGroup
+	for i, c := range reg.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = reg.run(ctx, c)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+func (reg *Registry) run(ctx context.Context, c *check) Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if !c.result.CheckedAt.IsZero() && now.Sub(c.result.CheckedAt) < reg.cacheTTL {
+		return c.result
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, reg.timeout)
+	defer cancel()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.fn(ctx)
+	}()
+	var err error
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+		err = fmt.Errorf("timed out after %s", reg.timeout)
+	}
+
+	c.result = Result{
+		Name:      c.name,
+		Err:       err,
+		Latency:   time.Since(now),
+		CheckedAt: now,
+	}
+	return c.result
+}
+
+// Healthy reports whether every result passed.
+func Healthy(results []Result) bool {
+	for _, r := range results {
+		if !r.OK() {
+			return false
+		}
+	}
+	return true
+}
+
+// Heartbeat returns a check that fails when last reports a time more
+// than maxAge ago, for noticing background loops that have stalled.
+func Heartbeat(last func() time.Time, maxAge time.Duration) Func {
+	return func(ctx context.Context) error {
+		if age := time.Since(last()); age > maxAge {
+			return fmt.Errorf("last heartbeat %s ago", age.Round(time.Second))
+		}
+		return nil
+	}
+}
+
+// FreeSpace returns a check that fails when the filesystem holding path
+// has fewer than minBytes available.
+func FreeSpace(path string, minBytes uint64) Func {
+	return func(ctx context.Context) error {
+		free, err := freeBytes(path)
+		if err != nil {
+			return err
+		}
+		if free < minBytes {
+			return fmt.Errorf("%d bytes free on %s, want at least %d", free, path, minBytes)
+		}
+		return nil
+	}
+}
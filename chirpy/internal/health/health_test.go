@@ -0,0 +1,76 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunCachesResults(t *testing.T) {
+	reg := NewRegistry(time.Hour, time.Second)
+	var calls atomic.Int32
+	reg.Register("counted", func(ctx context.Context) error {
+		calls.Add(1)
+		return nil
+	})
+	reg.Register("broken", func(ctx context.Context) error {
+		return errors.New("broken")
+	})
+
+	results := reg.Run(context.Background())
+	reg.Run(context.Background())
+
+	if calls.Load() != 1 {
+		t.Errorf("expected the cached result to be reused, ran %d times", calls.Load())
+	}
+	if len(results) != 2 || results[0].Name != "counted" || results[1].Name != "broken" {
+		t.Fatalf("expected results in registration order, got %+v", results)
+	}
+	if !results[0].OK() || results[1].OK() {
+		t.Errorf("unexpected results %+v", results)
+	}
+	if Healthy(results) {
+		t.Errorf("expected a failing check to make the results unhealthy")
+	}
+}
+
+func TestRunTimesOut(t *testing.T) {
+	reg := NewRegistry(0, 10*time.Millisecond)
+	reg.Register("slow", func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+
+	start := time.Now()
+	results := reg.Run(context.Background())
+	if results[0].OK() {
+		t.Errorf("expected the slow check to fail")
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Errorf("expected Run not to wait for the slow check")
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	last := time.Now().Add(-time.Minute)
+	check := Heartbeat(func() time.Time { return last }, 30*time.Second)
+	if check(context.Background()) == nil {
+		t.Errorf("expected a stale heartbeat to fail")
+	}
+	last = time.Now()
+	if err := check(context.Background()); err != nil {
+		t.Errorf("expected a fresh heartbeat to pass, got %v", err)
+	}
+}
+
+func TestFreeSpace(t *testing.T) {
+	dir := t.TempDir()
+	if err := FreeSpace(dir, 1)(context.Background()); err != nil {
+		t.Errorf("expected a byte to be free, got %v", err)
+	}
+	if FreeSpace(dir, 1<<62)(context.Background()) == nil {
+		t.Skip("free space check is not supported on this platform")
+	}
+}
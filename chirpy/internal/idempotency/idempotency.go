@@ -0,0 +1,138 @@
+// Package idempotency remembers the responses to requests sent with an
+// Idempotency-Key so retries can be answered without running them again.
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrKeyReused is returned when a key is sent again with a request that
+// doesn't match the one it was first used for.
+var ErrKeyReused = errors.New("idempotency key reused for a different request")
+
+// Response is a stored response, replayed for retries.
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// Store holds responses by key. Begin claims a key: if it returns a nil
+// Response the caller runs the request and must then call either
+// Complete, to keep the response, or Abort, to let a retry run it again.
+// A request that finds the key claimed by one still in flight waits for
+// it to finish. MemoryStore is the only implementation for now.
+type Store interface {
+	Begin(ctx context.Context, key, fingerprint string, now time.Time) (*Response, error)
+	Complete(key string, resp Response, expires time.Time)
+	Abort(key string)
+}
+
+type entry struct {
+	fingerprint string
+	// done is closed once the request holding the key finishes.
+	done    chan struct{}
+	resp    *Response
+	expires time.Time
+}
+
+// MemoryStore is an in-process Store. Responses are lost on restart.
+// Expired ones are only replaced when their key is reused, so Reap
+// should be called now and then to drop the rest.
+type MemoryStore struct {
+	entries map[string]*entry
+	mu      sync.Mutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: map[string]*entry{},
+	}
+}
+
+func (s *MemoryStore) Begin(ctx context.Context, key, fingerprint string, now time.Time) (*Response, error) {
+	for {
+		s.mu.Lock()
+		e, ok := s.entries[key]
+		if ok && e.resp != nil && !now.Before(e.expires) {
+			delete(s.entries, key)
+			ok = false
+		}
+		if !ok {
+			s.entries[key] = &entry{fingerprint: fingerprint, done: make(chan struct{})}
+			s.mu.Unlock()
+			return nil, nil
+		}
+		if e.fingerprint != fingerprint {
+			s.mu.Unlock()
+			return nil, ErrKeyReused
+		}
+		if e.resp != nil {
+			resp := *e.resp
+			s.mu.Unlock()
+			return &resp, nil
+		}
+		done := e.done
+		s.mu.Unlock()
+
+		// another request holds the key; once it finishes we either find
+		// its response or, if it was aborted, claim the key ourselves
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (s *MemoryStore) Complete(key string, resp Response, expires time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok || e.resp != nil {
+		return
+	}
+	e.resp = &resp
+	e.expires = expires
+	close(e.done)
+}
+
+func (s *MemoryStore) Abort(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok || e.resp != nil {
+		return
+	}
+	delete(s.entries, key)
+	close(e.done)
+}
+
+// Reap drops stored responses that have expired and returns how many it
+// dropped. Requests still in flight are kept.
+func (s *MemoryStore) Reap(now time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reaped := 0
+	for key, e := range s.entries {
+		if e.resp != nil && !now.Before(e.expires) {
+			delete(s.entries, key)
+			reaped++
+		}
+	}
+	return reaped
+}
+
+// Len returns the number of keys held, in flight or stored.
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
@@ -0,0 +1,107 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBeginComplete(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+	now := time.Now()
+
+	resp, err := store.Begin(ctx, "k", "a", now)
+	if err != nil || resp != nil {
+		t.Fatalf("expected to claim a new key, got %v, %v", resp, err)
+	}
+	store.Complete("k", Response{Status: 201, Body: []byte("first")}, now.Add(time.Hour))
+
+	resp, err = store.Begin(ctx, "k", "a", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || resp.Status != 201 || string(resp.Body) != "first" {
+		t.Fatalf("expected the stored response, got %+v", resp)
+	}
+
+	if _, err := store.Begin(ctx, "k", "b", now); !errors.Is(err, ErrKeyReused) {
+		t.Errorf("expected ErrKeyReused for a different fingerprint, got %v", err)
+	}
+
+	resp, err = store.Begin(ctx, "k", "b", now.Add(time.Hour))
+	if err != nil || resp != nil {
+		t.Errorf("expected an expired key to be claimable, got %v, %v", resp, err)
+	}
+}
+
+func TestBeginWaitsForInFlight(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+	now := time.Now()
+
+	if resp, _ := store.Begin(ctx, "k", "a", now); resp != nil {
+		t.Fatal("expected to claim a new key")
+	}
+
+	var wg sync.WaitGroup
+	results := make([]*Response, 3)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], _ = store.Begin(ctx, "k", "a", now)
+		}()
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	store.Complete("k", Response{Status: 200}, now.Add(time.Hour))
+	wg.Wait()
+
+	for i, resp := range results {
+		if resp == nil || resp.Status != 200 {
+			t.Errorf("waiter %d: expected the completed response, got %+v", i, resp)
+		}
+	}
+}
+
+func TestAbort(t *testing.T) {
+	store := NewMemoryStore()
+	now := time.Now()
+
+	store.Begin(context.Background(), "k", "a", now)
+
+	claimed := make(chan *Response)
+	go func() {
+		resp, _ := store.Begin(context.Background(), "k", "a", now)
+		claimed <- resp
+	}()
+	time.Sleep(10 * time.Millisecond)
+	store.Abort("k")
+
+	if resp := <-claimed; resp != nil {
+		t.Errorf("expected the waiter to claim an aborted key, got %+v", resp)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := store.Begin(ctx, "k", "a", now); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected waiting to stop with the context, got %v", err)
+	}
+}
+
+func TestReap(t *testing.T) {
+	store := NewMemoryStore()
+	ctx := context.Background()
+	now := time.Now()
+
+	store.Begin(ctx, "done", "a", now)
+	store.Complete("done", Response{Status: 200}, now.Add(time.Minute))
+	store.Begin(ctx, "in-flight", "a", now)
+
+	if n := store.Reap(now.Add(time.Hour)); n != 1 || store.Len() != 1 {
+		t.Errorf("expected only the in-flight key to survive, have %d", store.Len())
+	}
+}
@@ -0,0 +1,228 @@
+// Package jobs runs chirpy's maintenance tasks in process on cron-like
+// schedules. A job never runs twice at once: a run that comes due while
+// the last one is still going is skipped. The most recent runs of each
+// job are kept for the admin API.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrUnknownJob is returned by Trigger for a name that wasn't
+	// registered.
+	ErrUnknownJob = errors.New("no such job")
+	// ErrRunning is returned by Trigger when the job is already running.
+	ErrRunning = errors.New("job is already running")
+	// ErrStopped is returned by Trigger when the runner isn't running.
+	ErrStopped = errors.New("job runner is not running")
+)
+
+// Func does one run of a job. The result is a short summary of what it
+// did, such as how many records it removed, kept in the job's history.
+type Func func(ctx context.Context) (result string, err error)
+
+// Run is one completed run of a job.
+type Run struct {
+	StartedAt time.Time
+	Duration  time.Duration
+	// Manual is set for runs started with Trigger.
+	Manual bool
+	Result string
+	Err    error
+}
+
+// Status describes a job and its recent runs, newest first.
+type Status struct {
+	Name     string
+	Schedule string
+	Running  bool
+	// NextRun is zero if the schedule never matches again.
+	NextRun time.Time
+	Runs    []Run
+}
+
+type job struct {
+	name     string
+	spec     string
+	schedule Schedule
+	fn       Func
+
+	running bool
+	next    time.Time
+	runs    []Run
+}
+
+// Runner runs registered jobs when they come due.
+type Runner struct {
+	tick        time.Duration
+	historySize int
+
+	mu       sync.Mutex
+	jobs     []*job
+	ctx      context.Context
+	wg       sync.WaitGroup
+	lastTick time.Time
+}
+
+// NewRunner returns a runner that checks for due jobs every tick and
+// keeps the last historySize runs of each job.
+func NewRunner(tick time.Duration, historySize int) *Runner {
+	return &Runner{
+		tick:        tick,
+		historySize: historySize,
+		lastTick:    time.Now(),
+	}
+}
+
+// Register adds a job that runs on the schedule spec; see ParseSchedule.
+// It must not be called once the runner is running.
+func (r *Runner) Register(name, spec string, fn Func) error {
+	schedule, err := ParseSchedule(spec)
+	if err != nil {
+		return err
+	}
+	for _, j := range r.jobs {
+		if j.name == name {
+			return fmt.Errorf("job %q registered twice", name)
+		}
+	}
+	r.jobs = append(r.jobs, &job{name: name, spec: spec, schedule: schedule, fn: fn})
+	return nil
+}
+
+// Run starts jobs as they come due until ctx is cancelled, then waits for
+// any runs in progress to finish.
+func (r *Runner) Run(ctx context.Context) {
+	now := time.Now()
+	r.mu.Lock()
+	r.ctx = ctx
+	for _, j := range r.jobs {
+		j.next = j.schedule.Next(now)
+	}
+	r.mu.Unlock()
+
+	ticker := time.NewTicker(r.tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			r.mu.Lock()
+			r.ctx = nil
+			r.mu.Unlock()
+			r.wg.Wait()
+			return
+		case now := <-ticker.C:
+			r.runDue(now)
+		}
+	}
+}
+
+func (r *Runner) runDue(now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.lastTick = now
+	for _, j := range r.jobs {
+		if j.next.IsZero() || now.Before(j.next) {
+			continue
+		}
+		j.next = j.schedule.Next(now)
+		if j.running {
+			slog.Warn("Skipped job still running from its last run", "job", j.name)
+			continue
+		}
+		r.start(j, false)
+	}
+}
+
+// Trigger starts a run of the named job now, outside its schedule. It
+// doesn't wait for the run to finish.
+func (r *Runner) Trigger(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, j := range r.jobs {
+		if j.name != name {
+			continue
+		}
+		if r.ctx == nil {
+			return ErrStopped
+		}
+		if j.running {
+			return ErrRunning
+		}
+		r.start(j, true)
+		return nil
+	}
+	return ErrUnknownJob
+}
+
+// start runs j in the background. r.mu must be held.
+func (r *Runner) start(j *job, manual bool) {
+	j.running = true
+	ctx := r.ctx
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		run := Run{StartedAt: time.Now(), Manual: manual}
+		run.Result, run.Err = call(ctx, j.fn)
+		run.Duration = time.Since(run.StartedAt)
+
+		if run.Err != nil {
+			slog.Error("Job failed", "job", j.name, "duration", run.Duration, "error", run.Err)
+		} else {
+			slog.Info("Job finished", "job", j.name, "duration", run.Duration, "result", run.Result)
+		}
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		j.running = false
+		j.runs = append([]Run{run}, j.runs...)
+		if len(j.runs) > r.historySize {
+			j.runs = j.runs[:r.historySize]
+		}
+	}()
+}
+
+// call runs fn, turning a panic into an error so one broken job doesn't
+// take chirpy down with it.
+func call(ctx context.Context, fn Func) (result string, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	return fn(ctx)
+}
+
+// Jobs returns the status of every job in registration order.
+func (r *Runner) Jobs() []Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	statuses := make([]Status, 0, len(r.jobs))
+	for _, j := range r.jobs {
+		statuses = append(statuses, Status{
+			Name:     j.name,
+			Schedule: j.spec,
+			Running:  j.running,
+			NextRun:  j.next,
+			Runs:     append([]Run(nil), j.runs...),
+		})
+	}
+	return statuses
+}
+
+// LastTick returns when the runner last checked for due jobs, or when it
+// was created if it hasn't yet.
+func (r *Runner) LastTick() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lastTick
+}
@@ -0,0 +1,109 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	from := time.Date(2026, 10, 19, 10, 30, 15, 0, time.UTC) // a Monday
+	for spec, want := range map[string]time.Time{
+		"@every 90s":     from.Add(90 * time.Second),
+		"@hourly":        time.Date(2026, 10, 19, 11, 0, 0, 0, time.UTC),
+		"@daily":         time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC),
+		"*/15 * * * *":   time.Date(2026, 10, 19, 10, 45, 0, 0, time.UTC),
+		"30 4 * * *":     time.Date(2026, 10, 20, 4, 30, 0, 0, time.UTC),
+		"0 9-17/4 * * *": time.Date(2026, 10, 19, 13, 0, 0, 0, time.UTC),
+		"0 0 * * 7":      time.Date(2026, 10, 25, 0, 0, 0, 0, time.UTC),
+		"0 0 1,15 2 *":   time.Date(2027, 2, 1, 0, 0, 0, 0, time.UTC),
+		// either day field matches when both are restricted
+		"0 0 1 * 3": time.Date(2026, 10, 21, 0, 0, 0, 0, time.UTC),
+	} {
+		schedule, err := ParseSchedule(spec)
+		if err != nil {
+			t.Errorf("%s: %v", spec, err)
+			continue
+		}
+		if got := schedule.Next(from); !got.Equal(want) {
+			t.Errorf("%s: expected next run at %s, got %s", spec, want, got)
+		}
+	}
+
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "5-1 * * * *", "*/0 * * * *", "@every soon", "@every 1ms", "@yearly"} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("expected %q to be rejected", spec)
+		}
+	}
+}
+
+func TestRunnerRunsOnceAtATime(t *testing.T) {
+	r := NewRunner(5*time.Millisecond, 2)
+	release := make(chan struct{})
+	started := make(chan struct{}, 10)
+	if err := r.Register("slow", "@every 1s", func(ctx context.Context) (string, error) {
+		started <- struct{}{}
+		<-release
+		return "done", nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register("broken", "@every 1h", func(ctx context.Context) (string, error) {
+		panic("oops")
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register("slow", "@hourly", nil); err == nil {
+		t.Error("expected a duplicate name to be rejected")
+	}
+
+	if err := r.Trigger("slow"); !errors.Is(err, ErrStopped) {
+		t.Errorf("expected ErrStopped before the runner starts, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.Run(ctx)
+		close(done)
+	}()
+	for r.Trigger("slow") == ErrStopped {
+		time.Sleep(time.Millisecond)
+	}
+	<-started
+	if err := r.Trigger("slow"); !errors.Is(err, ErrRunning) {
+		t.Errorf("expected ErrRunning while the job runs, got %v", err)
+	}
+	if err := r.Trigger("missing"); !errors.Is(err, ErrUnknownJob) {
+		t.Errorf("expected ErrUnknownJob, got %v", err)
+	}
+	if err := r.Trigger("broken"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the scheduled run comes due while the manual one is still going
+	time.Sleep(1100 * time.Millisecond)
+	select {
+	case <-started:
+		t.Error("expected the scheduled run to be skipped while the job runs")
+	default:
+	}
+	close(release)
+	cancel()
+	<-done
+
+	statuses := r.Jobs()
+	if len(statuses) != 2 || statuses[0].Name != "slow" || statuses[0].Running {
+		t.Fatalf("unexpected statuses %+v", statuses)
+	}
+	if runs := statuses[0].Runs; len(runs) != 1 || !runs[0].Manual || runs[0].Result != "done" {
+		t.Errorf("expected one manual run, got %+v", runs)
+	}
+	if runs := statuses[1].Runs; len(runs) != 1 || runs[0].Err == nil {
+		t.Errorf("expected the panic to be recorded as an error, got %+v", runs)
+	}
+	if time.Since(r.LastTick()) > time.Second {
+		t.Errorf("expected the runner to have ticked, last at %s", r.LastTick())
+	}
+}
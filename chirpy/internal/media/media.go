@@ -0,0 +1,120 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+var (
+	ErrUnsupportedType = errors.New("unsupported media type")
+	// ErrTooManyPixels is returned by Thumbnail for images whose header
+	// claims more than MaxPixels.
+	ErrTooManyPixels = errors.New("image has too many pixels")
+)
+
+// MaxPixels caps the width times height of images Thumbnail will decode.
+// A small, highly compressed file can claim dimensions that would take
+// gigabytes to decode, so the header is checked first.
+const MaxPixels = 50_000_000
+
+// allowedTypes maps the MIME types we accept to whether we know how to
+// build a thumbnail for them.
+var allowedTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": false,
+	"video/mp4":  false,
+}
+
+// DetectContentType sniffs the MIME type from the first bytes of the
+// upload. The client supplied Content-Type is never trusted.
+func DetectContentType(head []byte) (string, error) {
+	contentType := http.DetectContentType(head)
+	if _, ok := allowedTypes[contentType]; !ok {
+		return "", ErrUnsupportedType
+	}
+	return contentType, nil
+}
+
+// CanThumbnail reports whether Thumbnail supports the given MIME type.
+func CanThumbnail(contentType string) bool {
+	return allowedTypes[contentType]
+}
+
+// Thumbnail decodes an image and scales it down so that neither side
+// exceeds maxSize, preserving the aspect ratio. JPEG sources stay JPEG,
+// everything else is re-encoded as PNG. The MIME type of the result is
+// returned alongside the encoded bytes. Images of more than MaxPixels
+// are rejected with ErrTooManyPixels before they are decoded.
+func Thumbnail(data []byte, maxSize int) ([]byte, string, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+	if config.Width <= 0 || config.Height <= 0 || int64(config.Width)*int64(config.Height) > MaxPixels {
+		return nil, "", ErrTooManyPixels
+	}
+
+	src, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+
+	dst := scale(src, maxSize)
+
+	buf := &bytes.Buffer{}
+	if format == "jpeg" {
+		err = jpeg.Encode(buf, dst, &jpeg.Options{Quality: 80})
+		return buf.Bytes(), "image/jpeg", err
+	}
+	err = png.Encode(buf, dst)
+	return buf.Bytes(), "image/png", err
+}
+
+// scale does a simple box filter downscale, averaging every source pixel
+// that falls into each destination pixel.
+func scale(src image.Image, maxSize int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= maxSize && h <= maxSize {
+		return src
+	}
+
+	dw, dh := maxSize, maxSize
+	if w > h {
+		dh = max(1, h*maxSize/w)
+	} else {
+		dw = max(1, w*maxSize/h)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := b.Min.Y+y*h/dh, b.Min.Y+(y+1)*h/dh
+		for x := 0; x < dw; x++ {
+			x0, x1 := b.Min.X+x*w/dw, b.Min.X+(x+1)*w/dw
+
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < max(y1, y0+1); sy++ {
+				for sx := x0; sx < max(x1, x0+1); sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(bl / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+	return dst
+}
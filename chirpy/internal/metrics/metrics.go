@@ -0,0 +1,309 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultBuckets are histogram upper bounds in seconds, suitable for
+// request and database latencies.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type metricType string
+
+const (
+	typeCounter   metricType = "counter"
+	typeGauge     metricType = "gauge"
+	typeHistogram metricType = "histogram"
+)
+
+type metric interface {
+	snapshot() Family
+}
+
+// Registry holds a set of metrics and renders them in the Prometheus text
+// exposition format.
+type Registry struct {
+	mu      sync.Mutex
+	metrics map[string]metric
+}
+
+func NewRegistry() *Registry {
+	return &Registry{metrics: map[string]metric{}}
+}
+
+func (r *Registry) register(name string, m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.metrics[name]; ok {
+		panic(fmt.Sprintf("metrics: %s registered twice", name))
+	}
+	r.metrics[name] = m
+}
+
+// Sample is one labelled value of a metric. Histograms fill in Buckets,
+// Sum and Count instead of Value.
+type Sample struct {
+	Labels  []string
+	Value   float64
+	Buckets []uint64
+	Sum     float64
+	Count   uint64
+}
+
+// Family is a point in time copy of a metric and all its samples.
+type Family struct {
+	Name       string
+	Help       string
+	Type       string
+	LabelNames []string
+	Bounds     []float64
+	Samples    []Sample
+}
+
+// Snapshot copies every metric, sorted by name, with samples sorted by
+// label values.
+func (r *Registry) Snapshot() []Family {
+	r.mu.Lock()
+	metrics := make([]metric, 0, len(r.metrics))
+	for _, m := range r.metrics {
+		metrics = append(metrics, m)
+	}
+	r.mu.Unlock()
+
+	families := make([]Family, 0, len(metrics))
+	for _, m := range metrics {
+		f := m.snapshot()
+		sort.Slice(f.Samples, func(i, j int) bool {
+			return strings.Join(f.Samples[i].Labels, "\xff") < strings.Join(f.Samples[j].Labels, "\xff")
+		})
+		families = append(families, f)
+	}
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].Name < families[j].Name
+	})
+	return families
+}
+
+// WritePrometheus writes every metric in the Prometheus text format.
+func (r *Registry) WritePrometheus(w io.Writer) error {
+	for _, f := range r.Snapshot() {
+		_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.Name, escapeHelp(f.Help), f.Name, f.Type)
+		if err != nil {
+			return err
+		}
+		for _, s := range f.Samples {
+			if f.Type != string(typeHistogram) {
+				_, err = fmt.Fprintf(w, "%s%s %s\n", f.Name, formatLabels(f.LabelNames, s.Labels, "", 0), formatFloat(s.Value))
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+			for i, bound := range f.Bounds {
+				_, err = fmt.Fprintf(w, "%s_bucket%s %d\n", f.Name, formatLabels(f.LabelNames, s.Labels, "le", bound), s.Buckets[i])
+				if err != nil {
+					return err
+				}
+			}
+			_, err = fmt.Fprintf(w, "%s_bucket%s %d\n%s_sum%s %s\n%s_count%s %d\n",
+				f.Name, formatLabels(f.LabelNames, s.Labels, "le", math.Inf(1)), s.Count,
+				f.Name, formatLabels(f.LabelNames, s.Labels, "", 0), formatFloat(s.Sum),
+				f.Name, formatLabels(f.LabelNames, s.Labels, "", 0), s.Count,
+			)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// CounterVec is a set of counters partitioned by label values.
+type CounterVec struct {
+	name, help string
+	labelNames []string
+
+	mu     sync.Mutex
+	values map[string]*counterValue
+}
+
+type counterValue struct {
+	labels []string
+	n      atomic.Uint64
+}
+
+func (r *Registry) NewCounterVec(name, help string, labelNames ...string) *CounterVec {
+	c := &CounterVec{
+		name:       name,
+		help:       help,
+		labelNames: labelNames,
+		values:     map[string]*counterValue{},
+	}
+	r.register(name, c)
+	return c
+}
+
+// Inc adds one to the counter with the given label values.
+func (c *CounterVec) Inc(labels ...string) {
+	c.get(labels).n.Add(1)
+}
+
+// Value returns the current value of the counter with the given labels.
+func (c *CounterVec) Value(labels ...string) uint64 {
+	return c.get(labels).n.Load()
+}
+
+// Reset sets every counter back to zero.
+func (c *CounterVec) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values = map[string]*counterValue{}
+}
+
+func (c *CounterVec) get(labels []string) *counterValue {
+	key := labelKey(c.labelNames, labels)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.values[key]
+	if !ok {
+		v = &counterValue{labels: labels}
+		c.values[key] = v
+	}
+	return v
+}
+
+func (c *CounterVec) snapshot() Family {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f := Family{Name: c.name, Help: c.help, Type: string(typeCounter), LabelNames: c.labelNames}
+	for _, v := range c.values {
+		f.Samples = append(f.Samples, Sample{Labels: v.labels, Value: float64(v.n.Load())})
+	}
+	return f
+}
+
+// GaugeFunc is a gauge whose value is computed when metrics are read.
+type GaugeFunc struct {
+	name, help string
+	fn         func() float64
+}
+
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	g := &GaugeFunc{name: name, help: help, fn: fn}
+	r.register(name, g)
+	return g
+}
+
+func (g *GaugeFunc) snapshot() Family {
+	return Family{
+		Name:    g.name,
+		Help:    g.help,
+		Type:    string(typeGauge),
+		Samples: []Sample{{Value: g.fn()}},
+	}
+}
+
+// HistogramVec is a set of histograms partitioned by label values.
+type HistogramVec struct {
+	name, help string
+	labelNames []string
+	bounds     []float64
+
+	mu     sync.Mutex
+	values map[string]*histogramValue
+}
+
+type histogramValue struct {
+	labels  []string
+	buckets []uint64
+	sum     float64
+	count   uint64
+}
+
+func (r *Registry) NewHistogramVec(name, help string, bounds []float64, labelNames ...string) *HistogramVec {
+	h := &HistogramVec{
+		name:       name,
+		help:       help,
+		labelNames: labelNames,
+		bounds:     bounds,
+		values:     map[string]*histogramValue{},
+	}
+	r.register(name, h)
+	return h
+}
+
+// Observe records v in the histogram with the given label values.
+func (h *HistogramVec) Observe(v float64, labels ...string) {
+	key := labelKey(h.labelNames, labels)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hv, ok := h.values[key]
+	if !ok {
+		hv = &histogramValue{labels: labels, buckets: make([]uint64, len(h.bounds))}
+		h.values[key] = hv
+	}
+	for i, bound := range h.bounds {
+		if v <= bound {
+			hv.buckets[i]++
+		}
+	}
+	hv.sum += v
+	hv.count++
+}
+
+func (h *HistogramVec) snapshot() Family {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	f := Family{Name: h.name, Help: h.help, Type: string(typeHistogram), LabelNames: h.labelNames, Bounds: h.bounds}
+	for _, hv := range h.values {
+		buckets := make([]uint64, len(hv.buckets))
+		copy(buckets, hv.buckets)
+		f.Samples = append(f.Samples, Sample{
+			Labels:  hv.labels,
+			Buckets: buckets,
+			Sum:     hv.sum,
+			Count:   hv.count,
+		})
+	}
+	return f
+}
+
+func labelKey(names, values []string) string {
+	if len(names) != len(values) {
+		panic(fmt.Sprintf("metrics: expected %d label values, got %d", len(names), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+func formatLabels(names, values []string, extraName string, extraValue float64) string {
+	pairs := make([]string, 0, len(names)+1)
+	for i, name := range names {
+		pairs = append(pairs, name+"="+strconv.Quote(values[i]))
+	}
+	if extraName != "" {
+		pairs = append(pairs, extraName+"="+strconv.Quote(formatFloat(extraValue)))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	reg := NewRegistry()
+	requests := reg.NewCounterVec("requests_total", "Requests served.", "route", "code")
+	latency := reg.NewHistogramVec("latency_seconds", "Latency.", []float64{0.1, 1}, "route")
+	reg.NewGaugeFunc("sessions", "Active sessions.", func() float64 { return 3 })
+
+	requests.Inc("GET /api/chirps", "200")
+	requests.Inc("GET /api/chirps", "200")
+	latency.Observe(0.05, "GET /api/chirps")
+	latency.Observe(0.5, "GET /api/chirps")
+
+	out := &strings.Builder{}
+	err := reg.WritePrometheus(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"# TYPE requests_total counter",
+		`requests_total{route="GET /api/chirps",code="200"} 2`,
+		`latency_seconds_bucket{route="GET /api/chirps",le="0.1"} 1`,
+		`latency_seconds_bucket{route="GET /api/chirps",le="1"} 2`,
+		`latency_seconds_bucket{route="GET /api/chirps",le="+Inf"} 2`,
+		`latency_seconds_sum{route="GET /api/chirps"} 0.55`,
+		`latency_seconds_count{route="GET /api/chirps"} 2`,
+		"# TYPE sessions gauge",
+		"sessions 3",
+	}
+	for _, line := range expected {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("expected output to contain %q, got:\n%s", line, out)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+// Package pubsub fans events out to in-process subscribers, keeping a
+// bounded buffer of recent events so a subscriber that reconnects can
+// resume from the last one it saw.
+package pubsub
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrSlowConsumer ends a subscription that fell too far behind. The
+	// subscriber can resubscribe from its last event and catch up from
+	// the replay buffer.
+	ErrSlowConsumer = errors.New("subscriber fell behind")
+	// ErrClosed ends every subscription when the hub is closed.
+	ErrClosed = errors.New("hub is closed")
+)
+
+// Event is something published to a hub. IDs are unique to the hub and
+// increase with every event.
+type Event[T any] struct {
+	ID   string
+	Type string
+	Data T
+
+	seq uint64
+}
+
+// Hub delivers published events to every subscriber whose filter accepts
+// them. Publishing never blocks: a subscriber whose queue is full is
+// dropped with ErrSlowConsumer rather than holding up the others.
+type Hub[T any] struct {
+	// epoch tells apart event IDs from before a restart, which can't be
+	// resumed from
+	epoch       string
+	replaySize  int
+	queueSize   int
+	mu          sync.Mutex
+	seq         uint64
+	replay      []Event[T]
+	subscribers map[*Subscription[T]]struct{}
+	closed      bool
+}
+
+// NewHub returns a hub that keeps the last replaySize events for
+// resuming and queues up to queueSize events per subscriber.
+func NewHub[T any](replaySize, queueSize int) *Hub[T] {
+	return &Hub[T]{
+		epoch:       strconv.FormatInt(time.Now().UnixNano(), 36),
+		replaySize:  replaySize,
+		queueSize:   queueSize,
+		subscribers: map[*Subscription[T]]struct{}{},
+	}
+}
+
+// Subscription receives a hub's events on C until it is closed, by
+// Close, by the hub or for falling behind; Err then says why.
+type Subscription[T any] struct {
+	// Replay holds the buffered events published after the event ID
+	// given to Subscribe. They come before anything on C.
+	Replay []Event[T]
+	// Gap is set, and Replay empty, if some events after that ID are no
+	// longer buffered or the ID wasn't issued by this hub, so the
+	// subscriber must catch up some other way.
+	Gap bool
+	// LastID is the ID of the last event published before the
+	// subscription started, or "" if there hasn't been one. A subscriber
+	// that caught up after a Gap can resume from here.
+	LastID string
+	C      <-chan Event[T]
+
+	c      chan Event[T]
+	filter func(Event[T]) bool
+	hub    *Hub[T]
+	err    error
+}
+
+// Publish sends an event to the subscribers and adds it to the replay
+// buffer.
+func (h *Hub[T]) Publish(eventType string, data T) Event[T] {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.seq++
+	e := Event[T]{
+		ID:   h.eventID(h.seq),
+		Type: eventType,
+		Data: data,
+		seq:  h.seq,
+	}
+	if h.closed {
+		return e
+	}
+
+	h.replay = append(h.replay, e)
+	if len(h.replay) > h.replaySize {
+		h.replay = h.replay[len(h.replay)-h.replaySize:]
+	}
+
+	for sub := range h.subscribers {
+		if sub.filter != nil && !sub.filter(e) {
+			continue
+		}
+		select {
+		case sub.c <- e:
+		default:
+			h.drop(sub, ErrSlowConsumer)
+		}
+	}
+	return e
+}
+
+// Subscribe starts a subscription to the events filter accepts, or all
+// of them if filter is nil. filter is called with the hub locked, so it
+// must be quick and must not call back into the hub. If lastEventID is
+// set, the events published after it are put in Replay.
+func (h *Hub[T]) Subscribe(lastEventID string, filter func(Event[T]) bool) *Subscription[T] {
+	c := make(chan Event[T], h.queueSize)
+	sub := &Subscription[T]{C: c, c: c, filter: filter, hub: h}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		sub.err = ErrClosed
+		close(c)
+		return sub
+	}
+	if lastEventID != "" {
+		var ok bool
+		sub.Replay, ok = h.since(lastEventID)
+		sub.Gap = !ok
+		if filter != nil {
+			replay := sub.Replay[:0:0]
+			for _, e := range sub.Replay {
+				if filter(e) {
+					replay = append(replay, e)
+				}
+			}
+			sub.Replay = replay
+		}
+	}
+	if h.seq > 0 {
+		sub.LastID = h.eventID(h.seq)
+	}
+	h.subscribers[sub] = struct{}{}
+	return sub
+}
+
+func (h *Hub[T]) eventID(seq uint64) string {
+	return fmt.Sprintf("%s-%d", h.epoch, seq)
+}
+
+// since returns the buffered events after lastEventID. It reports false
+// if some of the events since then are no longer buffered, or the ID
+// wasn't issued by this hub, in which case none are returned.
+func (h *Hub[T]) since(lastEventID string) ([]Event[T], bool) {
+	epoch, seqString, _ := strings.Cut(lastEventID, "-")
+	seq, err := strconv.ParseUint(seqString, 10, 64)
+	if err != nil || epoch != h.epoch || seq > h.seq {
+		return nil, false
+	}
+	if seq == h.seq {
+		return nil, true
+	}
+	// the replay buffer is contiguous, so it only has to reach back to
+	// the event after lastEventID
+	if len(h.replay) == 0 || h.replay[0].seq > seq+1 {
+		return nil, false
+	}
+	return append([]Event[T]{}, h.replay[seq+1-h.replay[0].seq:]...), true
+}
+
+// Close stops the subscription. It is safe to call more than once.
+func (s *Subscription[T]) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	if _, ok := s.hub.subscribers[s]; ok {
+		s.hub.drop(s, nil)
+	}
+}
+
+// Err reports why C was closed: ErrSlowConsumer, ErrClosed, or nil if
+// the subscriber closed it.
+func (s *Subscription[T]) Err() error {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	return s.err
+}
+
+// drop removes a subscriber and closes its channel. h.mu must be held.
+func (h *Hub[T]) drop(sub *Subscription[T], err error) {
+	delete(h.subscribers, sub)
+	sub.err = err
+	close(sub.c)
+}
+
+// Close ends every subscription with ErrClosed, e.g. so long-lived
+// streams don't hold up a graceful shutdown. Later subscriptions end
+// immediately.
+func (h *Hub[T]) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for sub := range h.subscribers {
+		h.drop(sub, ErrClosed)
+	}
+}
+
+// Len returns the number of subscribers.
+func (h *Hub[T]) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers)
+}
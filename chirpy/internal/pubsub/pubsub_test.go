@@ -0,0 +1,115 @@
+package pubsub
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestPublishSubscribe(t *testing.T) {
+	hub := NewHub[int](10, 10)
+	odd := hub.Subscribe("", func(e Event[int]) bool { return e.Data%2 == 1 })
+	all := hub.Subscribe("", nil)
+	defer all.Close()
+
+	for i := 1; i <= 4; i++ {
+		hub.Publish("n", i)
+	}
+	odd.Close()
+	odd.Close()
+
+	var got []int
+	for e := range odd.C {
+		got = append(got, e.Data)
+	}
+	if len(got) != 2 || got[0] != 1 || got[1] != 3 {
+		t.Errorf("expected the filtered events 1 and 3, got %v", got)
+	}
+	if odd.Err() != nil {
+		t.Errorf("expected no error after Close, got %v", odd.Err())
+	}
+	if len(all.C) != 4 {
+		t.Errorf("expected 4 events without a filter, got %d", len(all.C))
+	}
+	if hub.Len() != 1 {
+		t.Errorf("expected closed subscriptions to be removed, have %d", hub.Len())
+	}
+}
+
+func TestReplay(t *testing.T) {
+	hub := NewHub[int](3, 10)
+	var ids []string
+	for i := 1; i <= 5; i++ {
+		ids = append(ids, hub.Publish("n", i).ID)
+	}
+
+	tests := []struct {
+		name        string
+		lastEventID string
+		want        []int
+		gap         bool
+	}{
+		{"buffered", ids[2], []int{4, 5}, false},
+		{"oldest kept", ids[1], []int{3, 4, 5}, false},
+		{"latest", ids[4], nil, false},
+		{"evicted", ids[0], nil, true},
+		{"other hub", "abc-2", nil, true},
+		{"garbage", "nope", nil, true},
+		{"future", ids[4] + "0", nil, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			sub := hub.Subscribe(tc.lastEventID, nil)
+			defer sub.Close()
+			if sub.LastID != ids[4] {
+				t.Errorf("expected LastID %s, got %s", ids[4], sub.LastID)
+			}
+			if sub.Gap != tc.gap {
+				t.Errorf("expected gap %t, got %t", tc.gap, sub.Gap)
+			}
+			var got []int
+			for _, e := range sub.Replay {
+				got = append(got, e.Data)
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("expected replay %v, got %v", tc.want, got)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Fatalf("expected replay %v, got %v", tc.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestSlowConsumer(t *testing.T) {
+	hub := NewHub[int](10, 2)
+	slow := hub.Subscribe("", nil)
+	fast := hub.Subscribe("", nil)
+
+	hub.Publish("n", 1)
+	hub.Publish("n", 2)
+	<-fast.C
+	<-fast.C
+	last := hub.Publish("n", 3)
+
+	for range slow.C {
+	}
+	if !errors.Is(slow.Err(), ErrSlowConsumer) {
+		t.Errorf("expected the full subscriber to be dropped, got %v", slow.Err())
+	}
+	if e := <-fast.C; e.ID != last.ID {
+		t.Errorf("expected other subscribers to keep receiving, got %+v", e)
+	}
+
+	resumed := hub.Subscribe("", nil)
+	hub.Close()
+	for range resumed.C {
+	}
+	if !errors.Is(resumed.Err(), ErrClosed) || !errors.Is(fast.Err(), ErrClosed) {
+		t.Errorf("expected Close to end subscriptions, got %v and %v", resumed.Err(), fast.Err())
+	}
+	if sub := hub.Subscribe("", nil); !errors.Is(sub.Err(), ErrClosed) {
+		t.Errorf("expected subscribing to a closed hub to fail, got %v", sub.Err())
+	}
+}
@@ -0,0 +1,113 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit allows Burst requests at once, refilling at Burst per Period.
+type Limit struct {
+	Burst  int
+	Period time.Duration
+}
+
+func (l Limit) rate() float64 {
+	return float64(l.Burst) / l.Period.Seconds()
+}
+
+// Result is the outcome of taking a token from a bucket.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is how long until the next token is available. It is
+	// zero when the request was allowed.
+	RetryAfter time.Duration
+}
+
+// Store keeps token buckets by key. MemoryStore is the only
+// implementation for now; a shared store can be added later so several
+// chirpy instances enforce the same limits.
+type Store interface {
+	Take(key string, limit Limit, now time.Time) (Result, error)
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// MemoryStore is an in-process Store. Buckets that have refilled
+// completely carry no state, so Reap should be called now and then to
+// drop them.
+type MemoryStore struct {
+	buckets map[string]*bucket
+	mu      sync.Mutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: map[string]*bucket{},
+	}
+}
+
+func (s *MemoryStore) Take(key string, limit Limit, now time.Time) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		s.buckets[key] = b
+	}
+
+	elapsed := now.Sub(b.updated).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(float64(limit.Burst), b.tokens+elapsed*limit.rate())
+		b.updated = now
+	}
+
+	res := Result{Limit: limit.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - b.tokens) / limit.rate())
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = seconds((float64(limit.Burst) - b.tokens) / limit.rate())
+
+	return res, nil
+}
+
+// Reap drops buckets that haven't been touched for longer than maxIdle
+// and returns how many it dropped. Buckets idle that long are assumed to
+// have refilled, which holds as long as no Limit has a Period longer
+// than maxIdle.
+func (s *MemoryStore) Reap(now time.Time, maxIdle time.Duration) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reaped := 0
+	for key, b := range s.buckets {
+		if now.Sub(b.updated) > maxIdle {
+			delete(s.buckets, key)
+			reaped++
+		}
+	}
+	return reaped
+}
+
+// Len returns the number of live buckets.
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.buckets)
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
@@ -0,0 +1,54 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTake(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Burst: 3, Period: 3 * time.Second}
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		res, err := store.Take("k", limit, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res.Allowed {
+			t.Fatalf("request %d: expected to be allowed", i)
+		}
+		if res.Remaining != 2-i {
+			t.Errorf("request %d: expected %d remaining, got %d", i, 2-i, res.Remaining)
+		}
+	}
+
+	res, _ := store.Take("k", limit, now)
+	if res.Allowed {
+		t.Fatalf("expected burst to be exhausted")
+	}
+	if res.RetryAfter != time.Second {
+		t.Errorf("expected to retry after 1s, got %s", res.RetryAfter)
+	}
+
+	res, _ = store.Take("other", limit, now)
+	if !res.Allowed {
+		t.Errorf("expected keys to have separate buckets")
+	}
+
+	res, _ = store.Take("k", limit, now.Add(time.Second))
+	if !res.Allowed {
+		t.Errorf("expected a token to have refilled after 1s")
+	}
+}
+
+func TestReap(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Burst: 1, Period: time.Second}
+	now := time.Now()
+
+	store.Take("k", limit, now)
+	if n := store.Reap(now.Add(time.Minute), time.Second); n != 1 || store.Len() != 0 {
+		t.Errorf("expected idle bucket to be reaped")
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/config"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/database"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/idempotency"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/jobs"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/ratelimit"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// jobTick is how often the job runner looks for due jobs, and so how late
+// a job can start.
+const jobTick = time.Second
+
+// registerJobs sets up the maintenance jobs. It must run before the
+// server starts.
+func (cfg *apiConfig) registerJobs(conf config.Config, rateLimits *ratelimit.MemoryStore, idempotencyKeys *idempotency.MemoryStore) error {
+	cfg.jobs = jobs.NewRunner(jobTick, conf.Jobs.HistorySize)
+	for _, j := range []struct {
+		name string
+		spec string
+		fn   jobs.Func
+	}{
+		{"publish_scheduled_chirps", "@every " + conf.Chirps.ScheduleInterval.String(), cfg.jobPublishDrafts},
+		{"purge_refresh_tokens", conf.Jobs.TokenPurge, cfg.jobPurgeRefreshTokens},
+		{"compact_database", conf.Jobs.Compact, cfg.jobCompactDatabase},
+		{"expire_records", conf.Jobs.ExpireRecords, expireRecords(rateLimits, idempotencyKeys)},
+	} {
+		if err := cfg.jobs.Register(j.name, j.spec, tracedJob(j.name, j.fn)); err != nil {
+			return fmt.Errorf("job %s: %w", j.name, err)
+		}
+	}
+	return nil
+}
+
+// tracedJob runs each run of fn in its own trace.
+func tracedJob(name string, fn jobs.Func) jobs.Func {
+	return func(ctx context.Context) (string, error) {
+		ctx, span := tracer.Start(ctx, "job "+name)
+		defer span.End()
+		result, err := fn(ctx)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		return result, err
+	}
+}
+
+func (cfg *apiConfig) jobPublishDrafts(ctx context.Context) (string, error) {
+	published := cfg.publishDueDrafts(ctx, time.Now())
+	return fmt.Sprintf("published %d scheduled chirps", published), nil
+}
+
+func (cfg *apiConfig) jobPurgeRefreshTokens(ctx context.Context) (string, error) {
+	purged, err := cfg.DB.PurgeExpiredRefreshTokens(ctx, time.Now())
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("purged %d expired refresh tokens", purged), nil
+}
+
+func (cfg *apiConfig) jobCompactDatabase(ctx context.Context) (string, error) {
+	stats, err := cfg.DB.Compact(ctx)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("removed %d records, %d bytes to %d", stats.Removed, stats.SizeBefore, stats.SizeAfter), nil
+}
+
+// expireRecords returns a job that drops idle rate limit buckets and
+// expired idempotency keys, which live in memory rather than the
+// database.
+func expireRecords(rateLimits *ratelimit.MemoryStore, idempotencyKeys *idempotency.MemoryStore) jobs.Func {
+	return func(ctx context.Context) (string, error) {
+		now := time.Now()
+		buckets := rateLimits.Reap(now, rateLimitMaxIdle)
+		keys := idempotencyKeys.Reap(now)
+		return fmt.Sprintf("expired %d rate limit buckets and %d idempotency keys", buckets, keys), nil
+	}
+}
+
+// publishDueDrafts publishes the drafts due at now and returns how many
+// were published. Drafts that can never be published as they are, such
+// as replies to a deleted chirp, are unscheduled with the reason so their
+// author can fix them. Ones that might succeed later, such as those of a
+// suspended author, are left for the next run. Drafts live in the
+// database, so ones that came due while chirpy was stopped are published
+// on the first run after it starts.
+func (cfg *apiConfig) publishDueDrafts(ctx context.Context, now time.Time) int {
+	drafts, err := cfg.DB.GetDueDrafts(ctx, now)
+	if err != nil {
+		slog.Error("Couldn't get scheduled chirps", "error", err)
+		return 0
+	}
+
+	published := 0
+	for _, draft := range drafts {
+		if ctx.Err() != nil {
+			break
+		}
+		chirp, err := cfg.publishDraft(ctx, draft)
+		if err == nil {
+			published++
+			slog.Info("Published scheduled chirp", "draft_id", draft.ID, "chirp_id", chirp.ID, "author_id", chirp.AuthorID)
+			continue
+		}
+
+		reason := ""
+		switch {
+		case errors.Is(err, errAccountSuspended), errors.Is(err, errUnknownAuthor),
+			errors.Is(err, database.ErrDraftChanged), errors.Is(err, database.ErrNotExist):
+			continue
+		case errors.Is(err, errChirpTooLong):
+			reason = "The chirp is longer than chirps may now be"
+		case errors.Is(err, errReplyBlocked):
+			reason = "You can't reply to this user"
+		case errors.Is(err, database.ErrReplyNotExist):
+			reason = "The chirp this replies to was deleted"
+		case errors.Is(err, database.ErrInvalidMedia):
+			reason = "An attached media file no longer exists"
+		default:
+			slog.Error("Couldn't publish scheduled chirp", "draft_id", draft.ID, "error", err)
+			continue
+		}
+		slog.Info("Unscheduled chirp that can't be published", "draft_id", draft.ID, "reason", reason)
+		if err := cfg.DB.FailDraft(ctx, draft.ID, reason); err != nil {
+			slog.Error("Couldn't unschedule chirp", "draft_id", draft.ID, "error", err)
+		}
+	}
+	return published
+}
@@ -2,30 +2,222 @@ package main
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
 	"net/http"
+	"reflect"
+	"strings"
 )
 
+// problem is an RFC 7807 problem details object. Code is a stable,
+// machine-readable identifier for clients to branch on; Detail is meant
+// for people and may change.
+type problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Code      string       `json:"code"`
+	Detail    string       `json:"detail,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []fieldError `json:"errors,omitempty"`
+}
+
+// fieldError points at one invalid field of a request body.
+type fieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// problemCodes are the codes used for an error status when the handler
+// doesn't give a more specific one.
+var problemCodes = map[int]string{
+	http.StatusBadRequest:            "bad_request",
+	http.StatusUnauthorized:          "unauthorized",
+	http.StatusForbidden:             "forbidden",
+	http.StatusNotFound:              "not_found",
+	http.StatusConflict:              "conflict",
+	http.StatusRequestEntityTooLarge: "body_too_large",
+	http.StatusUnsupportedMediaType:  "unsupported_media_type",
+	http.StatusUnprocessableEntity:   "validation_failed",
+	http.StatusTooManyRequests:       "rate_limited",
+	http.StatusInternalServerError:   "internal_error",
+	http.StatusServiceUnavailable:    "unavailable",
+}
+
+func problemCode(status int) string {
+	if code, ok := problemCodes[status]; ok {
+		return code
+	}
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
+
 func respondWithError(w http.ResponseWriter, code int, msg string) {
-	if code > 499 {
-		log.Printf("Responding with 5XX error: %s", msg)
+	respondWithProblem(w, problem{Status: code, Detail: msg})
+}
+
+// respondWithErrorCode is respondWithError with a more specific problem
+// code than the status implies.
+func respondWithErrorCode(w http.ResponseWriter, status int, code, msg string) {
+	respondWithProblem(w, problem{Status: status, Code: code, Detail: msg})
+}
+
+// respondWithValidationErrors reports a well-formed request whose field
+// values were rejected.
+func respondWithValidationErrors(w http.ResponseWriter, errs []fieldError) {
+	respondWithProblem(w, problem{
+		Status: http.StatusUnprocessableEntity,
+		Detail: "The request has invalid fields",
+		Errors: errs,
+	})
+}
+
+func respondWithProblem(w http.ResponseWriter, p problem) {
+	if p.Code == "" {
+		p.Code = problemCode(p.Status)
 	}
-	type errorResponse struct {
-		Error string `json:"error"`
+	p.Type = "urn:chirpy:problem:" + p.Code
+	p.Title = http.StatusText(p.Status)
+	// the request ID middleware has already set the response header, so
+	// we can pick the ID up from there without needing the request
+	p.RequestID = w.Header().Get(requestIDHeader)
+	if p.Status > 499 {
+		slog.Error("Responding with 5XX error", "error", p.Detail, "request_id", p.RequestID)
 	}
-	respondWithJSON(w, code, errorResponse{
-		Error: msg,
-	})
+	writeJSON(w, p.Status, "application/problem+json", p)
 }
 
 func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
-	w.Header().Set("Content-Type", "application/json")
+	writeJSON(w, code, "application/json", payload)
+}
+
+func writeJSON(w http.ResponseWriter, code int, contentType string, payload interface{}) {
+	w.Header().Set("Content-Type", contentType)
 	dat, err := json.Marshal(payload)
 	if err != nil {
-		log.Printf("Error marshalling JSON: %s", err)
+		slog.Error("Error marshalling JSON", "error", err)
 		w.WriteHeader(500)
 		return
 	}
 	w.WriteHeader(code)
 	w.Write(dat)
 }
+
+// decodeJSON decodes a request body holding exactly one JSON object into
+// dst, rejecting other content types and unknown fields. The body size is
+// already capped by middlewareMaxBody. On failure it responds with a
+// problem and returns false: 413 if the body is too large, 415 if it
+// isn't JSON, and 400 if it can't be decoded into dst.
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst any) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		respondWithErrorCode(w, http.StatusUnsupportedMediaType, "unsupported_media_type", "Content-Type must be application/json")
+		return false
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(dst)
+	if err == nil && decoder.Decode(&struct{}{}) != io.EOF {
+		err = errTrailingData
+	}
+	if err == nil {
+		return true
+	}
+
+	var (
+		maxBytesErr  *http.MaxBytesError
+		syntaxErr    *json.SyntaxError
+		typeErr      *json.UnmarshalTypeError
+		unknownField string
+	)
+	switch {
+	case errors.As(err, &maxBytesErr):
+		respondWithErrorCode(w, http.StatusRequestEntityTooLarge, "body_too_large", fmt.Sprintf("Request body must be at most %d bytes", maxBytesErr.Limit))
+	case errors.Is(err, io.EOF):
+		respondWithErrorCode(w, http.StatusBadRequest, "empty_body", "Request body is empty")
+	case errors.As(err, &syntaxErr):
+		respondWithErrorCode(w, http.StatusBadRequest, "malformed_json", fmt.Sprintf("Request body is not valid JSON (at byte %d)", syntaxErr.Offset))
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		respondWithErrorCode(w, http.StatusBadRequest, "malformed_json", "Request body is not valid JSON")
+	case errors.Is(err, errTrailingData):
+		respondWithErrorCode(w, http.StatusBadRequest, "malformed_json", "Request body must be a single JSON object")
+	case errors.As(err, &typeErr):
+		field := typeErr.Field
+		if field == "" {
+			respondWithErrorCode(w, http.StatusBadRequest, "malformed_json", "Request body must be a JSON object")
+			return false
+		}
+		respondWithProblem(w, problem{
+			Status: http.StatusBadRequest,
+			Code:   "invalid_type",
+			Detail: "Request body has a field of the wrong type",
+			Errors: []fieldError{{Field: field, Code: "invalid_type", Message: "must be " + jsonTypeName(typeErr.Type)}},
+		})
+	case parseUnknownField(err, &unknownField):
+		respondWithProblem(w, problem{
+			Status: http.StatusBadRequest,
+			Code:   "unknown_field",
+			Detail: "Request body has a field that isn't accepted",
+			Errors: []fieldError{{Field: unknownField, Code: "unknown_field", Message: "is not a known field"}},
+		})
+	default:
+		respondWithErrorCode(w, http.StatusBadRequest, "malformed_json", "Couldn't decode request body")
+	}
+	return false
+}
+
+var errTrailingData = errors.New("trailing data after JSON value")
+
+// parseUnknownField reports whether err is the decoder's unknown field
+// error, which has no type of its own, and extracts the field name.
+func parseUnknownField(err error, field *string) bool {
+	name, ok := strings.CutPrefix(err.Error(), "json: unknown field ")
+	if !ok {
+		return false
+	}
+	*field = strings.Trim(name, `"`)
+	return true
+}
+
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	default:
+		return "an object"
+	}
+}
+
+// validator collects field errors so a client learns about every problem
+// with a request at once.
+type validator struct {
+	errs []fieldError
+}
+
+// add records a field error.
+func (v *validator) add(field, code, message string) {
+	v.errs = append(v.errs, fieldError{Field: field, Code: code, Message: message})
+}
+
+// check records a field error unless ok.
+func (v *validator) check(ok bool, field, code, message string) {
+	if !ok {
+		v.add(field, code, message)
+	}
+}
+
+func (v *validator) valid() bool {
+	return len(v.errs) == 0
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDecodeJSON(t *testing.T) {
+	type parameters struct {
+		Body string `json:"body"`
+		Data struct {
+			UserID int `json:"user_id"`
+		} `json:"data"`
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		code        string
+		field       string
+	}{
+		{"valid", "application/json", `{"body": "hi", "data": {"user_id": 1}}`, http.StatusOK, "", ""},
+		{"charset", "application/json; charset=utf-8", `{"body": "hi"}`, http.StatusOK, "", ""},
+		{"form", "application/x-www-form-urlencoded", `{"body": "hi"}`, http.StatusUnsupportedMediaType, "unsupported_media_type", ""},
+		{"missing content type", "", `{"body": "hi"}`, http.StatusUnsupportedMediaType, "unsupported_media_type", ""},
+		{"empty", "application/json", ``, http.StatusBadRequest, "empty_body", ""},
+		{"syntax", "application/json", `{"body": }`, http.StatusBadRequest, "malformed_json", ""},
+		{"truncated", "application/json", `{"body": "hi"`, http.StatusBadRequest, "malformed_json", ""},
+		{"trailing", "application/json", `{"body": "hi"} {}`, http.StatusBadRequest, "malformed_json", ""},
+		{"not an object", "application/json", `["hi"]`, http.StatusBadRequest, "malformed_json", ""},
+		{"unknown field", "application/json", `{"bdoy": "hi"}`, http.StatusBadRequest, "unknown_field", "bdoy"},
+		{"wrong type", "application/json", `{"data": {"user_id": "1"}}`, http.StatusBadRequest, "invalid_type", "data.user_id"},
+		{"too large", "application/json", `{"body": "` + strings.Repeat("a", 100) + `"}`, http.StatusRequestEntityTooLarge, "body_too_large", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+			r.Body = http.MaxBytesReader(w, r.Body, 64)
+
+			params := parameters{}
+			if decodeJSON(w, r, &params) {
+				if tt.status != http.StatusOK {
+					t.Fatalf("expected %d, decoded %+v", tt.status, params)
+				}
+				return
+			}
+			if w.Code != tt.status {
+				t.Fatalf("expected %d, got %d: %s", tt.status, w.Code, w.Body)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/problem+json" {
+				t.Errorf("expected a problem, got Content-Type %q", ct)
+			}
+
+			var p problem
+			if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+				t.Fatal(err)
+			}
+			if p.Code != tt.code || p.Status != tt.status || p.Type != "urn:chirpy:problem:"+tt.code {
+				t.Errorf("unexpected problem %+v", p)
+			}
+			if tt.field != "" && (len(p.Errors) != 1 || p.Errors[0].Field != tt.field) {
+				t.Errorf("expected an error for %s, got %+v", tt.field, p.Errors)
+			}
+		})
+	}
+}
+
+func TestValidationErrors(t *testing.T) {
+	v := validator{}
+	validateCredentials(&v, "Alice <alice@example.com>", "")
+	if v.valid() || len(v.errs) != 2 {
+		t.Fatalf("expected email and password errors, got %+v", v.errs)
+	}
+
+	w := httptest.NewRecorder()
+	respondWithValidationErrors(w, v.errs)
+	var p problem
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusUnprocessableEntity || p.Code != "validation_failed" || len(p.Errors) != 2 {
+		t.Errorf("unexpected response %d %+v", w.Code, p)
+	}
+}
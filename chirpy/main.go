@@ -1,86 +1,225 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
-
+	"os/signal"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/blobstore"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/certs"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/config"
 	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/database"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/health"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/idempotency"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/jobs"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/pubsub"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/ratelimit"
 	"github.com/joho/godotenv"
 )
 
 type apiConfig struct {
-	fileserverHits int
-	DB             *database.DB
-	jwtSecret      string
-	polkaSecret    string
+	metrics     *serverMetrics
+	DB          *database.DB
+	blobs       blobstore.BlobStore
+	jwtSecret   string
+	polkaSecret string
+	// polkaRequireClientCert makes the Polka webhook accept only
+	// connections with a verified client certificate.
+	polkaRequireClientCert bool
+
+	// settings can change on SIGHUP; see reloadOnHangup.
+	settings atomic.Pointer[settings]
+
+	rateLimits ratelimit.Store
+
+	// chirpEvents is fed by the database and feeds the chirp streams.
+	chirpEvents *pubsub.Hub[database.Chirp]
+
+	// idempotencyKeys holds responses to replay for Idempotency-Key
+	// retries; see middlewareIdempotency.
+	idempotencyKeys idempotency.Store
+
+	// jobs runs the maintenance jobs; see registerJobs.
+	jobs *jobs.Runner
+
+	// liveness and readiness back /livez and /readyz.
+	liveness  *health.Registry
+	readiness *health.Registry
+
+	// draining is set once shutdown starts so readiness checks fail.
+	draining atomic.Bool
 }
 
 func main() {
-	const filepathRoot = "."
-	const port = "8080"
-
 	godotenv.Load(".env")
 
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		log.Fatal("JWT_SECRET environment variable is not set")
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "config" {
+		os.Exit(runConfigCommand(args[1:]))
+	}
+
+	conf, err := config.Load(args, os.Getenv, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := conf.Validate(); err != nil {
+		log.Fatalf("invalid configuration:\n%v", err)
+	}
+
+	logLevel := &slog.LevelVar{}
+	if err := logLevel.UnmarshalText([]byte(conf.Log.Level)); err != nil {
+		log.Fatal(err)
+	}
+	logger, err := newLogger(os.Stderr, conf.Log.Format, logLevel)
+	if err != nil {
+		log.Fatal(err)
+	}
+	slog.SetDefault(logger)
+
+	shutdownTracing, err := setupTracing(context.Background(), conf.Trace.Exporter)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	settings, err := newSettings(conf)
+	if err != nil {
+		log.Fatal(err)
 	}
-	polkaSecret := os.Getenv("POLKA_KEY")
-	if polkaSecret == "" {
-		log.Fatal("POLKA_KEY environment variable is not set")
+
+	db, err := database.NewDB(conf.Database.Path)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	db, err := database.NewDB("database.json")
+	blobs, err := blobstore.NewDiskStore(conf.Server.MediaRoot)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	dbg := flag.Bool("debug", false, "Enable debug mode")
-	flag.Parse()
-	if dbg != nil && *dbg {
-		err := db.ResetDB()
+	if conf.ResetDatabase {
+		slog.Warn("Wiping the database because -debug was passed", "path", conf.Database.Path)
+		err := db.ResetDB(context.Background())
 		if err != nil {
 			log.Fatal(err)
 		}
 	}
 
-	apiCfg := apiConfig{
-		fileserverHits: 0,
-		DB:             db,
-		jwtSecret:      jwtSecret,
-		polkaSecret:    polkaSecret,
+	chirpEvents := pubsub.NewHub[database.Chirp](chirpEventReplaySize, chirpEventQueueSize)
+	db.SetPublisher(func(eventType string, chirp database.Chirp) {
+		chirpEvents.Publish(eventType, chirp)
+	})
+
+	rateLimits := ratelimit.NewMemoryStore()
+	idempotencyKeys := idempotency.NewMemoryStore()
+
+	apiCfg := &apiConfig{
+		metrics:     newServerMetrics(db),
+		DB:          db,
+		blobs:       blobs,
+		jwtSecret:   conf.Auth.JWTSecret,
+		polkaSecret: conf.Auth.PolkaKey,
+
+		polkaRequireClientCert: conf.TLS.PolkaClientCAFile != "",
+
+		chirpEvents:     chirpEvents,
+		rateLimits:      rateLimits,
+		idempotencyKeys: idempotencyKeys,
 	}
+	apiCfg.settings.Store(settings)
+	go apiCfg.reloadOnHangup(args, conf, logLevel)
 
 	mux := http.NewServeMux()
-	fsHandler := apiCfg.middlewareMetricsInc(http.StripPrefix("/app", http.FileServer(http.Dir(filepathRoot))))
-	mux.Handle("/app/*", fsHandler)
+	apiCfg.registerRoutes(mux, conf.Server.FilepathRoot)
+
+	// middleware runs outermost first, so every request is traced and gets
+	// an ID before it is logged, counted or rate limited
+	var handler http.Handler = mux
+	handler = apiCfg.middlewareIdempotency(mux, handler)
+	handler = middlewareCacheControl(handler)
+	handler = middlewareMaxBody(mux, conf.HTTP.MaxBodyBytes, handler)
+	handler = apiCfg.middlewareRateLimit(mux, handler)
+	handler = apiCfg.middlewareMetrics(mux, handler)
+	handler = apiCfg.middlewareAccessLog(mux, handler)
+	handler = middlewareRequestID(handler)
+	handler = middlewareTracing(mux, handler)
+
+	if conf.TLS.Enabled() && conf.TLS.HSTSMaxAge > 0 {
+		handler = middlewareHSTS(conf.TLS.HSTSMaxAge, handler)
+	}
 
-	mux.HandleFunc("GET /api/healthz", handlerReadiness)
-	mux.HandleFunc("GET /api/reset", apiCfg.handlerReset)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	mux.HandleFunc("POST /api/revoke", apiCfg.handlerRevoke)
-	mux.HandleFunc("POST /api/refresh", apiCfg.handlerRefresh)
-	mux.HandleFunc("POST /api/login", apiCfg.handlerLogin)
+	srv := &http.Server{
+		Addr:              ":" + strconv.Itoa(conf.Server.Port),
+		Handler:           handler,
+		ReadTimeout:       conf.HTTP.ReadTimeout,
+		ReadHeaderTimeout: conf.HTTP.ReadHeaderTimeout,
+		WriteTimeout:      conf.HTTP.WriteTimeout,
+		IdleTimeout:       conf.HTTP.IdleTimeout,
+		MaxHeaderBytes:    conf.HTTP.MaxHeaderBytes,
+		ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelWarn),
+	}
+	servers := []*http.Server{srv}
+
+	var tlsCerts *certs.Reloader
+	if conf.TLS.Enabled() {
+		tlsCerts, err = setupTLS(ctx, srv, conf.TLS)
+		if err != nil {
+			log.Fatalf("Couldn't set up TLS: %v", err)
+		}
+		if conf.TLS.RedirectPort != 0 {
+			servers = append(servers, &http.Server{
+				Addr:              ":" + strconv.Itoa(conf.TLS.RedirectPort),
+				Handler:           redirectToHTTPS(conf.Server.Port),
+				ReadHeaderTimeout: conf.HTTP.ReadHeaderTimeout,
+				IdleTimeout:       conf.HTTP.IdleTimeout,
+				ErrorLog:          srv.ErrorLog,
+			})
+		}
+	} else if conf.Server.H2C {
+		srv.Protocols = new(http.Protocols)
+		srv.Protocols.SetHTTP1(true)
+		srv.Protocols.SetUnencryptedHTTP2(true)
+	}
 
-	mux.HandleFunc("POST /api/users", apiCfg.handlerUsersCreate)
-	mux.HandleFunc("PUT /api/users", apiCfg.handlerUsersUpdate)
+	if err := apiCfg.registerJobs(conf, rateLimits, idempotencyKeys); err != nil {
+		log.Fatal(err)
+	}
+	apiCfg.registerHealthChecks(conf, tlsCerts)
 
-	mux.HandleFunc("POST /api/chirps", apiCfg.handlerChirpsCreate)
-	mux.HandleFunc("GET /api/chirps", apiCfg.handlerChirpsRetrieve)
-	mux.HandleFunc("GET /api/chirps/{chirpID}", apiCfg.handlerChirpsGet)
-	mux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCfg.handlerChirpDelete)
+	jobsDone := make(chan struct{})
+	go func() {
+		apiCfg.jobs.Run(ctx)
+		close(jobsDone)
+	}()
 
-	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.handlerPolkaWebhook)
+	slog.Info("Serving files", "root", conf.Server.FilepathRoot, "port", conf.Server.Port, "tls", conf.TLS.Enabled())
+	serveErr := apiCfg.serve(ctx, conf.HTTP, servers...)
 
-	mux.HandleFunc("GET /admin/metrics", apiCfg.handlerMetrics)
+	// let jobs in progress finish before the database is closed
+	stop()
+	<-jobsDone
 
-	srv := &http.Server{
-		Addr:    ":" + port,
-		Handler: mux,
+	if err := db.Close(); err != nil {
+		slog.Error("Couldn't flush database", "error", err)
 	}
-
-	log.Printf("Serving files from %s on port: %s\n", filepathRoot, port)
-	log.Fatal(srv.ListenAndServe())
+	if err := shutdownTracing(context.Background()); err != nil {
+		slog.Error("Couldn't flush traces", "error", err)
+	}
+	if serveErr != nil {
+		log.Fatal(serveErr)
+	}
+	slog.Info("Shutdown complete")
 }
@@ -1,28 +1,202 @@
 package main
 
 import (
-	"fmt"
+	"context"
+	"html/template"
+	"log/slog"
 	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/database"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/metrics"
 )
 
-func (cfg *apiConfig) handlerMetrics(w http.ResponseWriter, r *http.Request) {
-	w.Header().Add("Content-Type", "text/html")
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(fmt.Sprintf(`
+type serverMetrics struct {
+	registry        *metrics.Registry
+	fileserverHits  *metrics.CounterVec
+	requests        *metrics.CounterVec
+	requestDuration *metrics.HistogramVec
+	dbDuration      *metrics.HistogramVec
+}
+
+func newServerMetrics(db *database.DB) *serverMetrics {
+	reg := metrics.NewRegistry()
+	m := &serverMetrics{
+		registry: reg,
+		fileserverHits: reg.NewCounterVec(
+			"chirpy_fileserver_hits_total",
+			"Requests served by the /app file server.",
+		),
+		requests: reg.NewCounterVec(
+			"chirpy_http_requests_total",
+			"HTTP requests by route, method and status code.",
+			"route", "method", "code",
+		),
+		requestDuration: reg.NewHistogramVec(
+			"chirpy_http_request_duration_seconds",
+			"HTTP request latency by route.",
+			metrics.DefaultBuckets,
+			"route",
+		),
+		dbDuration: reg.NewHistogramVec(
+			"chirpy_db_operation_duration_seconds",
+			"Database file operation latency by operation and outcome.",
+			metrics.DefaultBuckets,
+			"op", "outcome",
+		),
+	}
+
+	reg.NewGaugeFunc(
+		"chirpy_active_sessions",
+		"Unexpired refresh tokens.",
+		func() float64 {
+			n, err := db.CountActiveSessions(context.Background())
+			if err != nil {
+				return 0
+			}
+			return float64(n)
+		},
+	)
+
+	db.SetObserver(func(op string, d time.Duration, err error) {
+		outcome := "ok"
+		if err != nil {
+			outcome = "error"
+		}
+		m.dbDuration.Observe(d.Seconds(), op, outcome)
+	})
+
+	return m
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"meanMillis": func(s metrics.Sample) string {
+		if s.Count == 0 {
+			return "0"
+		}
+		return strconv.FormatFloat(s.Sum/float64(s.Count)*1000, 'f', 2, 64)
+	},
+}).Parse(`
 <html>
 
+<head>
+	<title>Chirpy Admin</title>
+	<style>
+		body { font-family: sans-serif; }
+		table { border-collapse: collapse; margin-bottom: 2em; }
+		td, th { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+	</style>
+</head>
+
 <body>
 	<h1>Welcome, Chirpy Admin</h1>
-	<p>Chirpy has been visited %dtimes!</p>
+	<p>Chirpy has been visited {{.Hits}} times!</p>
+	{{range .Families}}
+	<h2>{{.Name}}</h2>
+	<p>{{.Help}}</p>
+	<table>
+		<tr>
+			{{range .LabelNames}}<th>{{.}}</th>{{end}}
+			{{if eq .Type "histogram"}}<th>count</th><th>mean (ms)</th>{{else}}<th>value</th>{{end}}
+		</tr>
+		{{$type := .Type}}
+		{{range .Samples}}
+		<tr>
+			{{range .Labels}}<td>{{.}}</td>{{end}}
+			{{if eq $type "histogram"}}<td>{{.Count}}</td><td>{{meanMillis .}}</td>{{else}}<td>{{.Value}}</td>{{end}}
+		</tr>
+		{{end}}
+	</table>
+	{{end}}
 </body>
 
 </html>
-	`, cfg.fileserverHits)))
+`))
+
+func (cfg *apiConfig) handlerMetrics(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		Hits     uint64
+		Families []metrics.Family
+	}{
+		Hits:     cfg.metrics.fileserverHits.Value(),
+		Families: cfg.metrics.registry.Snapshot(),
+	}
+
+	w.Header().Add("Content-Type", "text/html")
+	w.WriteHeader(http.StatusOK)
+	err := dashboardTemplate.Execute(w, data)
+	if err != nil {
+		slog.Error("Couldn't render admin dashboard", "error", err)
+	}
+}
+
+func (cfg *apiConfig) handlerPrometheus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	err := cfg.metrics.registry.WritePrometheus(w)
+	if err != nil {
+		slog.Error("Couldn't write metrics", "error", err)
+	}
 }
 
 func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		cfg.fileserverHits++
+		cfg.metrics.fileserverHits.Inc()
 		next.ServeHTTP(w, r)
 	})
 }
+
+// middlewareMetrics records the count, status and latency of every
+// request, labelled by the ServeMux pattern it was routed to.
+func (cfg *apiConfig) middlewareMetrics(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, route := mux.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		cfg.metrics.requests.Inc(route, metricsMethod(r.Method), strconv.Itoa(rec.status))
+		cfg.metrics.requestDuration.Observe(time.Since(start).Seconds(), route)
+	})
+}
+
+// metricsMethod bounds the method label, which clients choose freely, so
+// they can't make a new series per request.
+func metricsMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return method
+	default:
+		return "other"
+	}
+}
+
+// statusRecorder remembers the status code written through it.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	if !rec.wroteHeader {
+		rec.status = code
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	return rec.ResponseWriter.Write(b)
+}
+
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
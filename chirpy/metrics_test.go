@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetricsMethodLabel(t *testing.T) {
+	cfg, mux := newTestAPI(t)
+	handler := cfg.middlewareMetrics(mux, mux)
+
+	for _, method := range []string{http.MethodGet, "BREW", "X-ANYTHING"} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, "/api/v1/chirps", nil))
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := w.Body.String()
+	for _, tt := range []struct {
+		label string
+		want  bool
+	}{
+		{`method="GET"`, true},
+		{`method="other"`, true},
+		{`method="BREW"`, false},
+		{`method="X-ANYTHING"`, false},
+	} {
+		if strings.Contains(body, tt.label) != tt.want {
+			t.Errorf("expected %s in the metrics to be %v, got:\n%s", tt.label, tt.want, body)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/idempotency"
+)
+
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+	// idempotencyKeyRetention is how long a response is replayed for.
+	// Clients retrying later than this run the request again.
+	idempotencyKeyRetention = 24 * time.Hour
+	maxIdempotencyKeyLength = 255
+)
+
+// replayedHeaders are the response headers stored with a response. The
+// rest are set afresh by the outer middleware on every request.
+var replayedHeaders = []string{"Content-Type", "Location", "ETag", "Last-Modified"}
+
+// middlewareIdempotency makes POST, PUT, PATCH and DELETE requests that
+// carry an Idempotency-Key safe to retry. The first response for a user
+// and key is kept for idempotencyKeyRetention and replayed, marked with
+// Idempotent-Replayed, to retries with the same request; reusing the key
+// for a different request is a 422. A retry that arrives while the first
+// request is still running waits for it rather than running twice.
+// Server errors aren't kept, so the retry gets another go.
+//
+// Keys are scoped to the authenticated user, so unauthenticated requests
+// ignore the header. Routes in routeBodyLimits are skipped too: their
+// bodies are streamed, not buffered, so they can't be fingerprinted.
+func (cfg *apiConfig) middlewareIdempotency(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" || !isMutatingMethod(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		_, pattern := mux.Handler(r)
+		pattern = apiV1Pattern(pattern)
+		if _, ok := routeBodyLimits[pattern]; ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		userID, err := cfg.userIDFromRequest(r)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !validIdempotencyKey(key) {
+			respondWithErrorCode(w, http.StatusBadRequest, "invalid_idempotency_key",
+				fmt.Sprintf("%s must be 1 to %d printable ASCII characters", idempotencyKeyHeader, maxIdempotencyKeyLength))
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				respondWithErrorCode(w, http.StatusRequestEntityTooLarge, "body_too_large", fmt.Sprintf("Request body must be at most %d bytes", maxBytesErr.Limit))
+				return
+			}
+			respondWithError(w, http.StatusBadRequest, "Couldn't read request body")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		storeKey := "user:" + strconv.Itoa(userID) + "|" + key
+		stored, err := cfg.idempotencyKeys.Begin(r.Context(), storeKey, requestFingerprint(r, body), time.Now())
+		switch {
+		case errors.Is(err, idempotency.ErrKeyReused):
+			respondWithErrorCode(w, http.StatusUnprocessableEntity, "idempotency_key_reused",
+				idempotencyKeyHeader+" was already used for a different request")
+			return
+		case err != nil:
+			// the client gave up waiting for the original request
+			slog.Debug("Stopped waiting for idempotent request", "error", err)
+			return
+		case stored != nil:
+			for name, values := range stored.Header {
+				w.Header()[name] = values
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(stored.Status)
+			w.Write(stored.Body)
+			return
+		}
+
+		rec := &responseCapture{ResponseWriter: w, status: http.StatusOK}
+		completed := false
+		// abort if the handler panics, so waiting retries aren't stuck
+		defer func() {
+			if !completed {
+				cfg.idempotencyKeys.Abort(storeKey)
+			}
+		}()
+		next.ServeHTTP(rec, r)
+
+		if rec.status >= 500 {
+			return
+		}
+		header := http.Header{}
+		for _, name := range replayedHeaders {
+			if values := w.Header().Values(name); len(values) > 0 {
+				header[name] = values
+			}
+		}
+		cfg.idempotencyKeys.Complete(storeKey, idempotency.Response{
+			Status: rec.status,
+			Header: header,
+			Body:   rec.body.Bytes(),
+		}, time.Now().Add(idempotencyKeyRetention))
+		completed = true
+	})
+}
+
+func isMutatingMethod(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func validIdempotencyKey(key string) bool {
+	if len(key) > maxIdempotencyKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x20 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// requestFingerprint identifies what a request asks for, so a key can't
+// be replayed for a different one. Deprecated /api aliases fingerprint
+// the same as their /api/v1 route.
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	fmt.Fprintln(h, apiV1Pattern(r.Method+" "+r.URL.Path))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// responseCapture passes a response through while keeping a copy of its
+// status and body.
+type responseCapture struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (rec *responseCapture) WriteHeader(code int) {
+	if !rec.wroteHeader {
+		rec.status = code
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *responseCapture) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+func (rec *responseCapture) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
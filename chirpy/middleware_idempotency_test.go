@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/auth"
+)
+
+func TestIdempotencyKeys(t *testing.T) {
+	cfg, mux := newTestAPI(t)
+	handler := cfg.middlewareIdempotency(mux, mux)
+	ctx := context.Background()
+	user, err := cfg.DB.CreateUser(ctx, "alice@example.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := auth.MakeJWT(user.ID, cfg.jwtSecret, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	post := func(path, key, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("Authorization", "Bearer "+token)
+		if key != "" {
+			r.Header.Set(idempotencyKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	chirpCount := func() int {
+		chirps, err := cfg.DB.GetChirps(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(chirps)
+	}
+
+	first := post("/api/v1/chirps", "k1", `{"body":"hello"}`)
+	if first.Code != http.StatusCreated || first.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("expected the first request to run, got %d %v", first.Code, first.Header())
+	}
+
+	for _, path := range []string{"/api/v1/chirps", "/api/chirps"} {
+		w := post(path, "k1", `{"body":"hello"}`)
+		if w.Code != first.Code || w.Body.String() != first.Body.String() || w.Header().Get("Idempotent-Replayed") != "true" {
+			t.Errorf("%s: expected a replay, got %d %s", path, w.Code, w.Body)
+		}
+		if w.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("%s: expected the Content-Type to be replayed", path)
+		}
+	}
+	if n := chirpCount(); n != 1 {
+		t.Errorf("expected retries not to create chirps, have %d", n)
+	}
+
+	if w := post("/api/v1/chirps", "k1", `{"body":"goodbye"}`); w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), "idempotency_key_reused") {
+		t.Errorf("expected 422 for a reused key, got %d %s", w.Code, w.Body)
+	}
+	if w := post("/api/v1/chirps", strings.Repeat("k", maxIdempotencyKeyLength+1), `{"body":"hello"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an overlong key, got %d", w.Code)
+	}
+
+	// the validation error is a response like any other, so it is kept
+	tooLong := `{"body":"` + strings.Repeat("x", 141) + `"}`
+	invalid := post("/api/v1/chirps", "k2", tooLong)
+	if w := post("/api/v1/chirps", "k2", tooLong); invalid.Code != http.StatusUnprocessableEntity || w.Code != invalid.Code || w.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("expected 4xx responses to be replayed, got %d", w.Code)
+	}
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if w := post("/api/v1/chirps", "k3", `{"body":"once"}`); w.Code != http.StatusCreated {
+				t.Errorf("expected concurrent duplicates to get 201, got %d", w.Code)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := chirpCount(); n != 2 {
+		t.Errorf("expected concurrent duplicates to create one chirp, have %d chirps", n)
+	}
+
+	post("/api/v1/chirps", "", `{"body":"no key"}`)
+	post("/api/v1/chirps", "", `{"body":"no key"}`)
+	if n := chirpCount(); n != 4 {
+		t.Errorf("expected requests without a key to run every time, have %d chirps", n)
+	}
+}
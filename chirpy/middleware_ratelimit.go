@@ -0,0 +1,135 @@
+package main
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/ratelimit"
+)
+
+// rateLimitMaxIdle is how long a bucket goes untouched before the
+// expire_records job drops it. It must be at least the longest Period
+// below.
+const rateLimitMaxIdle = time.Hour
+
+// defaultRateLimit applies to every route without an entry in
+// routeRateLimits.
+var defaultRateLimit = ratelimit.Limit{Burst: 120, Period: time.Minute}
+
+// routeRateLimits holds the per-route limits, keyed by the ServeMux
+// pattern the route is registered under. Deprecated /api aliases share
+// the limit and bucket of their /api/v1 route.
+var routeRateLimits = map[string]ratelimit.Limit{
+	"POST /api/v1/login":                    {Burst: 5, Period: time.Minute},
+	"POST /api/v1/users":                    {Burst: 5, Period: time.Hour},
+	"POST /api/v1/refresh":                  {Burst: 30, Period: time.Minute},
+	"POST /api/v1/chirps":                   {Burst: 30, Period: time.Minute},
+	"POST /api/v1/media":                    {Burst: 10, Period: time.Minute},
+	"POST /api/v1/chirps/{chirpID}/reports": {Burst: 10, Period: time.Hour},
+}
+
+// middlewareRateLimit enforces per-route token bucket limits. Requests
+// are keyed by the authenticated user if there is a valid access token,
+// otherwise by client IP. mux is used to find the pattern the request
+// will be routed to.
+func (cfg *apiConfig) middlewareRateLimit(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := mux.Handler(r)
+		pattern = apiV1Pattern(pattern)
+		limit, ok := routeRateLimits[pattern]
+		if !ok {
+			limit = defaultRateLimit
+		}
+
+		key := "ip:" + clientIP(r, cfg.settings.Load().trustedProxies)
+		if userID, err := cfg.userIDFromRequest(r); err == nil {
+			key = "user:" + strconv.Itoa(userID)
+		}
+
+		res, err := cfg.rateLimits.Take(pattern+"|"+key, limit, time.Now())
+		if err != nil {
+			// fail open, an unavailable limiter shouldn't take the API down
+			slog.Error("Couldn't check rate limit", "error", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+		if !res.Allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+			respondWithError(w, http.StatusTooManyRequests, "Rate limit exceeded")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientIP returns the address of the client that made the request. The
+// X-Forwarded-For header is only trusted when the connection comes from a
+// trusted proxy, and then only up to the first hop that isn't trusted.
+func clientIP(r *http.Request, trustedProxies []*net.IPNet) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !isTrustedProxy(host, trustedProxies) {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		if !isTrustedProxy(hop, trustedProxies) {
+			return hop
+		}
+		host = hop
+	}
+	return host
+}
+
+func isTrustedProxy(addr string, trustedProxies []*net.IPNet) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTrustedProxies parses a list of IPs and CIDRs.
+func parseTrustedProxies(entries []string) ([]*net.IPNet, error) {
+	var proxies []*net.IPNet
+	for _, entry := range entries {
+		if !strings.Contains(entry, "/") {
+			if strings.Contains(entry, ":") {
+				entry += "/128"
+			} else {
+				entry += "/32"
+			}
+		}
+		_, n, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, err
+		}
+		proxies = append(proxies, n)
+	}
+	return proxies, nil
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
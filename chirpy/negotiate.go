@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	mediaTypeJSON     = "application/json"
+	mediaTypeNDJSON   = "application/x-ndjson"
+	mediaTypeMsgpack  = "application/msgpack"
+	mediaTypeXMsgpack = "application/x-msgpack"
+)
+
+// ndjsonFlushEvery is how many lines of an NDJSON stream are written
+// between flushes, so clients can start on a long list before it's done.
+const ndjsonFlushEvery = 100
+
+// negotiate returns the offer the request's Accept header prefers, with
+// ties going to the earlier offer. A request without an Accept header
+// gets the first offer. It reports false if no offer is acceptable.
+func negotiate(r *http.Request, offers ...string) (string, bool) {
+	header := r.Header.Get("Accept")
+	if header == "" {
+		return offers[0], true
+	}
+	ranges := parseAccept(header)
+
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		if q := acceptQuality(ranges, offer); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best, bestQ > 0
+}
+
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+func parseAccept(header string) []acceptRange {
+	var ranges []acceptRange
+	for _, part := range strings.Split(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if s, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(s, 64)
+			if err != nil || q < 0 || q > 1 {
+				continue
+			}
+		}
+		ranges = append(ranges, acceptRange{mediaType: mediaType, q: q})
+	}
+	return ranges
+}
+
+// acceptQuality returns the q value of the most specific range matching
+// mediaType, or 0 if none match.
+func acceptQuality(ranges []acceptRange, mediaType string) float64 {
+	typ, _, _ := strings.Cut(mediaType, "/")
+	q, specificity := 0.0, 0
+	for _, ar := range ranges {
+		s := 0
+		switch ar.mediaType {
+		case mediaType:
+			s = 3
+		case typ + "/*":
+			s = 2
+		case "*/*":
+			s = 1
+		}
+		if s > specificity {
+			q, specificity = ar.q, s
+		}
+	}
+	return q
+}
+
+// respondNegotiated writes payload as JSON or MessagePack, whichever the
+// client prefers.
+func respondNegotiated(w http.ResponseWriter, r *http.Request, code int, payload any) {
+	w.Header().Add("Vary", "Accept")
+	mediaType, ok := negotiate(r, mediaTypeJSON, mediaTypeMsgpack, mediaTypeXMsgpack)
+	if !ok {
+		respondNotAcceptable(w, mediaTypeJSON, mediaTypeMsgpack)
+		return
+	}
+	if mediaType == mediaTypeJSON {
+		respondWithJSON(w, code, payload)
+		return
+	}
+	respondWithMsgpack(w, code, mediaType, payload)
+}
+
+// respondWithList is respondNegotiated for lists, which may also be
+// streamed as NDJSON, one item per line.
+func respondWithList[T any](w http.ResponseWriter, r *http.Request, code int, items []T) {
+	w.Header().Add("Vary", "Accept")
+	mediaType, ok := negotiate(r, mediaTypeJSON, mediaTypeNDJSON, mediaTypeMsgpack, mediaTypeXMsgpack)
+	switch {
+	case !ok:
+		respondNotAcceptable(w, mediaTypeJSON, mediaTypeNDJSON, mediaTypeMsgpack)
+	case mediaType == mediaTypeJSON:
+		respondWithJSON(w, code, items)
+	case mediaType == mediaTypeNDJSON:
+		streamNDJSON(w, code, items)
+	default:
+		respondWithMsgpack(w, code, mediaType, items)
+	}
+}
+
+func respondNotAcceptable(w http.ResponseWriter, offers ...string) {
+	respondWithError(w, http.StatusNotAcceptable, "Acceptable media types are "+strings.Join(offers, ", "))
+}
+
+func respondWithMsgpack(w http.ResponseWriter, code int, contentType string, payload any) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	// reuse the JSON field names so every format has the same shape
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(payload); err != nil {
+		slog.Error("Error marshalling MessagePack", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(code)
+	w.Write(buf.Bytes())
+}
+
+func streamNDJSON[T any](w http.ResponseWriter, code int, items []T) {
+	w.Header().Set("Content-Type", mediaTypeNDJSON)
+	w.WriteHeader(code)
+
+	enc := json.NewEncoder(w)
+	rc := http.NewResponseController(w)
+	for i, item := range items {
+		if err := enc.Encode(item); err != nil {
+			// the status has been sent, all we can do is stop
+			slog.Warn("Couldn't stream NDJSON", "error", err)
+			return
+		}
+		if (i+1)%ndjsonFlushEvery == 0 {
+			rc.Flush()
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestNegotiate(t *testing.T) {
+	offers := []string{mediaTypeJSON, mediaTypeNDJSON, mediaTypeMsgpack}
+	tests := []struct {
+		accept string
+		want   string
+		ok     bool
+	}{
+		{"", mediaTypeJSON, true},
+		{"*/*", mediaTypeJSON, true},
+		{"application/*", mediaTypeJSON, true},
+		{"application/x-ndjson", mediaTypeNDJSON, true},
+		{"application/json;q=0.5, application/msgpack", mediaTypeMsgpack, true},
+		{"application/msgpack;q=0.9, */*;q=0.1", mediaTypeMsgpack, true},
+		{"application/*;q=0.5, application/x-ndjson;q=0", mediaTypeJSON, true},
+		{"text/html", "", false},
+		{"application/json;q=0", "", false},
+		{"application/json;q=2", "", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept", tt.accept)
+		got, ok := negotiate(r, offers...)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Accept %q: got %q %v, want %q %v", tt.accept, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestRespondWithList(t *testing.T) {
+	items := make([]Hashtag, 250)
+	for i := range items {
+		items[i] = Hashtag{Tag: "go", Start: i, End: i + 3}
+	}
+	respond := func(accept string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept", accept)
+		respondWithList(w, r, http.StatusOK, items)
+		if w.Header().Get("Vary") != "Accept" {
+			t.Errorf("Accept %q: expected Vary: Accept", accept)
+		}
+		return w
+	}
+
+	w := respond(mediaTypeNDJSON)
+	if w.Header().Get("Content-Type") != mediaTypeNDJSON || !w.Flushed {
+		t.Errorf("expected a flushed NDJSON stream, got %q", w.Header().Get("Content-Type"))
+	}
+	lines := 0
+	for scanner := bufio.NewScanner(w.Body); scanner.Scan(); lines++ {
+	}
+	if lines != len(items) {
+		t.Errorf("expected %d lines, got %d", len(items), lines)
+	}
+
+	w = respond(mediaTypeXMsgpack)
+	if w.Header().Get("Content-Type") != mediaTypeXMsgpack {
+		t.Errorf("unexpected Content-Type %q", w.Header().Get("Content-Type"))
+	}
+	var decoded []map[string]any
+	if err := msgpack.Unmarshal(w.Body.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != len(items) || decoded[1]["tag"] != "go" {
+		t.Errorf("expected JSON field names in MessagePack, got %v", decoded[1])
+	}
+
+	if w := respond("text/csv"); w.Code != http.StatusNotAcceptable {
+		t.Errorf("expected 406, got %d", w.Code)
+	}
+}
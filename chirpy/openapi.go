@@ -0,0 +1,19 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openAPISpec describes every route in registerRoutes. It is written by
+// hand; TestOpenAPIRoutes and TestOpenAPIContract catch drift.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+func handlerOpenAPI(w http.ResponseWriter, r *http.Request) {
+	setCacheControl(w, r)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(openAPISpec)
+}
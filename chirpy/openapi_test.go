@@ -0,0 +1,580 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/client"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/blobstore"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/config"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/database"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/idempotency"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/pubsub"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/ratelimit"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// newTestAPI returns chirpy's routes backed by a fresh database in a
+// temporary directory.
+func newTestAPI(t *testing.T) (*apiConfig, *http.ServeMux) {
+	t.Helper()
+	dir := t.TempDir()
+
+	conf := config.Default()
+	conf.Auth.JWTSecret = "test-secret"
+	conf.Auth.PolkaKey = "test-polka-key"
+	conf.Database.Path = filepath.Join(dir, "database.json")
+	conf.Server.MediaRoot = filepath.Join(dir, "media")
+	conf.Health.MinFreeBytes = 0
+
+	db, err := database.NewDB(conf.Database.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobs, err := blobstore.NewDiskStore(conf.Server.MediaRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings, err := newSettings(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chirpEvents := pubsub.NewHub[database.Chirp](chirpEventReplaySize, chirpEventQueueSize)
+	db.SetPublisher(func(eventType string, chirp database.Chirp) {
+		chirpEvents.Publish(eventType, chirp)
+	})
+	rateLimits := ratelimit.NewMemoryStore()
+	idempotencyKeys := idempotency.NewMemoryStore()
+
+	cfg := &apiConfig{
+		metrics:         newServerMetrics(db),
+		DB:              db,
+		blobs:           blobs,
+		jwtSecret:       conf.Auth.JWTSecret,
+		polkaSecret:     conf.Auth.PolkaKey,
+		chirpEvents:     chirpEvents,
+		rateLimits:      rateLimits,
+		idempotencyKeys: idempotencyKeys,
+	}
+	cfg.settings.Store(settings)
+	if err := cfg.registerJobs(conf, rateLimits, idempotencyKeys); err != nil {
+		t.Fatal(err)
+	}
+	cfg.registerHealthChecks(conf, nil)
+
+	mux := http.NewServeMux()
+	cfg.registerRoutes(mux, dir)
+	return cfg, mux
+}
+
+type openAPIDoc struct {
+	Paths      map[string]map[string]openAPIOperation `json:"paths"`
+	Components struct {
+		Schemas map[string]map[string]any `json:"schemas"`
+	} `json:"components"`
+}
+
+type openAPIOperation struct {
+	RequestBody *struct {
+		Content map[string]struct {
+			Schema map[string]any `json:"schema"`
+		} `json:"content"`
+	} `json:"requestBody"`
+	Responses map[string]struct {
+		Content map[string]struct {
+			Schema map[string]any `json:"schema"`
+		} `json:"content"`
+	} `json:"responses"`
+}
+
+func loadOpenAPI(t *testing.T) openAPIDoc {
+	t.Helper()
+	var doc openAPIDoc
+	if err := json.Unmarshal(openAPISpec, &doc); err != nil {
+		t.Fatalf("openapi.json is not valid JSON: %v", err)
+	}
+	return doc
+}
+
+type recordingRouter []string
+
+func (r *recordingRouter) Handle(pattern string, _ http.Handler) {
+	*r = append(*r, pattern)
+}
+
+func (r *recordingRouter) HandleFunc(pattern string, _ func(http.ResponseWriter, *http.Request)) {
+	*r = append(*r, pattern)
+}
+
+// undocumentedRoutes are registered but deliberately not in the spec.
+var undocumentedRoutes = map[string]bool{
+	"/app/*": true, // static files
+}
+
+func TestOpenAPIRoutes(t *testing.T) {
+	doc := loadOpenAPI(t)
+	cfg := &apiConfig{}
+	var routes recordingRouter
+	cfg.registerRoutes(&routes, ".")
+
+	registered := map[string]bool{}
+	var aliases []string
+	for _, pattern := range routes {
+		if undocumentedRoutes[pattern] {
+			continue
+		}
+		// deprecated aliases are described once in the spec's description
+		if apiV1Pattern(pattern) != pattern {
+			aliases = append(aliases, pattern)
+			continue
+		}
+		registered[pattern] = true
+		method, path, _ := strings.Cut(pattern, " ")
+		if _, ok := doc.Paths[path][strings.ToLower(method)]; !ok {
+			t.Errorf("route %q is registered but not in openapi.json", pattern)
+		}
+	}
+	for path, ops := range doc.Paths {
+		for method := range ops {
+			pattern := strings.ToUpper(method) + " " + path
+			if !registered[pattern] {
+				t.Errorf("openapi.json documents %q but no such route is registered", pattern)
+			}
+		}
+	}
+	for _, alias := range aliases {
+		if !registered[apiV1Pattern(alias)] {
+			t.Errorf("alias %q has no %s route", alias, apiV1Prefix)
+		}
+	}
+}
+
+func TestOpenAPISchemas(t *testing.T) {
+	doc := loadOpenAPI(t)
+	for name, v := range map[string]any{
+		"Chirp":             Chirp{},
+		"Media":             Media{},
+		"Mention":           Mention{},
+		"Hashtag":           Hashtag{},
+		"ChirpRevision":     ChirpRevision{},
+		"ChirpEvent":        ChirpEvent{},
+		"Draft":             Draft{},
+		"Profile":           Profile{},
+		"User":              User{},
+		"Relation":          Relation{},
+		"Notification":      Notification{},
+		"Report":            database.Report{},
+		"ModerationAction":  database.ModerationAction{},
+		"Appeal":            database.Appeal{},
+		"Job":               Job{},
+		"JobRun":            JobRun{},
+		"AuditEntry":        database.AuditEntry{},
+		"AuditVerification": AuditVerification{},
+		"Problem":           problem{},
+		"FieldError":        fieldError{},
+
+		"client.User":               client.User{},
+		"client.LoginResponse":      client.LoginResponse{},
+		"client.Profile":            client.Profile{},
+		"client.ProfileUpdate":      client.ProfileUpdate{},
+		"client.Chirp":              client.Chirp{},
+		"client.Media":              client.Media{},
+		"client.Mention":            client.Mention{},
+		"client.Hashtag":            client.Hashtag{},
+		"client.ChirpRevision":      client.ChirpRevision{},
+		"client.CreateChirpRequest": client.CreateChirpRequest{},
+		"client.Problem":            client.Error{},
+		"client.FieldError":         client.FieldError{},
+	} {
+		schema, ok := doc.Components.Schemas[strings.TrimPrefix(name, "client.")]
+		if !ok {
+			t.Errorf("%s: no schema in openapi.json", name)
+			continue
+		}
+		fields := jsonFields(reflect.TypeOf(v))
+		properties, _ := schema["properties"].(map[string]any)
+		var required []string
+		for _, r := range schema["required"].([]any) {
+			required = append(required, r.(string))
+		}
+
+		for field, optional := range fields {
+			if _, ok := properties[field]; !ok {
+				t.Errorf("%s.%s is not in the schema", name, field)
+				continue
+			}
+			// request types may omit fields the server treats as optional
+			isRequest := strings.HasSuffix(name, "Request") || strings.HasSuffix(name, "Update")
+			if !isRequest && optional == slices.Contains(required, field) {
+				t.Errorf("%s.%s: omitempty is %v but required is %v", name, field, optional, !optional)
+			}
+		}
+		for property := range properties {
+			if _, ok := fields[property]; !ok {
+				t.Errorf("%s has no field for schema property %q", name, property)
+			}
+		}
+	}
+}
+
+// jsonFields lists the JSON keys of a struct, including embedded ones,
+// and whether each has omitempty.
+func jsonFields(typ reflect.Type) map[string]bool {
+	fields := map[string]bool{}
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		tag := f.Tag.Get("json")
+		if f.Anonymous && tag == "" {
+			for k, v := range jsonFields(f.Type) {
+				fields[k] = v
+			}
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "-" || !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = strings.Contains(opts, "omitempty")
+	}
+	return fields
+}
+
+// contractTransport checks every JSON request and response against the
+// operation openapi.json documents for it.
+type contractTransport struct {
+	t   *testing.T
+	doc openAPIDoc
+	mux *http.ServeMux
+}
+
+func (ct contractTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	_, pattern := ct.mux.Handler(req)
+	method, path, _ := strings.Cut(pattern, " ")
+	op, ok := ct.doc.Paths[path][strings.ToLower(method)]
+	if !ok {
+		ct.t.Errorf("%s %s: no operation in openapi.json", req.Method, req.URL.Path)
+		return http.DefaultTransport.RoundTrip(req)
+	}
+
+	if req.Body != nil && op.RequestBody != nil {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		if content, ok := op.RequestBody.Content["application/json"]; ok {
+			ct.check(pattern+" request", content.Schema, body)
+		}
+	}
+
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	documented, ok := op.Responses[strconv.Itoa(resp.StatusCode)]
+	if !ok {
+		if resp.StatusCode < 400 {
+			ct.t.Errorf("%s: status %d is not documented", pattern, resp.StatusCode)
+			return resp, nil
+		}
+		documented = op.Responses["default"]
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	content, ok := documented.Content[mediaType]
+	if !ok && len(documented.Content) > 0 {
+		ct.t.Errorf("%s: %d response content type %q is not documented", pattern, resp.StatusCode, mediaType)
+		return resp, nil
+	}
+	what := fmt.Sprintf("%s %d response", pattern, resp.StatusCode)
+	switch {
+	case mediaType == mediaTypeNDJSON:
+		for _, line := range bytes.SplitAfter(body, []byte("\n")) {
+			if len(line) > 0 {
+				ct.check(what, content.Schema, line)
+			}
+		}
+	case mediaType == mediaTypeMsgpack:
+		// validate the JSON equivalent, msgpack decodes to the same shapes
+		var value any
+		if err := msgpack.Unmarshal(body, &value); err != nil {
+			ct.t.Errorf("%s: not MessagePack: %v", what, err)
+			return resp, nil
+		}
+		equivalent, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		ct.check(what, content.Schema, equivalent)
+	case strings.HasSuffix(mediaType, "json"):
+		ct.check(what, content.Schema, body)
+	}
+	return resp, nil
+}
+
+func (ct contractTransport) check(what string, schema map[string]any, body []byte) {
+	var value any
+	if err := json.Unmarshal(body, &value); err != nil {
+		ct.t.Errorf("%s: not JSON: %v", what, err)
+		return
+	}
+	for _, problem := range validateSchema(ct.doc, schema, value, "$") {
+		ct.t.Errorf("%s: %s", what, problem)
+	}
+}
+
+// validateSchema checks value against the subset of OpenAPI 3.0 schemas
+// openapi.json uses.
+func validateSchema(doc openAPIDoc, schema map[string]any, value any, at string) []string {
+	if ref, ok := schema["$ref"].(string); ok {
+		return validateSchema(doc, doc.Components.Schemas[strings.TrimPrefix(ref, "#/components/schemas/")], value, at)
+	}
+	if value == nil {
+		if schema["nullable"] == true {
+			return nil
+		}
+		return []string{at + ": is null"}
+	}
+
+	var problems []string
+	switch schema["type"] {
+	case "object":
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected an object, got %T", at, value)}
+		}
+		properties, _ := schema["properties"].(map[string]any)
+		required, _ := schema["required"].([]any)
+		for _, r := range required {
+			if _, ok := obj[r.(string)]; !ok {
+				problems = append(problems, fmt.Sprintf("%s: missing required %q", at, r))
+			}
+		}
+		for k, v := range obj {
+			propSchema, ok := properties[k].(map[string]any)
+			if !ok {
+				if schema["additionalProperties"] == false {
+					problems = append(problems, fmt.Sprintf("%s: unexpected property %q", at, k))
+				}
+				continue
+			}
+			problems = append(problems, validateSchema(doc, propSchema, v, at+"."+k)...)
+		}
+	case "array":
+		arr, ok := value.([]any)
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected an array, got %T", at, value)}
+		}
+		items := schema["items"].(map[string]any)
+		for i, v := range arr {
+			problems = append(problems, validateSchema(doc, items, v, fmt.Sprintf("%s[%d]", at, i))...)
+		}
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected a string, got %T", at, value)}
+		}
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, s); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %q is not a date-time", at, s))
+			}
+		}
+		if enum, ok := schema["enum"].([]any); ok && !slices.Contains(enum, any(s)) {
+			problems = append(problems, fmt.Sprintf("%s: %q is not one of %v", at, s, enum))
+		}
+	case "integer":
+		n, ok := value.(float64)
+		if !ok || n != math.Trunc(n) {
+			return []string{fmt.Sprintf("%s: expected an integer, got %v", at, value)}
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return []string{fmt.Sprintf("%s: expected a boolean, got %T", at, value)}
+		}
+	}
+	return problems
+}
+
+// TestOpenAPIContract drives the API through the client package and
+// checks every request and response against openapi.json.
+func TestOpenAPIContract(t *testing.T) {
+	cfg, mux := newTestAPI(t)
+	srv := httptest.NewServer(cfg.middlewareIdempotency(mux, mux))
+	defer srv.Close()
+
+	httpClient := &http.Client{Transport: contractTransport{t: t, doc: loadOpenAPI(t), mux: mux}}
+	c := client.New(srv.URL, client.WithHTTPClient(httpClient))
+	ctx := context.Background()
+
+	alice, err := c.CreateUser(ctx, "alice@example.com", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CreateUser(ctx, "bob@example.com", "password"); err != nil {
+		t.Fatal(err)
+	}
+	var apiErr *client.Error
+	if _, err := c.Login(ctx, "alice@example.com", "wrong"); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized || apiErr.Code != "invalid_credentials" {
+		t.Errorf("expected a 401 for a bad password, got %v", err)
+	}
+	if _, err := c.CreateUser(ctx, "not an email", ""); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnprocessableEntity || len(apiErr.Errors) != 2 {
+		t.Errorf("expected a 422 naming both fields, got %v", err)
+	}
+
+	session, err := c.Login(ctx, "alice@example.com", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.ID != alice.ID || session.Token == "" || session.RefreshToken == "" {
+		t.Fatalf("unexpected login response %+v", session)
+	}
+	token, err := c.Refresh(ctx, session.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authed := c.WithToken(token)
+
+	handle := "alice"
+	if _, err := authed.UpdateProfile(ctx, client.ProfileUpdate{Handle: &handle}); err != nil {
+		t.Fatal(err)
+	}
+	profile, err := c.GetProfile(ctx, "alice")
+	if err != nil || profile.ID != alice.ID {
+		t.Fatalf("unexpected profile %+v %v", profile, err)
+	}
+
+	chirp, err := authed.CreateChirp(ctx, client.CreateChirpRequest{Body: "hello @bob #Go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply, err := authed.CreateChirp(ctx, client.CreateChirpRequest{Body: "again", InReplyTo: chirp.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyed := authed.WithIdempotencyKey("retry-1")
+	first, err := keyed.CreateChirp(ctx, client.CreateChirpRequest{Body: "once"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retried, err := keyed.CreateChirp(ctx, client.CreateChirpRequest{Body: "once"}); err != nil || retried.ID != first.ID {
+		t.Errorf("expected a retry to return chirp %d, got %+v %v", first.ID, retried, err)
+	}
+	if _, err := keyed.CreateChirp(ctx, client.CreateChirpRequest{Body: "twice"}); !errors.As(err, &apiErr) || apiErr.Code != "idempotency_key_reused" {
+		t.Errorf("expected a reused key to be rejected, got %v", err)
+	}
+	if err := authed.DeleteChirp(ctx, first.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := authed.UpdateChirp(ctx, chirp.ID, "hello @bob #Go, edited"); err != nil {
+		t.Fatal(err)
+	}
+	if revisions, err := c.ChirpRevisions(ctx, chirp.ID); err != nil || len(revisions) != 1 {
+		t.Errorf("expected one revision, got %v %v", revisions, err)
+	}
+	got, err := c.GetChirp(ctx, chirp.ID)
+	if err != nil || got.Revision != 2 || len(got.Hashtags) != 1 {
+		t.Errorf("unexpected chirp %+v %v", got, err)
+	}
+	chirps, err := c.ListChirps(ctx, client.ListChirpsOptions{AuthorID: alice.ID, Sort: "desc"})
+	if err != nil || len(chirps) != 2 || chirps[0].ID != reply.ID {
+		t.Errorf("unexpected chirps %+v %v", chirps, err)
+	}
+	if _, err := c.UserChirps(ctx, "alice"); err != nil {
+		t.Error(err)
+	}
+	if err := authed.DeleteChirp(ctx, reply.ID); err != nil {
+		t.Error(err)
+	}
+	if _, err := c.GetChirp(ctx, reply.ID); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected a 404 for a deleted chirp, got %v", err)
+	}
+
+	for _, path := range []string{"/api/v1/hashtags/trending", "/api/v1/hashtags/go"} {
+		resp, err := httpClient.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/api/v1/chirps/"+strconv.Itoa(chirp.ID), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	req.Header.Set("If-None-Match", resp.Header.Get("ETag"))
+	resp, err = httpClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("expected 304 for a current ETag, got %d", resp.StatusCode)
+	}
+	req, err = http.NewRequest(http.MethodDelete, srv.URL+"/api/v1/chirps/"+strconv.Itoa(chirp.ID), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("If-Match", `"stale"`)
+	resp, err = httpClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("expected 412 for a stale ETag, got %d", resp.StatusCode)
+	}
+
+	for _, accept := range []string{mediaTypeNDJSON, mediaTypeMsgpack} {
+		for _, path := range []string{"/api/v1/chirps", "/api/v1/chirps/" + strconv.Itoa(chirp.ID)} {
+			req, err := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Accept", accept)
+			resp, err := httpClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+		}
+	}
+
+	if _, err := authed.UpdateUser(ctx, "alice@example.org", "password2"); err != nil {
+		t.Error(err)
+	}
+	if err := c.Revoke(ctx, session.RefreshToken); err != nil {
+		t.Error(err)
+	}
+	if err := authed.DeleteUser(ctx); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const apiV1Prefix = "/api/v1"
+
+// The unversioned /api routes were deprecated when /api/v1 was added and
+// are removed after apiSunset.
+var (
+	apiDeprecatedAt = time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	apiSunset       = time.Date(2027, 4, 19, 0, 0, 0, 0, time.UTC)
+)
+
+// router is the part of *http.ServeMux that routes are registered on,
+// so tests can list the registered patterns.
+type router interface {
+	Handle(pattern string, handler http.Handler)
+	HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request))
+}
+
+// registerRoutes adds every chirpy route to mux. Keep openapi.json in
+// step with it; TestOpenAPIRoutes checks that they match.
+func (cfg *apiConfig) registerRoutes(mux router, filepathRoot string) {
+	fsHandler := cfg.middlewareMetricsInc(http.StripPrefix("/app", http.FileServer(http.Dir(filepathRoot))))
+	mux.Handle("/app/*", fsHandler)
+
+	mux.HandleFunc("GET /livez", cfg.handlerLivez)
+	mux.HandleFunc("GET /readyz", cfg.handlerReadyz)
+
+	api := apiRouter{mux}
+	api.HandleFunc("GET /healthz", cfg.handlerReadiness)
+	api.HandleFunc("GET /reset", cfg.handlerReset)
+
+	api.HandleFunc("POST /revoke", cfg.handlerRevoke)
+	api.HandleFunc("POST /refresh", cfg.handlerRefresh)
+	api.HandleFunc("POST /login", cfg.handlerLogin)
+
+	api.HandleFunc("POST /users", cfg.handlerUsersCreate)
+	api.HandleFunc("PUT /users", cfg.handlerUsersUpdate)
+	api.HandleFunc("DELETE /users", cfg.handlerUsersDelete)
+	api.HandleFunc("GET /users/me/export", cfg.handlerUsersExport)
+	api.HandleFunc("PUT /users/me/profile", cfg.handlerProfileUpdate)
+	api.HandleFunc("GET /users/{handle}", cfg.handlerProfileGet)
+	api.HandleFunc("GET /users/{handle}/chirps", cfg.handlerProfileChirps)
+
+	api.HandleFunc("POST /chirps", cfg.handlerChirpsCreate)
+	api.HandleFunc("GET /chirps", cfg.handlerChirpsRetrieve)
+	api.HandleFunc("GET /chirps/stream", cfg.handlerChirpsStream)
+	api.HandleFunc("GET /chirps/ws", cfg.handlerChirpsSocket)
+	api.HandleFunc("GET /chirps/{chirpID}", cfg.handlerChirpsGet)
+	api.HandleFunc("PUT /chirps/{chirpID}", cfg.handlerChirpsUpdate)
+	api.HandleFunc("DELETE /chirps/{chirpID}", cfg.handlerChirpDelete)
+	api.HandleFunc("GET /chirps/{chirpID}/revisions", cfg.handlerChirpRevisions)
+	api.HandleFunc("POST /chirps/{chirpID}/reports", cfg.handlerReportsCreate)
+
+	api.HandleFunc("GET /drafts", cfg.handlerDraftsGet)
+	api.HandleFunc("POST /drafts", cfg.handlerDraftsCreate)
+	api.HandleFunc("GET /drafts/{draftID}", cfg.handlerDraftGet)
+	api.HandleFunc("PUT /drafts/{draftID}", cfg.handlerDraftUpdate)
+	api.HandleFunc("DELETE /drafts/{draftID}", cfg.handlerDraftDelete)
+	api.HandleFunc("POST /drafts/{draftID}/publish", cfg.handlerDraftPublish)
+
+	api.HandleFunc("POST /appeals", cfg.handlerAppealsCreate)
+	api.HandleFunc("GET /moderation/reports", cfg.handlerModerationReports)
+	api.HandleFunc("POST /moderation/reports/{reportID}/actions", cfg.handlerModerationAction)
+	api.HandleFunc("GET /moderation/appeals", cfg.handlerModerationAppeals)
+	api.HandleFunc("POST /moderation/appeals/{appealID}/resolve", cfg.handlerModerationAppealResolve)
+
+	api.HandleFunc("GET /hashtags/trending", cfg.handlerHashtagsTrending)
+	api.HandleFunc("GET /hashtags/{tag}", cfg.handlerHashtagChirps)
+
+	api.HandleFunc("GET /blocks", cfg.handlerBlocksGet)
+	api.HandleFunc("POST /blocks", cfg.handlerBlocksCreate)
+	api.HandleFunc("DELETE /blocks/{userID}", cfg.handlerBlocksDelete)
+	api.HandleFunc("GET /mutes", cfg.handlerMutesGet)
+	api.HandleFunc("POST /mutes", cfg.handlerMutesCreate)
+	api.HandleFunc("DELETE /mutes/{userID}", cfg.handlerMutesDelete)
+	api.HandleFunc("GET /follows", cfg.handlerFollowsGet)
+	api.HandleFunc("POST /follows", cfg.handlerFollowsCreate)
+	api.HandleFunc("DELETE /follows/{userID}", cfg.handlerFollowsDelete)
+	api.HandleFunc("GET /followers", cfg.handlerFollowersGet)
+
+	api.HandleFunc("GET /notifications", cfg.handlerNotificationsGet)
+	api.HandleFunc("POST /notifications/read", cfg.handlerNotificationsReadAll)
+	api.HandleFunc("POST /notifications/{notificationID}/read", cfg.handlerNotificationRead)
+
+	api.HandleFunc("POST /media", cfg.handlerMediaUpload)
+	api.HandleFunc("GET /media/{mediaID}", cfg.handlerMediaGet)
+	api.HandleFunc("GET /media/{mediaID}/thumbnail", cfg.handlerMediaThumbnail)
+
+	api.HandleFunc("POST /polka/webhooks", cfg.handlerPolkaWebhook)
+
+	api.HandleFunc("POST /graphql", cfg.handlerGraphQL)
+
+	api.HandleFunc("GET /openapi.json", handlerOpenAPI)
+
+	mux.HandleFunc("GET /admin/metrics", cfg.handlerMetrics)
+	mux.HandleFunc("GET /admin/jobs", cfg.handlerJobsGet)
+	mux.HandleFunc("POST /admin/jobs/{name}/run", cfg.handlerJobRun)
+	mux.HandleFunc("GET /admin/audit", cfg.handlerAuditLog)
+	mux.HandleFunc("GET /admin/audit/verify", cfg.handlerAuditVerify)
+	mux.HandleFunc("GET /metrics", cfg.handlerPrometheus)
+}
+
+// apiRouter registers each route under /api/v1 and, for clients written
+// before the API was versioned, as a deprecated alias under /api.
+type apiRouter struct {
+	mux router
+}
+
+// HandleFunc registers handler for a pattern relative to the API root,
+// such as "GET /chirps".
+func (api apiRouter) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	method, path, _ := strings.Cut(pattern, " ")
+	api.mux.HandleFunc(method+" "+apiV1Prefix+path, handler)
+	api.mux.Handle(method+" /api"+path, middlewareDeprecated(http.HandlerFunc(handler)))
+}
+
+// middlewareDeprecated marks responses from a deprecated alias with the
+// Deprecation (RFC 9745) and Sunset (RFC 8594) headers and links to the
+// /api/v1 route that replaces it.
+func middlewareDeprecated(next http.Handler) http.Handler {
+	deprecation := "@" + strconv.FormatInt(apiDeprecatedAt.Unix(), 10)
+	sunset := apiSunset.Format(http.TimeFormat)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		successor := apiV1Prefix + strings.TrimPrefix(r.URL.Path, "/api")
+		w.Header().Set("Deprecation", deprecation)
+		w.Header().Set("Sunset", sunset)
+		w.Header().Add("Link", "<"+successor+`>; rel="successor-version"`)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// apiV1Pattern returns the /api/v1 pattern a deprecated alias was
+// registered for, or pattern itself, so limits keyed by pattern apply to
+// both.
+func apiV1Pattern(pattern string) string {
+	method, path, ok := strings.Cut(pattern, " ")
+	if !ok || !strings.HasPrefix(path, "/api/") || strings.HasPrefix(path, apiV1Prefix+"/") {
+		return pattern
+	}
+	return method + " " + apiV1Prefix + strings.TrimPrefix(path, "/api")
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDeprecatedAliases(t *testing.T) {
+	_, mux := newTestAPI(t)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/chirps?sort=desc", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected the alias to keep working, got %d", w.Code)
+	}
+	if w.Header().Get("Deprecation") == "" || w.Header().Get("Sunset") != apiSunset.Format(http.TimeFormat) {
+		t.Errorf("expected Deprecation and Sunset headers, got %v", w.Header())
+	}
+	if got := w.Header().Get("Link"); got != `</api/v1/chirps>; rel="successor-version"` {
+		t.Errorf("unexpected Link %q", got)
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/chirps", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Deprecation") != "" {
+		t.Errorf("expected /api/v1 not to be deprecated, got %d %v", w.Code, w.Header())
+	}
+}
+
+func TestAPIV1Pattern(t *testing.T) {
+	for pattern, want := range map[string]string{
+		"POST /api/login":                     "POST /api/v1/login",
+		"POST /api/v1/login":                  "POST /api/v1/login",
+		"GET /api/chirps/{chirpID}/revisions": "GET /api/v1/chirps/{chirpID}/revisions",
+		"GET /metrics":                        "GET /metrics",
+		"/app/*":                              "/app/*",
+	} {
+		if got := apiV1Pattern(pattern); got != want {
+			t.Errorf("apiV1Pattern(%q) = %q, want %q", pattern, got, want)
+		}
+	}
+}
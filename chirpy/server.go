@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/config"
+)
+
+// routeBodyLimits overrides the default request body limit for routes
+// that accept more, keyed by the ServeMux pattern.
+var routeBodyLimits = map[string]int64{
+	"POST /api/v1/media": maxMediaSize + 1<<20,
+}
+
+// middlewareMaxBody caps the size of every request body so a client can't
+// tie up a handler streaming an unbounded upload.
+func middlewareMaxBody(mux *http.ServeMux, limit int64, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := limit
+		_, pattern := mux.Handler(r)
+		if l, ok := routeBodyLimits[apiV1Pattern(pattern)]; ok {
+			n = l
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, n)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// serve runs the servers until ctx is cancelled or one of them fails,
+// then marks chirpy as draining, waits ShutdownDelay, and gives in-flight
+// requests up to ShutdownTimeout to finish before the caller flushes and
+// exits. Servers with a TLSConfig serve HTTPS.
+func (cfg *apiConfig) serve(ctx context.Context, sc config.HTTP, servers ...*http.Server) error {
+	errCh := make(chan error, len(servers))
+	for _, srv := range servers {
+		go func() {
+			if srv.TLSConfig != nil {
+				errCh <- srv.ListenAndServeTLS("", "")
+				return
+			}
+			errCh <- srv.ListenAndServe()
+		}()
+	}
+
+	running := len(servers)
+	var serveErr error
+	select {
+	case serveErr = <-errCh:
+		running--
+	case <-ctx.Done():
+		slog.Info("Shutting down", "delay", sc.ShutdownDelay, "timeout", sc.ShutdownTimeout)
+		cfg.draining.Store(true)
+		time.Sleep(sc.ShutdownDelay)
+	}
+
+	// streams never go idle, so Shutdown would wait them out; ending
+	// them lets their clients reconnect to another instance
+	cfg.chirpEvents.Close()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), sc.ShutdownTimeout)
+	defer cancel()
+	shutdownErrs := make([]error, len(servers))
+	var wg sync.WaitGroup
+	for i, srv := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := srv.Shutdown(shutdownCtx)
+			if errors.Is(err, context.DeadlineExceeded) {
+				slog.Warn("Drain deadline passed, closing remaining connections", "addr", srv.Addr)
+				err = srv.Close()
+			}
+			shutdownErrs[i] = err
+		}()
+	}
+	wg.Wait()
+
+	for ; running > 0; running-- {
+		if err := <-errCh; serveErr == nil && !errors.Is(err, http.ErrServerClosed) {
+			serveErr = err
+		}
+	}
+	if serveErr != nil {
+		return serveErr
+	}
+	return errors.Join(shutdownErrs...)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/config"
+)
+
+func TestServeShutdown(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		timeout time.Duration
+		// finish is whether the in-flight request finishes during the drain
+		finish bool
+	}{
+		{"drains in-flight requests", 5 * time.Second, true},
+		{"drain deadline passes", 100 * time.Millisecond, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, mux := newTestAPI(t)
+
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			addr := l.Addr().String()
+			l.Close()
+
+			entered, release := make(chan struct{}), make(chan struct{})
+			defer close(release)
+			srv := &http.Server{
+				Addr: addr,
+				Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if r.URL.Path == "/slow" {
+						close(entered)
+						<-release
+					}
+					mux.ServeHTTP(w, r)
+				}),
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			served := make(chan error, 1)
+			go func() {
+				served <- cfg.serve(ctx, config.HTTP{ShutdownDelay: 200 * time.Millisecond, ShutdownTimeout: tt.timeout}, srv)
+			}()
+
+			get := func(path string) (*http.Response, error) {
+				// a fresh connection each time, so requests made while
+				// draining aren't sent over one that is being closed
+				client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+				return client.Get("http://" + addr + path)
+			}
+			var resp *http.Response
+			for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+				if resp, err = get("/api/v1/healthz"); err == nil {
+					break
+				}
+				if time.Since(start) > 5*time.Second {
+					t.Fatalf("server didn't start: %v", err)
+				}
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("expected a healthy server, got %d", resp.StatusCode)
+			}
+
+			slow := make(chan error, 1)
+			go func() {
+				resp, err := get("/slow")
+				if err == nil {
+					resp.Body.Close()
+				}
+				slow <- err
+			}()
+			<-entered
+			cancel()
+			for !cfg.draining.Load() {
+				time.Sleep(time.Millisecond)
+			}
+
+			// during the shutdown delay the listener is still open, but
+			// health checks tell load balancers to go away
+			for _, path := range []string{"/api/v1/healthz", "/readyz?verbose"} {
+				resp, err := get(path)
+				if err != nil {
+					t.Fatalf("%s: expected the server to answer while draining: %v", path, err)
+				}
+				body, _ := io.ReadAll(resp.Body)
+				resp.Body.Close()
+				if resp.StatusCode != http.StatusServiceUnavailable {
+					t.Errorf("%s: expected 503 while draining, got %d %s", path, resp.StatusCode, body)
+				}
+				if strings.Contains(path, "verbose") && !strings.Contains(string(body), "[-]shutdown failed") {
+					t.Errorf("%s: expected the shutdown check to fail, got %s", path, body)
+				}
+			}
+
+			if tt.finish {
+				release <- struct{}{}
+			}
+			select {
+			case err := <-served:
+				if err != nil {
+					t.Errorf("expected a clean shutdown, got %v", err)
+				}
+			case <-time.After(tt.timeout + 5*time.Second):
+				t.Fatal("serve didn't return")
+			}
+			if err := <-slow; (err == nil) != tt.finish {
+				t.Errorf("expected the in-flight request to finish: %v, got %v", tt.finish, err)
+			}
+		})
+	}
+}
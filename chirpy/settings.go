@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/config"
+)
+
+// settings is the part of the configuration handlers read per request.
+// It is swapped as a whole on SIGHUP, so handlers should Load it once
+// and use that snapshot.
+type settings struct {
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
+
+	chirpMaxLength  int
+	chirpEditWindow time.Duration
+	// anonymizeDeletedChirps keeps a deleted user's chirps with the
+	// author removed instead of deleting them.
+	anonymizeDeletedChirps bool
+
+	moderatorEmails map[string]struct{}
+	trustedProxies  []*net.IPNet
+}
+
+func newSettings(c config.Config) (*settings, error) {
+	trustedProxies, err := parseTrustedProxies(c.Server.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("server.trusted_proxies: %w", err)
+	}
+	moderatorEmails := map[string]struct{}{}
+	for _, email := range c.Moderation.ModeratorEmails {
+		moderatorEmails[email] = struct{}{}
+	}
+	return &settings{
+		accessTokenTTL:  c.Auth.AccessTokenTTL,
+		refreshTokenTTL: c.Auth.RefreshTokenTTL,
+
+		chirpMaxLength:         c.Chirps.MaxLength,
+		chirpEditWindow:        c.Chirps.EditWindow,
+		anonymizeDeletedChirps: c.Chirps.DeletedUserChirps == "anonymize",
+
+		moderatorEmails: moderatorEmails,
+		trustedProxies:  trustedProxies,
+	}, nil
+}
+
+// reloadOnHangup re-reads the configuration on SIGHUP and applies the
+// settings that are safe to change while running. Anything else that
+// changed is logged as needing a restart.
+func (cfg *apiConfig) reloadOnHangup(args []string, current config.Config, logLevel *slog.LevelVar) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		next, err := config.Load(args, os.Getenv, io.Discard)
+		if err == nil {
+			err = next.Validate()
+		}
+		if err != nil {
+			slog.Error("Couldn't reload configuration, keeping the current one", "error", err)
+			continue
+		}
+
+		reloaded, restart := current.Reload(next)
+		s, err := newSettings(reloaded)
+		if err != nil {
+			slog.Error("Couldn't reload configuration, keeping the current one", "error", err)
+			continue
+		}
+		if err := logLevel.UnmarshalText([]byte(reloaded.Log.Level)); err != nil {
+			slog.Error("Couldn't reload configuration, keeping the current one", "error", err)
+			continue
+		}
+		cfg.settings.Store(s)
+		current = reloaded
+
+		if len(restart) > 0 {
+			slog.Warn("Some settings only take effect after a restart", "settings", restart)
+		}
+		slog.Info("Reloaded configuration")
+	}
+}
+
+// runConfigCommand implements "chirpy config show", which prints the
+// effective configuration with secrets redacted.
+func runConfigCommand(args []string) int {
+	if len(args) == 0 || args[0] != "show" {
+		fmt.Fprintln(os.Stderr, "usage: chirpy config show [flags]")
+		return 2
+	}
+
+	c, err := config.Load(args[1:], os.Getenv, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if err := c.WriteYAML(os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := c.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "\ninvalid configuration:\n%v\n", err)
+		return 1
+	}
+	return 0
+}
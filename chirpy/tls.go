@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/certs"
+	"github.com/JoshuaTapp/BootDevProjects/chirpy/internal/config"
+)
+
+// setupTLS configures srv to serve HTTPS from the configured files and
+// starts watching them for renewed certificates until ctx is done.
+func setupTLS(ctx context.Context, srv *http.Server, conf config.TLS) (*certs.Reloader, error) {
+	reloader, err := certs.NewReloader(conf.CertFile, conf.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := certs.ServerConfig(reloader, conf.PolkaClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	srv.TLSConfig = tlsConfig
+
+	go reloader.Watch(ctx, conf.ReloadInterval, func(err error) {
+		if err != nil {
+			slog.Error("Couldn't reload TLS certificate, keeping the current one", "error", err)
+			return
+		}
+		slog.Info("Reloaded TLS certificate", "cert_file", conf.CertFile)
+	})
+	return reloader, nil
+}
+
+// middlewareHSTS tells browsers to only use HTTPS for this host.
+func middlewareHSTS(maxAge time.Duration, next http.Handler) http.Handler {
+	value := "max-age=" + strconv.Itoa(int(maxAge/time.Second)) + "; includeSubDomains"
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Strict-Transport-Security", value)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// redirectToHTTPS sends plain HTTP requests to the same URL on the HTTPS
+// port.
+func redirectToHTTPS(httpsPort int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if httpsPort != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(httpsPort))
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// spanRecorder installs a global tracer provider that records spans. The
+// package level tracers only pick up the first provider installed, so it
+// is shared by every test that needs one.
+var spanRecorder = sync.OnceValue(func() *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return recorder
+})
+
+func TestTracingPropagation(t *testing.T) {
+	recorder := spanRecorder()
+	_, mux := newTestAPI(t)
+	handler := middlewareTracing(mux, mux)
+
+	var traceID trace.TraceID
+	var parentID trace.SpanID
+	rand.Read(traceID[:])
+	rand.Read(parentID[:])
+
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/users", strings.NewReader(`{"email":"alice@example.com","password":"hunter22"}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("traceparent", "00-"+traceID.String()+"-"+parentID.String()+"-01")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("couldn't create user: %d %s", w.Code, w.Body)
+	}
+
+	var spans []sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.SpanContext().TraceID() == traceID {
+			spans = append(spans, span)
+		}
+	}
+	// find returns the span called name whose parent is parentID.
+	find := func(name string, parentID trace.SpanID) (sdktrace.ReadOnlySpan, bool) {
+		for _, span := range spans {
+			if span.Name() == name && span.Parent().SpanID() == parentID {
+				return span, true
+			}
+		}
+		return nil, false
+	}
+
+	route, ok := find("POST /api/v1/users", parentID)
+	if !ok {
+		t.Fatalf("expected the route span to continue the caller's span %s, got %d spans in the trace", parentID, len(spans))
+	}
+	if !route.Parent().IsRemote() || route.SpanKind() != trace.SpanKindServer {
+		t.Errorf("expected a server span with a remote parent, got %+v", route)
+	}
+
+	createUser, ok := find("DB.CreateUser", route.SpanContext().SpanID())
+	if !ok {
+		t.Fatal("expected DB.CreateUser to be a child of the route span")
+	}
+	for _, tt := range []struct {
+		name   string
+		parent sdktrace.ReadOnlySpan
+	}{
+		{"auth.HashPassword", route},
+		{"DB.AppendAudit", route},
+		{"DB.loadDB", createUser},
+		{"DB.writeDB", createUser},
+	} {
+		if _, ok := find(tt.name, tt.parent.SpanContext().SpanID()); !ok {
+			t.Errorf("expected a %s span as a child of %s", tt.name, tt.parent.Name())
+		}
+	}
+}